@@ -28,7 +28,6 @@ var App *Application
 
 type Scheduler struct {
 	DingTalkClient *dt.DingTalkClient // 钉钉APP使用审批流
-	RobotClient    *dt.RobotClient    // 钉钉机器人
 	InstanceIO     *io.InstanceIO     // 刷服务器信息入库
 }
 
@@ -83,11 +82,12 @@ func NewApplication(debug bool, logDir, version, config string) *Application {
 	}
 	go http.ListenAndServe(":6060", nil)
 
-	fmt.Println("jms version: ", App.Version)
-	fmt.Println("log file: ", logfile)
-	fmt.Println("ssh dir: ", App.SSHDir)
-	fmt.Println("home dir: ", App.HomeDir)
-	fmt.Println("pprof: localhost:6060")
+	// 启动信息输出到 stderr，避免影响 jms access 等命令的 stdout 输出
+	fmt.Fprintln(os.Stderr, "jms version: ", App.Version)
+	fmt.Fprintln(os.Stderr, "log file: ", logfile)
+	fmt.Fprintln(os.Stderr, "ssh dir: ", App.SSHDir)
+	fmt.Fprintln(os.Stderr, "home dir: ", App.HomeDir)
+	fmt.Fprintln(os.Stderr, "pprof: localhost:6060")
 
 	return App
 }
@@ -163,7 +163,14 @@ func (app *Application) WithDB(migrate bool) *Application {
 			&model.SSHLoginRecord{}, &model.ScpRecord{}, // 审计
 			&model.Broadcast{},
 			&model.ShellTask{}, &model.ShellTaskRecord{}, // 定时任务功能
-			&model.Server{}, // 实例
+			&model.Server{},                              // 实例
+			&model.RoleBinding{}, &model.ApiDenyRecord{}, // 接口角色权限
+			&model.ApiToken{},                            // 个人访问令牌
+			&model.ApiChangeRecord{},                     // 管理接口变更审计
+			&model.PolicyRevision{},                      // 策略版本记录
+			&model.ManagedResource{},                     // jms apply 管理的资源
+			&model.Approval{}, &model.ApprovalDecision{}, // 内置审批
+			&model.BreakGlass{}, // 紧急访问复盘
 		)
 	}
 
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/io"
+	"github.com/xops-infra/jms/model"
+	"github.com/xops-infra/noop/log"
+)
+
+var (
+	accessUser   string
+	accessServer string
+	accessFormat string
+	accessOutput string
+)
+
+// accessCmd 权限报表，用于权限复核
+var accessCmd = &cobra.Command{
+	Use:   "access",
+	Short: "effective access report of user or server",
+	Long: `effective access report, evaluate every server against user's policies and system rules.
+	jms access --user alice --format csv --output alice.csv
+	jms access --server 10.9.0.1
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if (accessUser == "") == (accessServer == "") {
+			cmd.Help()
+			return
+		}
+		model.InitConfig(config)
+		_app := app.NewApplication(debug, logDir, rootCmd.Version, config)
+		if !_app.Config.WithDB.Enable {
+			log.Fatalf("check your config! not enable db")
+		}
+		_app.WithDB(false)
+		sshdIO := io.NewSshd(_app.DBIo, _app.Config.LocalServers.ToMapWithHost(), _app.Config.SystemPolicy)
+
+		var report model.AccessReport
+		var err error
+		if accessUser != "" {
+			report, err = sshdIO.UserAccessReport(accessUser)
+		} else {
+			report, err = sshdIO.ServerAccessReport(accessServer)
+		}
+		if err != nil {
+			log.Fatalf("access report failed: %s", err.Error())
+		}
+
+		out := os.Stdout
+		if accessOutput != "" {
+			out, err = os.Create(accessOutput)
+			if err != nil {
+				log.Fatalf("create output file failed: %s", err.Error())
+			}
+			defer out.Close()
+		}
+		switch accessFormat {
+		case "csv":
+			err = report.WriteCSV(out)
+		case "json":
+			encoder := json.NewEncoder(out)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(report)
+		default:
+			log.Fatalf("unsupported format %s, must be json or csv", accessFormat)
+		}
+		if err != nil {
+			log.Fatalf("write report failed: %s", err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(accessCmd)
+
+	accessCmd.Flags().StringVarP(&accessUser, "user", "u", "", "username to report")
+	accessCmd.Flags().StringVarP(&accessServer, "server", "s", "", "server ip, name or id to report who can reach it")
+	accessCmd.Flags().StringVarP(&accessFormat, "format", "f", "json", "output format, json or csv")
+	accessCmd.Flags().StringVarP(&accessOutput, "output", "o", "", "output file, default stdout")
+}
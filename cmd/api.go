@@ -14,7 +14,10 @@ import (
 	"github.com/google/gops/agent"
 	"github.com/xops-infra/jms/app"
 	"github.com/xops-infra/jms/core/api"
+	"github.com/xops-infra/jms/core/siem"
+	"github.com/xops-infra/jms/io"
 	"github.com/xops-infra/jms/model"
+	"github.com/xops-infra/jms/utils"
 )
 
 var apiPort int
@@ -46,6 +49,18 @@ var apiCmd = &cobra.Command{
 		if app.App.Config.WithDB.Enable {
 			log.Infof("enable db without automigrate")
 			_app.WithDB(false)
+			// 权限校验接口复用 sshd 的策略判断
+			_app.Sshd.SshdIO = io.NewSshd(_app.DBIo, _app.Config.LocalServers.ToMapWithHost(), _app.Config.SystemPolicy).WithAuthzHook(_app.Config.WithAuthzHook)
+		}
+		siem.Init("api")
+
+		if app.App.Config.WithApiAuth.Enable && app.App.Config.WithLdap.Enable {
+			log.Infof("enable api auth with ldap")
+			ldap, err := utils.NewLdap(_app.Config.WithLdap)
+			if err != nil {
+				panic(err)
+			}
+			_app.Sshd.Ldap = ldap
 		}
 
 		log.Infof("api server start on port: %d", apiPort)
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/siem"
+	"github.com/xops-infra/jms/model"
+	"github.com/xops-infra/noop/log"
+)
+
+var (
+	applyFile   string
+	applyDryRun bool
+	applyPrune  bool
+	applyForce  bool
+	exportOwner string
+	exportFile  string
+)
+
+// applyCmd 声明式同步，访问规则放在 git 里管理
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "reconcile users, policies, proxies and keys from yaml",
+	Long: `reconcile users, policies, proxies and keys metadata from yaml, only resources owned by the owner in yaml will be changed.
+	jms apply -f access.yaml --dry-run
+	jms apply -f access.yaml --prune
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if applyFile == "" {
+			cmd.Help()
+			return
+		}
+		data, err := os.ReadFile(applyFile)
+		if err != nil {
+			log.Fatalf("read %s failed: %s", applyFile, err.Error())
+		}
+		spec, err := model.ParseAccessSpec(data)
+		if err != nil {
+			log.Fatalf("invalid %s: %s", applyFile, err.Error())
+		}
+		model.InitConfig(config)
+		_app := app.NewApplication(debug, logDir, rootCmd.Version, config)
+		if !_app.Config.WithDB.Enable {
+			log.Fatalf("check your config! not enable db")
+		}
+		_app.WithDB(false)
+		// 策略变更推送到 SIEM，和接口修改一样审计
+		siem.Init("apply")
+
+		plan, err := _app.DBIo.WithAuthor(spec.Owner).ApplyAccessSpec(spec, model.ApplyOptions{
+			DryRun: applyDryRun,
+			Prune:  applyPrune,
+			Force:  applyForce,
+		})
+		plan.WriteText(os.Stdout)
+		siem.Close()
+		if err != nil {
+			log.Fatalf("apply failed: %s", err.Error())
+		}
+		if applyDryRun {
+			log.Infof("dry run, nothing changed")
+		}
+	},
+}
+
+// exportCmd 导出当前状态，格式和 apply 一致
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export users, policies, proxies and keys metadata as yaml",
+	Long: `export current state in the same format as jms apply, secrets are not exported.
+	jms export -o access.yaml
+	jms export --owner jms-apply
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		model.InitConfig(config)
+		_app := app.NewApplication(debug, logDir, rootCmd.Version, config)
+		if !_app.Config.WithDB.Enable {
+			log.Fatalf("check your config! not enable db")
+		}
+		_app.WithDB(false)
+
+		spec, err := _app.DBIo.ExportAccessSpec(exportOwner)
+		if err != nil {
+			log.Fatalf("export failed: %s", err.Error())
+		}
+		data, err := spec.ToYAML()
+		if err != nil {
+			log.Fatalf("export failed: %s", err.Error())
+		}
+		if exportFile == "" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(exportFile, data, 0644); err != nil {
+			log.Fatalf("write %s failed: %s", exportFile, err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(exportCmd)
+
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "yaml file to apply")
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "only print the diff")
+	applyCmd.Flags().BoolVar(&applyPrune, "prune", false, "delete owned resources which are not in the file")
+	applyCmd.Flags().BoolVar(&applyForce, "force", false, "take over unowned resources and overwrite manual changes")
+
+	exportCmd.Flags().StringVar(&exportOwner, "owner", "", "only export resources owned by the owner")
+	exportCmd.Flags().StringVarP(&exportFile, "output", "o", "", "output file, default stdout")
+}
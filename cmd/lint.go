@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/model"
+	"github.com/xops-infra/noop/log"
+)
+
+var lintFormat string
+
+// lintCmd 策略检查，有 error 级别的问题时退出码为 1，方便放到 CI 里
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "scan all policies and report problems",
+	Long: `scan all policies and report empty filters, filters matching no server, expired but enabled policies,
+deny policies shadowing allows and duplicate grants.
+	jms lint
+	jms lint --format json
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		model.InitConfig(config)
+		_app := app.NewApplication(debug, logDir, rootCmd.Version, config)
+		if !_app.Config.WithDB.Enable {
+			log.Fatalf("check your config! not enable db")
+		}
+		_app.WithDB(false)
+
+		report, err := _app.DBIo.LintPolicies()
+		if err != nil {
+			log.Fatalf("lint failed: %s", err.Error())
+		}
+		switch lintFormat {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(report)
+		case "text":
+			for _, issue := range report.Issues {
+				fmt.Printf("%s\t%s\t%s(%s)\t%s\n", issue.Level, issue.Rule, issue.PolicyName, issue.PolicyID, issue.Message)
+			}
+			fmt.Printf("%d policies, %d servers, %d issues\n", report.Policies, report.Servers, len(report.Issues))
+		default:
+			log.Fatalf("unsupported format %s, must be text or json", lintFormat)
+		}
+		if report.HasError() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+
+	lintCmd.Flags().StringVarP(&lintFormat, "format", "f", "text", "output format, text or json")
+}
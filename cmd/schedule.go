@@ -10,10 +10,11 @@ import (
 	"github.com/patrickmn/go-cache"
 	"github.com/robfig/cron"
 	"github.com/spf13/cobra"
-	dt "github.com/xops-infra/go-dingtalk-sdk-wrapper"
 	"github.com/xops-infra/jms/app"
 	"github.com/xops-infra/jms/core"
+	"github.com/xops-infra/jms/core/approval"
 	"github.com/xops-infra/jms/core/dingtalk"
+	"github.com/xops-infra/jms/core/siem"
 	"github.com/xops-infra/jms/io"
 	"github.com/xops-infra/noop/log"
 )
@@ -27,6 +28,7 @@ var SchedulerCmd = &cobra.Command{
 - 执行定时任务，检查机器 ssh 可连接性；
 - 执行定时任务，加载云服务器信息入库；
 - 执行定时任务，检查机器 ssh 可连接性并依据配置发送钉钉告警通知；
+- 执行定时任务，临时策略到期前提醒并标记过期策略；
 - 执行批量脚本；
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -36,8 +38,9 @@ var SchedulerCmd = &cobra.Command{
 		if app.App.Config.WithDB.Enable {
 			log.Infof("enable db with automigrate")
 			_app.WithDB(true)
-			app.App.Sshd.SshdIO = io.NewSshd(app.App.DBIo, app.App.Config.LocalServers.ToMapWithHost()) // todo: 把认证那块的函数移到 db操作
+			app.App.Sshd.SshdIO = io.NewSshd(app.App.DBIo, app.App.Config.LocalServers.ToMapWithHost(), app.App.Config.SystemPolicy) // todo: 把认证那块的函数移到 db操作
 		}
+		siem.Init("schedule")
 
 		if app.App.Config.WithDingtalk.Enable {
 			log.Infof("enable dingtalk")
@@ -50,9 +53,9 @@ var SchedulerCmd = &cobra.Command{
 			}
 		}
 
-		if app.App.Config.WithSSHCheck.Enable {
-			log.Infof("enable dingtalk")
-			_app.Scheduler.RobotClient = dt.NewRobotClient()
+		if app.App.Config.WithFeishu.Enable && !app.App.Config.WithDB.Enable {
+			app.App.Config.WithFeishu.Enable = false
+			log.Warnf("feishu enable but db not enable, disable feishu")
 		}
 
 		app.App.WithMcs()
@@ -103,13 +106,20 @@ func startScheduler() {
 				log.Error(err.Error())
 			}
 		})
-		// 定时获取审批列表状态
+	}
+
+	if approval.Enabled() {
+		// 定时获取钉钉、飞书审批状态，配置了回调的审批每 10 分钟兜底同步一次
 		c.AddFunc("0 * * * * *", func() {
-			dingtalk.LoadApproval()
+			approval.Reconcile(time.Now().Minute()%10 == 0)
 		})
 	}
 
 	if app.App.Config.WithDB.Enable {
+		// 每分钟检查临时策略到期提醒和过期标记
+		c.AddFunc("30 * * * * *", func() {
+			core.PolicyExpiryChecker()
+		})
 		c.AddFunc("0 * * * * *", func() {
 			log.Infof("run shell task")
 			err := core.ServerShellRun() // 每 1min 检查一次
@@ -125,7 +135,7 @@ func startScheduler() {
 		log.Infof("with ssh check,5min check once")
 		c.AddFunc("0 */5 * * * *", func() {
 			log.Infof("run ssh check")
-			core.ServerLiveness(app.App.Config.WithSSHCheck.Alert.RobotToken)
+			core.ServerLiveness()
 		})
 	}
 
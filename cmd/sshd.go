@@ -17,7 +17,9 @@ import (
 
 	"github.com/xops-infra/jms/app"
 	"github.com/xops-infra/jms/core"
+	"github.com/xops-infra/jms/core/notify"
 	"github.com/xops-infra/jms/core/pui"
+	"github.com/xops-infra/jms/core/siem"
 	"github.com/xops-infra/jms/core/sshd"
 	"github.com/xops-infra/jms/io"
 	"github.com/xops-infra/jms/utils"
@@ -67,6 +69,7 @@ var sshdCmd = &cobra.Command{
 			log.Infof("enable db without automigrate")
 			_app.WithDB(false) // sshd 只管连接，api 才去操作数据库
 		}
+		siem.Init("sshd")
 
 		if app.App.Config.WithDingtalk.Enable {
 			log.Infof("enable dingtalk")
@@ -79,7 +82,7 @@ var sshdCmd = &cobra.Command{
 			}
 		}
 
-		app.App.Sshd.SshdIO = io.NewSshd(app.App.DBIo, app.App.Config.LocalServers.ToMapWithHost())
+		app.App.Sshd.SshdIO = io.NewSshd(app.App.DBIo, app.App.Config.LocalServers.ToMapWithHost(), app.App.Config.SystemPolicy).WithAuthzHook(app.App.Config.WithAuthzHook)
 		app.App.Sshd.UserCache = cache.New(cache.NoExpiration, cache.NoExpiration)
 
 		go startSshdScheduler()
@@ -139,39 +142,57 @@ func init() {
 
 }
 
+// 密码登录失败时发送 auth_failure 通知，同一用户和来源 IP 限流
 func passwordAuth(ctx ssh.Context, pass string) bool {
+	err := checkPassword(ctx.User(), pass)
+	siem.Emit(siem.AuthEvent("password", ctx.User(), ctx.RemoteAddr().String(), err))
+	if err != nil {
+		log.Warnf("user: %s, remote addr: %s password auth failed: %s", ctx.User(), ctx.RemoteAddr(), err)
+		notify.AuthFailure("sshd", ctx.User(), ctx.RemoteAddr().String(), err)
+		return false
+	}
+	return true
+}
+
+func checkPassword(user, pass string) error {
 	if app.App.Config.WithLdap.Enable {
-		err := app.App.Sshd.Ldap.Login(ctx.User(), pass)
-		return err == nil
+		return app.App.Sshd.Ldap.Login(user, pass)
 	}
 	// 如果启用 policy策略，登录时需要验证用户密码
 	if app.App.Config.WithDB.Enable {
-		allow, err := app.App.DBIo.Login(ctx.User(), pass)
+		allow, err := app.App.DBIo.Login(user, pass)
 		if err != nil {
 			log.Error(err.Error())
-			return false
+			return err
 		}
-		return allow
-	} else {
-		// 当 ladp和数据库都么启用的时候， 默认认证，jms/jms
-		switch ctx.User() {
-		case "jms":
-			return pass == "jms"
-		default:
-			return false
+		if !allow {
+			return errors.New("password not match")
 		}
+		return nil
+	}
+	// 当 ladp和数据库都么启用的时候， 默认认证，jms/jms
+	if user == "jms" && pass == "jms" {
+		return nil
 	}
+	return errors.New("password not match")
 }
 
 // 支持authorized_keys读取 pub key 认证
 // 还支持pubkey在数据库
+// 客户端会依次尝试多个 key，只记录成功的
 func publicKeyAuth(ctx ssh.Context, key ssh.PublicKey) bool {
+	var ok bool
 	if app.App.Config.WithDB.Enable {
 		// 数据库读取数据认证
-		return app.App.DBIo.AuthKey(ctx.User(), key)
+		ok = app.App.DBIo.AuthKey(ctx.User(), key)
+	} else {
+		// 否则走文件认证
+		ok = utils.AuthFromFile(ctx, key, app.App.SSHDir)
 	}
-	// 否则走文件认证
-	return utils.AuthFromFile(ctx, key, app.App.SSHDir)
+	if ok {
+		siem.Emit(siem.AuthEvent("publickey", ctx.User(), ctx.RemoteAddr().String(), nil))
+	}
+	return ok
 }
 
 func sessionHandler(sess *ssh.Session) {
@@ -204,6 +225,13 @@ func sessionHandler(sess *ssh.Session) {
 		(*sess).Exit(0)
 	case "ssh":
 		log.Warnf("user: %s, remote addr: %s login success", user, remote)
+		if len(args) > 0 && strings.Contains(args[0], "@") {
+			// ssh jms ssh root@10.9.x.x 直连目标机器
+			if err := sshd.DirectLogin(args[0], sess); err != nil {
+				sshd.ErrorInfo(err, sess)
+			}
+			return
+		}
 		sshHandler(sess)
 	default:
 		log.Warnf("user: %s, remote addr: %s login success", user, remote)
@@ -272,6 +300,12 @@ func startSshdScheduler() {
 	c.AddFunc(cron, func() {
 		core.AuditLogArchiver()
 	})
+	if app.App.Config.WithDB.Enable {
+		// 每分钟检查策略时间窗口和过期，关闭或过期后断开会话
+		c.AddFunc("0 * * * * *", func() {
+			core.SessionScheduleChecker()
+		})
+	}
 	c.Start()
 	select {}
 }
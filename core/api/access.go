@@ -0,0 +1,58 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/model"
+)
+
+// @Summary 权限报表
+// @Description 查询用户能访问的服务器以及每个动作的授权策略和过期时间，或者反向查询能访问某台服务器的用户，user 和 server 二选一
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Param user query string false "user"
+// @Param server query string false "server ip, name or id"
+// @Param format query string false "json or csv, default json"
+// @Success 200 {object} model.AccessReport
+// @Router /api/v1/audit/access [get]
+func accessReport(c *gin.Context) {
+	if app.App.Sshd.SshdIO == nil {
+		c.JSON(500, "db is not enable, check withDB config")
+		return
+	}
+	user, server := c.Query("user"), c.Query("server")
+	if (user == "") == (server == "") {
+		c.JSON(400, "one of user or server is required")
+		return
+	}
+	var report model.AccessReport
+	var err error
+	if user != "" {
+		report, err = app.App.Sshd.SshdIO.UserAccessReport(user)
+	} else {
+		report, err = app.App.Sshd.SshdIO.ServerAccessReport(server)
+	}
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(200, report)
+	case "csv":
+		var buf bytes.Buffer
+		if err := report.WriteCSV(&buf); err != nil {
+			c.JSON(500, err.Error())
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=access.csv")
+		c.Data(200, "text/csv", buf.Bytes())
+	default:
+		c.JSON(400, fmt.Sprintf("unsupported format %s", c.Query("format")))
+	}
+}
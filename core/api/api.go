@@ -2,15 +2,14 @@ package api
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/alibabacloud-go/tea/tea"
 	"github.com/gin-gonic/gin"
-	dt "github.com/xops-infra/go-dingtalk-sdk-wrapper"
 	"github.com/xops-infra/noop/log"
 
 	"github.com/xops-infra/jms/app"
-	"github.com/xops-infra/jms/core/dingtalk"
+	"github.com/xops-infra/jms/core/approval"
+	"github.com/xops-infra/jms/core/notify"
 	. "github.com/xops-infra/jms/model"
 )
 
@@ -33,80 +32,32 @@ func createApproval(c *gin.Context) {
 		c.JSON(400, fmt.Errorf("Applicant is empty"))
 		return
 	}
-	// 如果启用了审批，创建审批
-	if app.App.Config.WithDingtalk.Enable {
-		values := []dt.FormComponentValue{
-			{
-				Name:  tea.String("EnvType"),
-				Value: tea.String("prod"),
-			},
-		}
-		if req.ServerFilter != nil {
-			values = append(values, dt.FormComponentValue{
-				Name:  tea.String("ServerFilter"),
-				Value: tea.String(tea.Prettify(req.ServerFilter)),
-			})
-		}
-		if req.Period != nil {
-			values = append(values, dt.FormComponentValue{
-				Name:  tea.String("DateExpired"),
-				Value: tea.String(string(*req.Period)),
-			})
-		}
-
-		values = append(values, dt.FormComponentValue{
-			Name:  tea.String("Comment"),
-			Value: tea.String(fmt.Sprintf("%s -来自API接口发起的策略申请", *req.Name)),
-		})
-		if req.Actions != nil {
-			var vString []string
-			for _, v := range req.Actions {
-				vString = append(vString, string(v))
-			}
-			values = append(values, dt.FormComponentValue{
-				Name:  tea.String("Actions"),
-				Value: tea.String(strings.Join(vString, ",")),
-			})
-		}
-
-		policyId, err := app.App.DBIo.CreatePolicy(req.ToPolicyMut())
-		if err != nil {
-			log.Errorf("JmsDBService.CreatePolicy error: %s", err)
-			c.JSON(500, err.Error())
-			return
-		}
-		// 再创建审批
-		processid, err := dingtalk.CreateApproval(*req.Applicant, values)
-		if err != nil {
-			log.Errorf("dingtalk.CreateApproval error: %s", err)
-			// 删除策略
-			if err := app.App.DBIo.DeletePolicy(policyId); err != nil {
-				log.Errorf("JmsDBService.DeletePolicy error: %s", err)
-			}
-			c.JSON(500, err.Error())
-			return
-		}
-		err = app.App.DBIo.UpdatePolicy(policyId, &PolicyRequest{
-			ApprovalID: &processid,
-		})
+	// 如果启用了外部审批，创建策略后发起审批
+	if approval.Enabled() {
+		policyId, processid, err := approval.Submit(*req.Applicant, req.ToPolicyMut())
 		if err != nil {
-			log.Errorf("JmsDBService.UpdatePolicy error: %s", err)
+			log.Errorf("approval.Submit error: %s", err)
 			c.JSON(500, err.Error())
 			return
 		}
+		log.Infof("create approval %s for policy %s", processid, policyId)
+		after, _ := app.App.DBIo.QueryPolicyById(policyId)
+		recordChange(c, ResourcePolicy, ChangeCreate, policyId, nil, after)
 		c.JSON(200, policyId)
 	} else {
-		policyId, err := app.App.DBIo.CreatePolicy(req.ToPolicyMut())
+		policyId, err := app.App.DBIo.WithAuthor(getUsername(c)).CreatePolicy(req.ToPolicyMut())
 		if err != nil {
 			c.JSON(500, err.Error())
 			return
 		}
+		after, _ := app.App.DBIo.QueryPolicyById(policyId)
+		recordChange(c, ResourcePolicy, ChangeCreate, policyId, nil, after)
 		c.String(200, policyId)
 	}
 }
 
 // @Summary 更新审批
-// @Description 更新审批结果，可以是同意或者拒绝
+// @Description 更新审批结果，可以是同意或者拒绝；有内置审批单的策略按审批流程处理，需要的审批人数够了才会启用
 // @Tags Approval
 // @Accept  json
 // @Produce  json
@@ -126,9 +77,109 @@ func updateApproval(c *gin.Context) {
 		c.JSON(400, err.Error())
 		return
 	}
-	if err := app.App.DBIo.UpdatePolicyStatus(id, *req); err != nil {
+	// 有内置审批单的走审批流程，校验审批人、自审批和需要的审批人数
+	if builtin, err := app.App.DBIo.GetApprovalByPolicy(id); err == nil {
+		decideBuiltinApproval(c, builtin, req)
+		return
+	}
+	before, err := app.App.DBIo.QueryPolicyById(id)
+	if err != nil {
 		c.JSON(500, err.Error())
 		return
 	}
+	if err := app.App.DBIo.WithAuthor(getUsername(c)).UpdatePolicyStatus(id, *req); err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	after, _ := app.App.DBIo.QueryPolicyById(id)
+	recordChange(c, ResourcePolicy, ChangeUpdate, id, before, after)
+	c.String(200, "success")
+}
+
+func decideBuiltinApproval(c *gin.Context, builtin *Approval, req *ApprovalResult) {
+	approver := getUsername(c)
+	if approver == "" {
+		approver = tea.StringValue(req.Applicant)
+	}
+	if approver == "" || req.IsPass == nil {
+		c.JSON(400, "applicant and is_pass are required")
+		return
+	}
+	after, err := app.App.DBIo.DecideApproval(builtin.ID, approver, *req.IsPass, "")
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	recordChange(c, ResourceApproval, ChangeUpdate, builtin.ID, builtin, after)
+	if after.Status != ApprovalPending {
+		go notify.Send(ApprovalNotification(after.ID, after.Applicant, ApplyComment(after.Justification, after.TicketID), after.Status, approver))
+	}
+	c.String(200, "success")
+}
+
+// @Summary 撤销外部审批
+// @Description 撤销策略在钉钉或者飞书上等待中的审批，撤销人需要配置对应的钉钉或者飞书 ID
+// @Tags Approval
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param id path string true "policy id"
+// @Param request body ApprovalCancelRequest true "request"
+// @Success 200 {string} success
+// @Failure 400 {string} string
+// @Router /api/v1/approval/:id/cancel [post]
+func cancelApproval(c *gin.Context) {
+	id := c.Param("id")
+	var req ApprovalCancelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	operator := getUsername(c)
+	if operator == "" {
+		operator = tea.StringValue(req.Operator)
+	}
+	before, err := app.App.DBIo.QueryPolicyById(id)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	if err := approval.Cancel(id, operator, tea.StringValue(req.Reason)); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	after, _ := app.App.DBIo.QueryPolicyById(id)
+	recordChange(c, ResourcePolicy, ChangeUpdate, id, before, after)
 	c.String(200, "success")
 }
+
+// @Summary 钉钉审批回调
+// @Description 钉钉事件订阅回调地址，校验签名并解密后，审批实例结束时立即同步策略状态，不需要登录
+// @Tags Approval
+// @Accept  json
+// @Produce  json
+// @Param signature query string false "签名，新版事件订阅为 msg_signature"
+// @Param timestamp query string true "时间戳"
+// @Param nonce query string true "随机串"
+// @Param request body DingtalkCallbackRequest true "request"
+// @Success 200 {object} map[string]string
+// @Failure 400 {string} string
+// @Router /api/v1/approval/callback/dingtalk [post]
+func dingtalkCallback(c *gin.Context) {
+	var req DingtalkCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	signature := c.Query("msg_signature")
+	if signature == "" {
+		signature = c.Query("signature")
+	}
+	resp, err := approval.DingtalkCallback(signature, c.Query("timestamp"), c.Query("nonce"), req.Encrypt)
+	if err != nil {
+		log.Warnf("dingtalk callback from %s error: %s", c.ClientIP(), err)
+		c.JSON(400, err.Error())
+		return
+	}
+	c.JSON(200, resp)
+}
@@ -0,0 +1,59 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/model"
+)
+
+func patchApproval(t *testing.T, r *gin.Engine, username, policyID string, pass bool) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(model.ApprovalResult{IsPass: tea.Bool(pass)})
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/approval/"+policyID, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+jwtToken(t, username))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// 有内置审批单的策略，PATCH 也要走审批流程
+func TestUpdateApproval_Builtin(t *testing.T) {
+	r := newTestRouter(t)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		_, err := app.App.DBIo.CreateUser(&model.UserRequest{Username: tea.String(name), Groups: model.ArrayString{"admin"}})
+		assert.NoError(t, err)
+	}
+	approval, err := app.App.DBIo.SubmitApproval(&model.ApprovalMut{
+		Users:         model.ArrayString{"alice"},
+		Applicant:     tea.String("alice"),
+		ServerFilter:  &model.ServerFilterV1{EnvType: []string{"prod"}},
+		Justification: tea.String("排查线上问题"),
+	}, model.WithApproval{Required: 2})
+	assert.NoError(t, err)
+
+	// 申请人不能自己审批
+	assert.Equal(t, 400, patchApproval(t, r, "alice", approval.PolicyID, true).Code)
+
+	assert.Equal(t, 200, patchApproval(t, r, "bob", approval.PolicyID, true).Code)
+	policy, err := app.App.DBIo.QueryPolicyById(approval.PolicyID)
+	assert.NoError(t, err)
+	assert.False(t, policy.IsEnabled)
+	assert.Equal(t, 400, patchApproval(t, r, "bob", approval.PolicyID, true).Code)
+
+	assert.Equal(t, 200, patchApproval(t, r, "carol", approval.PolicyID, true).Code)
+	policy, err = app.App.DBIo.QueryPolicyById(approval.PolicyID)
+	assert.NoError(t, err)
+	assert.True(t, policy.IsEnabled)
+	after, err := app.App.DBIo.GetApproval(approval.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ApprovalApproved, after.Status)
+}
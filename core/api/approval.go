@@ -0,0 +1,146 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/gin-gonic/gin"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/notify"
+	"github.com/xops-infra/jms/model"
+)
+
+// @Summary 提交权限申请
+// @Description 内置审批流程，不依赖钉钉。创建未启用的策略和审批单，按服务器 team 标签路由审批人，启用 withApiAuth 时申请人为登录用户
+// @Tags Approval
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param request body model.ApprovalMut true "request"
+// @Success 200 {object} model.Approval
+// @Failure 400 {string} string
+// @Router /api/v1/approval/request [post]
+func submitApproval(c *gin.Context) {
+	var req model.ApprovalMut
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	if username := getUsername(c); username != "" {
+		req.Applicant = tea.String(username)
+	}
+	if tea.StringValue(req.Justification) == "" {
+		c.JSON(400, "justification is required")
+		return
+	}
+	approval, err := app.App.DBIo.WithAuthor(tea.StringValue(req.Applicant)).SubmitApproval(&req, app.App.Config.WithApproval)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	recordChange(c, model.ResourceApproval, model.ChangeCreate, approval.ID, nil, approval)
+	go notify.Send(model.ApprovalNotification(approval.ID, approval.Applicant, model.ApplyComment(approval.Justification, approval.TicketID), approval.Status, ""))
+	c.JSON(200, approval)
+}
+
+// @Summary 审批单列表
+// @Description 默认查询待审批的申请，mine=true 只返回当前用户可以审批的
+// @Tags Approval
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param status query string false "pending,approved,rejected，默认 pending，all 查询所有"
+// @Param mine query bool false "only approvals current user can approve"
+// @Success 200 {object} []model.Approval
+// @Failure 500 {string} string
+// @Router /api/v1/approval/request [get]
+func listApprovalRequest(c *gin.Context) {
+	status := c.DefaultQuery("status", string(model.ApprovalPending))
+	if status == "all" {
+		status = ""
+	}
+	approvals, err := app.App.DBIo.ListApproval(status)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	if c.Query("mine") != "true" {
+		c.JSON(200, approvals)
+		return
+	}
+	user, err := app.App.DBIo.DescribeUser(getUsername(c))
+	if err != nil {
+		c.JSON(400, fmt.Sprintf("user %s not found: %s", getUsername(c), err))
+		return
+	}
+	res := []model.Approval{}
+	for _, approval := range approvals {
+		if approval.CanApprove(user) == nil {
+			res = append(res, approval)
+		}
+	}
+	c.JSON(200, res)
+}
+
+// @Summary 查询审批单
+// @Description 查询审批单以及审批记录
+// @Tags Approval
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param id path string true "approval id"
+// @Success 200 {object} model.Approval
+// @Failure 400 {string} string
+// @Router /api/v1/approval/request/:id [get]
+func getApprovalRequest(c *gin.Context) {
+	approval, err := app.App.DBIo.GetApproval(c.Param("id"))
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	c.JSON(200, approval)
+}
+
+// @Summary 审批
+// @Description 同意或者拒绝并填写意见，有人拒绝即拒绝，同意人数达到要求后启用策略
+// @Tags Approval
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param id path string true "approval id"
+// @Param request body model.ApprovalDecisionRequest true "request"
+// @Success 200 {object} model.Approval
+// @Failure 400 {string} string
+// @Router /api/v1/approval/request/:id/decision [post]
+func decideApprovalRequest(c *gin.Context) {
+	id := c.Param("id")
+	var req model.ApprovalDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	approver := getUsername(c)
+	if approver == "" {
+		approver = tea.StringValue(req.Approver)
+	}
+	if approver == "" {
+		c.JSON(400, "approver is empty")
+		return
+	}
+	before, err := app.App.DBIo.GetApproval(id)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	after, err := app.App.DBIo.DecideApproval(id, approver, *req.Approve, tea.StringValue(req.Comment))
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	recordChange(c, model.ResourceApproval, model.ChangeUpdate, id, before, after)
+	if after.Status != model.ApprovalPending {
+		go notify.Send(model.ApprovalNotification(after.ID, after.Applicant, model.ApplyComment(after.Justification, after.TicketID), after.Status, approver))
+	}
+	c.JSON(200, after)
+}
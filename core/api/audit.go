@@ -71,3 +71,69 @@ func listScpAudit(c *gin.Context) {
 	c.JSON(200, records)
 
 }
+
+// @Summary listApiDenyAudit
+// @Description 管理接口越权访问审计查询，支持查询用户、路径、时间范围的记录
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Param duration query int false "duration hours 24 = 1 day, 默认查 1 天的记录"
+// @Param user query string false "user"
+// @Param path query string false "path"
+// @Success 200 {object} []model.ApiDenyRecord
+// @Router /api/v1/audit/deny [get]
+func listApiDenyAudit(c *gin.Context) {
+	req := model.QueryApiDenyRequest{}
+	if c.Query("duration") != "" {
+		req.Duration = tea.Int(cast.ToInt(c.Query("duration")))
+	}
+	if c.Query("user") != "" {
+		req.User = tea.String(c.Query("user"))
+	}
+	if c.Query("path") != "" {
+		req.Path = tea.String(c.Query("path"))
+	}
+	records, err := app.App.DBIo.ListApiDenyRecord(req)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	c.JSON(200, records)
+}
+
+// @Summary listApiChangeAudit
+// @Description 管理接口变更审计查询，支持操作人、动作、资源类型、资源ID、时间范围过滤，敏感字段已脱敏
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Param duration query int false "duration hours 24 = 1 day, 默认查 1 天的记录"
+// @Param actor query string false "actor"
+// @Param action query string false "create,update,delete"
+// @Param resource query string false "policy,user,key,profile,proxy,shell_task,broadcast,role,token"
+// @Param resource_id query string false "resource id"
+// @Success 200 {object} []model.ApiChangeRecord
+// @Router /api/v1/audit/change [get]
+func listApiChangeAudit(c *gin.Context) {
+	req := model.QueryApiChangeRequest{}
+	if c.Query("duration") != "" {
+		req.Duration = tea.Int(cast.ToInt(c.Query("duration")))
+	}
+	if c.Query("actor") != "" {
+		req.Actor = tea.String(c.Query("actor"))
+	}
+	if c.Query("action") != "" {
+		req.Action = tea.String(c.Query("action"))
+	}
+	if c.Query("resource") != "" {
+		req.Resource = tea.String(c.Query("resource"))
+	}
+	if c.Query("resource_id") != "" {
+		req.ResourceID = tea.String(c.Query("resource_id"))
+	}
+	records, err := app.App.DBIo.ListApiChangeRecord(req)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	c.JSON(200, records)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/gin-gonic/gin"
+	"github.com/xops-infra/ginx/middleware"
+	hh "github.com/xops-infra/http-headers"
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/siem"
+	"github.com/xops-infra/jms/model"
+)
+
+const (
+	// token 中解析出的用户名，和 ginx auth 中间件保持一致
+	ctxUsername = "username"
+	// 个人访问令牌限定的角色
+	ctxTokenScopes = "token_scopes"
+)
+
+// 不需要认证的路径，前缀匹配
+var authIgnorePaths = []string{"/ping", "/swagger", "/metrics", "/api/v1/login", "/api/v1/approval/callback"}
+
+// authRequired 支持 jwt 和个人访问令牌两种认证方式
+func authRequired(secret []byte) gin.HandlerFunc {
+	jwtAuth := middleware.TokenAuthMiddleware(authIgnorePaths, secret)
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader(hh.Authorization), "Bearer ")
+		if !strings.HasPrefix(token, model.ApiTokenPrefix) || isAuthIgnored(c.Request.URL.Path) {
+			jwtAuth(c)
+			return
+		}
+		apiToken, err := app.App.DBIo.AuthApiToken(token, c.ClientIP())
+		if err != nil {
+			log.Warnf("api token auth failed, client: %s, %s", c.ClientIP(), err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, err.Error())
+			return
+		}
+		c.Set(ctxUsername, apiToken.User)
+		c.Set(ctxTokenScopes, apiToken.GetScopes())
+		c.Next()
+	}
+}
+
+func isAuthIgnored(path string) bool {
+	for _, ignore := range authIgnorePaths {
+		if strings.HasPrefix(path, ignore) {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取调用者用户名，未启用认证时为空
+func getUsername(c *gin.Context) string {
+	return c.GetString(ctxUsername)
+}
+
+// 获取调用者角色，个人访问令牌会限定角色范围
+func getRoles(c *gin.Context) (model.Roles, error) {
+	roles, err := app.App.DBIo.GetUserRoles(getUsername(c))
+	if err != nil {
+		return nil, err
+	}
+	if scopes, ok := c.Get(ctxTokenScopes); ok {
+		roles = roles.Scope(scopes.(model.Roles))
+	}
+	return roles, nil
+}
+
+func isAdmin(c *gin.Context) bool {
+	roles, err := getRoles(c)
+	if err != nil {
+		log.Errorf("get user %s roles error: %s", getUsername(c), err)
+		return false
+	}
+	return roles.Has(model.RoleAdmin)
+}
+
+// requireRoles 校验调用者是否拥有任一角色，admin 默认拥有所有角色
+// 未启用接口认证时不做校验
+func requireRoles(roles ...model.Role) gin.HandlerFunc {
+	var required []string
+	for _, role := range roles {
+		required = append(required, string(role))
+	}
+	if len(required) == 0 {
+		required = append(required, string(model.RoleAdmin))
+	}
+	return func(c *gin.Context) {
+		if !app.App.Config.WithApiAuth.Enable {
+			c.Next()
+			return
+		}
+		username := getUsername(c)
+		userRoles, err := getRoles(c)
+		if err != nil {
+			log.Errorf("get user %s roles error: %s", username, err)
+		}
+		if userRoles.Has(roles...) {
+			c.Next()
+			return
+		}
+
+		log.Warnf("user %s deny %s %s, required roles: %v", username, c.Request.Method, c.Request.URL.Path, required)
+		e := model.NewAuditEvent(model.AuditDenied, "api", model.AuditFailure, username, c.ClientIP())
+		e.Message = fmt.Sprintf("%s %s required roles: %s", c.Request.Method, c.Request.URL.Path, strings.Join(required, ","))
+		siem.Emit(e)
+		err = app.App.DBIo.AddApiDenyRecord(&model.AddApiDenyRecordRequest{
+			User:     tea.String(username),
+			Client:   tea.String(c.ClientIP()),
+			Method:   tea.String(c.Request.Method),
+			Path:     tea.String(c.Request.URL.Path),
+			Required: tea.String(strings.Join(required, ",")),
+		})
+		if err != nil {
+			log.Errorf("record api deny error: %s", err)
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, fmt.Sprintf("user %s has no permission, required roles: %s", username, strings.Join(required, ",")))
+	}
+}
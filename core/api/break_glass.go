@@ -0,0 +1,87 @@
+package api
+
+import (
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/gin-gonic/gin"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/model"
+)
+
+// @Summary 紧急访问复盘列表
+// @Description 紧急访问(break-glass)开通后都需要管理员复盘关闭，默认查询待复盘的
+// @Tags BreakGlass
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param status query string false "open,closed，默认 open，all 查询所有"
+// @Success 200 {object} []model.BreakGlass
+// @Failure 500 {string} string
+// @Router /api/v1/breakglass [get]
+func listBreakGlass(c *gin.Context) {
+	status := c.DefaultQuery("status", string(model.BreakGlassOpen))
+	if status == "all" {
+		status = ""
+	}
+	list, err := app.App.DBIo.ListBreakGlass(status)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	c.JSON(200, list)
+}
+
+// @Summary 查询紧急访问记录
+// @Description 包括理由、会话录像文件和复盘结论
+// @Tags BreakGlass
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param id path string true "break glass id"
+// @Success 200 {object} model.BreakGlass
+// @Failure 400 {string} string
+// @Router /api/v1/breakglass/:id [get]
+func getBreakGlass(c *gin.Context) {
+	breakGlass, err := app.App.DBIo.GetBreakGlass(c.Param("id"))
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	c.JSON(200, breakGlass)
+}
+
+// @Summary 复盘关闭紧急访问
+// @Description 填写复盘结论后关闭，不能复盘自己的紧急访问
+// @Tags BreakGlass
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param id path string true "break glass id"
+// @Param request body model.BreakGlassReviewRequest true "request"
+// @Success 200 {object} model.BreakGlass
+// @Failure 400 {string} string
+// @Router /api/v1/breakglass/:id/review [post]
+func reviewBreakGlass(c *gin.Context) {
+	id := c.Param("id")
+	var req model.BreakGlassReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	before, err := app.App.DBIo.GetBreakGlass(id)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	reviewer := getUsername(c)
+	if reviewer == "" {
+		reviewer = tea.StringValue(req.Reviewer)
+	}
+	after, err := app.App.DBIo.ReviewBreakGlass(id, reviewer, tea.StringValue(req.Comment))
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	recordChange(c, model.ResourceBreakGlass, model.ChangeUpdate, id, before, after)
+	c.JSON(200, after)
+}
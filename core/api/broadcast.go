@@ -23,5 +23,6 @@ func broadcast(c *gin.Context) {
 		c.JSON(500, err)
 		return
 	}
+	recordChange(c, model.ResourceBroadcast, model.ChangeCreate, "", nil, req)
 	c.String(200, "ok")
 }
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/gin-gonic/gin"
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/model"
+)
+
+// recordChange 记录管理接口的变更，before/after 为变更前后的资源，入库前会脱敏
+// 记录失败不影响接口返回
+func recordChange(c *gin.Context, resource string, action model.ChangeAction, resourceID string, before, after interface{}) {
+	actor := getUsername(c)
+	if actor == "" {
+		actor = "anonymous"
+	}
+	err := app.App.DBIo.AddApiChangeRecord(&model.AddApiChangeRequest{
+		Actor:      tea.String(actor),
+		Client:     tea.String(c.ClientIP()),
+		Action:     &action,
+		Resource:   tea.String(resource),
+		ResourceID: tea.String(resourceID),
+		Before:     before,
+		After:      after,
+	})
+	if err != nil {
+		log.Errorf("record api change %s %s %s error: %s", action, resource, resourceID, err)
+	}
+}
@@ -48,6 +48,8 @@ func addKey(c *gin.Context) {
 		c.JSON(500, err.Error())
 		return
 	}
+	after, _ := app.App.DBIo.GetKey(id)
+	recordChange(c, ResourceKey, ChangeCreate, id, nil, after)
 	c.String(200, id)
 }
 
@@ -65,9 +67,15 @@ func deleteKey(c *gin.Context) {
 		c.JSON(400, fmt.Errorf("uuid is empty"))
 		return
 	}
+	before, err := app.App.DBIo.GetKey(id)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
 	if err := app.App.DBIo.DeleteKey(id); err != nil {
 		c.JSON(500, err.Error())
 		return
 	}
+	recordChange(c, ResourceKey, ChangeDelete, id, before, nil)
 	c.String(200, "success")
 }
@@ -1,6 +1,18 @@
 package api
 
-import "github.com/gin-gonic/gin"
+import (
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/notify"
+	"github.com/xops-infra/jms/core/siem"
+	"github.com/xops-infra/jms/model"
+)
 
 // @Summary 登录
 // @Description 登录接口可以换token使用。
@@ -9,7 +21,59 @@ import "github.com/gin-gonic/gin"
 // @Produce  json
 // @Param user formData string true "用户名"
 // @Param password formData string true "密码"
+// @Success 200 {object} model.LoginResponse
+// @Failure 401 {string} error
 // @Router /api/v1/login [post]
 func login(c *gin.Context) {
+	if !app.App.Config.WithApiAuth.Enable {
+		c.JSON(400, "api auth not enable, check withApiAuth config")
+		return
+	}
+	user := c.PostForm("user")
+	password := c.PostForm("password")
+	if user == "" || password == "" {
+		c.JSON(400, "user and password is required")
+		return
+	}
+	err := authenticate(user, password)
+	siem.Emit(siem.AuthEvent("api", user, c.ClientIP(), err))
+	if err != nil {
+		log.Warnf("api login failed user: %s, client: %s, %s", user, c.ClientIP(), err)
+		notify.AuthFailure("api", user, c.ClientIP(), err)
+		c.JSON(401, "invalid user or password")
+		return
+	}
+
+	expires := 24
+	if app.App.Config.WithApiAuth.Expires > 0 {
+		expires = app.App.Config.WithApiAuth.Expires
+	}
+	expiresAt := time.Now().Add(time.Duration(expires) * time.Hour)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": user,
+		"exp":      expiresAt.Unix(),
+	}).SignedString([]byte(app.App.Config.WithApiAuth.Secret))
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	c.JSON(200, model.LoginResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
 
+// 和 sshd 登录保持一致，优先 ldap，其次数据库用户
+func authenticate(user, password string) error {
+	if app.App.Config.WithLdap.Enable {
+		return app.App.Sshd.Ldap.Login(user, password)
+	}
+	allow, err := app.App.DBIo.Login(user, password)
+	if err != nil {
+		return err
+	}
+	if !allow {
+		return fmt.Errorf("password not match")
+	}
+	return nil
 }
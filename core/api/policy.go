@@ -2,7 +2,9 @@ package api
 
 import (
 	"fmt"
+	"strconv"
 
+	"github.com/alibabacloud-go/tea/tea"
 	"github.com/gin-gonic/gin"
 	"github.com/xops-infra/jms/app"
 	"github.com/xops-infra/jms/model"
@@ -17,12 +19,13 @@ import (
 // @Param name query string false "name"
 // @Param id query string false "policy id"
 // @Param user query string false "user"
+// @Param group query string false "group"
 // @Success 200 {object} []Policy
 // @Failure 500 {string} string
 // @Router /api/v1/policy [get]
 func listPolicy(c *gin.Context) {
 	user := c.Query("user")
-	// group := c.Query("group")
+	group := c.Query("group")
 	name := c.Query("name")
 	id := c.Query("id")
 	if user != "" {
@@ -34,6 +37,15 @@ func listPolicy(c *gin.Context) {
 		c.JSON(200, policies)
 		return
 	}
+	if group != "" {
+		policies, err := app.App.DBIo.QueryPolicyByGroup(group)
+		if err != nil {
+			c.JSON(500, err.Error())
+			return
+		}
+		c.JSON(200, policies)
+		return
+	}
 	if name != "" {
 		policies, err := app.App.DBIo.QueryPolicyByName(name)
 		if err != nil {
@@ -84,10 +96,17 @@ func updatePolicy(c *gin.Context) {
 		c.JSON(400, err.Error())
 		return
 	}
-	if err := app.App.DBIo.UpdatePolicy(id, req); err != nil {
+	before, err := app.App.DBIo.QueryPolicyById(id)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	if err := app.App.DBIo.WithAuthor(getUsername(c)).UpdatePolicy(id, req); err != nil {
 		c.JSON(500, err.Error())
 		return
 	}
+	after, _ := app.App.DBIo.QueryPolicyById(id)
+	recordChange(c, model.ResourcePolicy, model.ChangeUpdate, id, before, after)
 	c.String(200, "success")
 }
 
@@ -106,34 +125,181 @@ func deletePolicy(c *gin.Context) {
 		c.JSON(400, fmt.Errorf("id is empty"))
 		return
 	}
-	if err := app.App.DBIo.DeletePolicy(id); err != nil {
+	before, err := app.App.DBIo.QueryPolicyById(id)
+	if err != nil {
 		c.JSON(500, err.Error())
 		return
 	}
+	if err := app.App.DBIo.WithAuthor(getUsername(c)).DeletePolicy(id); err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	recordChange(c, model.ResourcePolicy, model.ChangeDelete, id, before, nil)
 	c.String(200, "success")
 }
 
-type PolicyCheckRequest struct {
-	UserName string       `json:"username"`
-	Action   model.Action `json:"action"`
-	ServerIp string       `json:"serverip"`
-}
-
 // @Summary 权限校验
-// @Description 权限校验，提供用户名可以查询该用户拥有的权限
+// @Description 校验用户对服务器的动作是否有权限，并返回命中的系统规则、允许或者拒绝的策略以及跳过的失效策略
 // @Tags Policy
 // @Accept  json
 // @Produce  json
 // @Param Authorization header string false "token"
-// @Param request body PolicyCheckRequest true "request"
-// @Success 200 {object} []Policy
+// @Param request body model.PolicyCheckRequest true "request"
+// @Success 200 {object} model.PolicyExplain
+// @Failure 400 {string} string
 // @Failure 500 {string} string
 // @Router /api/v1/policy/permission [post]
 func checkPolicyIsOk(c *gin.Context) {
-	var req *PolicyCheckRequest
+	var req model.PolicyCheckRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, err.Error())
 		return
 	}
+	if app.App.Sshd.SshdIO == nil {
+		c.JSON(500, "db is not enable, check withDB config")
+		return
+	}
+	user, err := app.App.DBIo.DescribeUser(*req.UserName)
+	if err != nil {
+		c.JSON(400, fmt.Sprintf("user %s not found: %s", *req.UserName, err))
+		return
+	}
+	server, err := app.App.DBIo.FindServer(*req.Server)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	// 包含未启用的策略，用于展示跳过原因
+	policies, err := app.App.DBIo.QueryPolicyByUser(*req.UserName)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	c.JSON(200, app.App.Sshd.SshdIO.ExplainPolicy(user, *req.Action, *server, policies, false, tea.StringValue(req.Client)))
+}
+
+// @Summary 策略版本列表
+// @Description 策略每次变更都会保存一个版本，包含操作人、时间和完整快照，按版本号倒序
+// @Tags Policy
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param id path string true "policy id"
+// @Success 200 {object} []model.PolicyRevision
+// @Failure 500 {string} string
+// @Router /api/v1/policy/:id/revision [get]
+func listPolicyRevision(c *gin.Context) {
+	revisions, err := app.App.DBIo.ListPolicyRevision(c.Param("id"))
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	c.JSON(200, revisions)
+}
+
+// @Summary 查询策略版本
+// @Description 查询策略的某个版本
+// @Tags Policy
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param id path string true "policy id"
+// @Param revision path int true "revision"
+// @Success 200 {object} model.PolicyRevision
+// @Failure 400 {string} string
+// @Router /api/v1/policy/:id/revision/:revision [get]
+func getPolicyRevision(c *gin.Context) {
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(400, fmt.Sprintf("revision %s invalid", c.Param("revision")))
+		return
+	}
+	rev, err := app.App.DBIo.QueryPolicyRevision(c.Param("id"), revision)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	c.JSON(200, rev)
+}
+
+// @Summary 对比策略版本
+// @Description 对比策略两个版本之间有变化的字段
+// @Tags Policy
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param id path string true "policy id"
+// @Param from query int true "from revision"
+// @Param to query int true "to revision"
+// @Success 200 {object} model.PolicyRevisionDiff
+// @Failure 400 {string} string
+// @Router /api/v1/policy/:id/revision/diff [get]
+func diffPolicyRevision(c *gin.Context) {
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		c.JSON(400, fmt.Sprintf("from %s invalid", c.Query("from")))
+		return
+	}
+	to, err := strconv.Atoi(c.Query("to"))
+	if err != nil {
+		c.JSON(400, fmt.Sprintf("to %s invalid", c.Query("to")))
+		return
+	}
+	diff, err := app.App.DBIo.DiffPolicyRevision(c.Param("id"), from, to)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	c.JSON(200, diff)
+}
+
+// @Summary 恢复策略版本
+// @Description 用历史版本覆盖当前策略，恢复会记录为新的版本并写入变更审计
+// @Tags Policy
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param id path string true "policy id"
+// @Param revision path int true "revision"
+// @Success 200 {string} success
+// @Failure 400 {string} string
+// @Failure 500 {string} string
+// @Router /api/v1/policy/:id/revision/:revision/restore [post]
+func restorePolicyRevision(c *gin.Context) {
+	id := c.Param("id")
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(400, fmt.Sprintf("revision %s invalid", c.Param("revision")))
+		return
+	}
+	before, err := app.App.DBIo.QueryPolicyById(id)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	if err := app.App.DBIo.WithAuthor(getUsername(c)).RestorePolicyRevision(id, revision); err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	after, _ := app.App.DBIo.QueryPolicyById(id)
+	recordChange(c, model.ResourcePolicy, model.ChangeRestore, id, before, after)
 	c.String(200, "success")
 }
+
+// @Summary 策略检查
+// @Description 检查所有策略，报告空的过滤条件、匹配不到服务器、过期仍启用、拒绝策略覆盖允许策略以及重复授权
+// @Tags Policy
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Success 200 {object} model.LintReport
+// @Failure 500 {string} string
+// @Router /api/v1/policy/lint [get]
+func lintPolicy(c *gin.Context) {
+	report, err := app.App.DBIo.LintPolicies()
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	c.JSON(200, report)
+}
@@ -45,6 +45,8 @@ func createProfile(c *gin.Context) {
 		c.JSON(500, err.Error())
 		return
 	}
+	after, _ := app.App.DBIo.GetProfile(id)
+	recordChange(c, model.ResourceProfile, model.ChangeCreate, id, nil, after)
 	c.String(200, id)
 }
 
@@ -69,12 +71,19 @@ func updateProfile(c *gin.Context) {
 		c.JSON(400, "uuid is required")
 		return
 	}
-	err := app.App.DBIo.UpdateProfile(uuid, req)
+	before, err := app.App.DBIo.GetProfile(uuid)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	err = app.App.DBIo.UpdateProfile(uuid, req)
 	if err != nil {
 		log.Errorf("update profile error: %v", err)
 		c.JSON(500, err.Error())
 		return
 	}
+	after, _ := app.App.DBIo.GetProfile(uuid)
+	recordChange(c, model.ResourceProfile, model.ChangeUpdate, uuid, before, after)
 	c.String(200, "success")
 }
 
@@ -93,11 +102,17 @@ func deleteProfile(c *gin.Context) {
 		c.JSON(400, "uuid is required")
 		return
 	}
-	err := app.App.DBIo.DeleteProfile(uuid)
+	before, err := app.App.DBIo.GetProfile(uuid)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	err = app.App.DBIo.DeleteProfile(uuid)
 	if err != nil {
 		log.Errorf("delete profile error: %v", err)
 		c.JSON(500, err.Error())
 		return
 	}
+	recordChange(c, model.ResourceProfile, model.ChangeDelete, uuid, before, nil)
 	c.String(200, "success")
 }
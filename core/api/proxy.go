@@ -39,6 +39,7 @@ func addProxy(c *gin.Context) {
 		c.JSON(500, err.Error())
 		return
 	}
+	recordChange(c, model.ResourceProxy, model.ChangeCreate, id.UUID, nil, id)
 	c.JSON(200, id)
 }
 
@@ -56,11 +57,17 @@ func updateProxy(c *gin.Context) {
 		c.JSON(400, err.Error())
 		return
 	}
+	before, err := app.App.DBIo.GetProxy(c.Param("uuid"))
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
 	id, err := app.App.DBIo.UpdateProxy(c.Param("uuid"), req)
 	if err != nil {
 		c.JSON(500, err.Error())
 		return
 	}
+	recordChange(c, model.ResourceProxy, model.ChangeUpdate, c.Param("uuid"), before, id)
 	c.JSON(200, id)
 }
 
@@ -73,10 +80,16 @@ func updateProxy(c *gin.Context) {
 // @Router /api/v1/proxy/:uuid [delete]
 func deleteProxy(c *gin.Context) {
 
-	err := app.App.DBIo.DeleteProxy(c.Param("uuid"))
+	before, err := app.App.DBIo.GetProxy(c.Param("uuid"))
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	err = app.App.DBIo.DeleteProxy(c.Param("uuid"))
 	if err != nil {
 		c.JSON(500, err.Error())
 		return
 	}
+	recordChange(c, model.ResourceProxy, model.ChangeDelete, c.Param("uuid"), before, nil)
 	c.String(200, "success")
 }
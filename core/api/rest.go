@@ -7,7 +7,9 @@ import (
 	"github.com/xops-infra/ginx/middleware"
 	hh "github.com/xops-infra/http-headers"
 
+	"github.com/xops-infra/jms/app"
 	_ "github.com/xops-infra/jms/docs"
+	"github.com/xops-infra/jms/model"
 )
 
 func NewGin() *gin.Engine {
@@ -20,6 +22,9 @@ func NewGin() *gin.Engine {
 		WithRequestID(hh.XRequestID).
 		WithSecurity().
 		WithMetrics()
+	if app.App.Config.WithApiAuth.Enable {
+		r.Use(authRequired([]byte(app.App.Config.WithApiAuth.Secret)))
+	}
 	// add swagger
 	r.GET("/swagger/*any", func(c *gin.Context) {
 		c.Next()
@@ -35,52 +40,93 @@ func NewGin() *gin.Engine {
 	api := r.Group("/api/v1")
 	api.POST("/login", login)
 
-	api.POST("/broadcast", broadcast)
+	api.POST("/broadcast", requireRoles(model.RoleAdmin), broadcast)
 
-	u := api.Group("/user")
+	u := api.Group("/user", requireRoles(model.RoleAdmin))
 	u.GET("", listUser)
 	u.POST("", addUser)
 	u.PATCH("/:id", updateUserGroup)
 	u.PUT("/:id", updateUser)
 
-	p := api.Group("/policy")
+	token := api.Group("/token")
+	token.GET("", listApiToken)
+	token.POST("", createApiToken)
+	token.DELETE("/:uuid", deleteApiToken)
+
+	role := api.Group("/role", requireRoles(model.RoleAdmin))
+	role.GET("", listRoleBinding)
+	role.POST("", addRoleBinding)
+	role.DELETE("/:uuid", deleteRoleBinding)
+
+	p := api.Group("/policy", requireRoles(model.RoleAdmin))
 	p.GET("", listPolicy)
 	p.PUT("/:id", updatePolicy)
 	p.DELETE("/:id", deletePolicy)
-
-	a := api.Group("/approval")
+	p.POST("/permission", checkPolicyIsOk)
+	p.GET("/lint", lintPolicy)
+	p.GET("/:id/revision", listPolicyRevision)
+	p.GET("/:id/revision/diff", diffPolicyRevision)
+	p.GET("/:id/revision/:revision", getPolicyRevision)
+	p.POST("/:id/revision/:revision/restore", restorePolicyRevision)
+
+	// 任意用户都可以提交申请
+	api.POST("/approval/request", submitApproval)
+	// 钉钉事件订阅回调，通过签名校验
+	api.POST("/approval/callback/dingtalk", dingtalkCallback)
+
+	a := api.Group("/approval", requireRoles(model.RoleApprover))
 	a.POST("", createApproval)
 	a.PATCH("/:id", updateApproval)
-
-	k := api.Group("/key")
+	a.POST("/:id/cancel", cancelApproval)
+	a.GET("/request", listApprovalRequest)
+	a.GET("/request/:id", getApprovalRequest)
+	a.POST("/request/:id/decision", decideApprovalRequest)
+
+	bg := api.Group("/breakglass", requireRoles(model.RoleAdmin))
+	bg.GET("", listBreakGlass)
+	bg.GET("/:id", getBreakGlass)
+	bg.POST("/:id/review", reviewBreakGlass)
+
+	srv := api.Group("/server", requireRoles(model.RoleAdmin))
+	srv.GET("", listServer)
+	srv.POST("", createServer)
+	srv.GET("/:id", getServer)
+	srv.PUT("/:id", updateServer)
+	srv.DELETE("/:id", deleteServer)
+	srv.PUT("/:id/credentials", setServerCredential)
+
+	k := api.Group("/key", requireRoles(model.RoleAdmin))
 	k.GET("", listKey)
 	k.POST("", addKey)
 	k.DELETE("/:uuid", deleteKey)
 
-	profile := api.Group("/profile")
+	profile := api.Group("/profile", requireRoles(model.RoleAdmin))
 	profile.GET("", listProfile)
 	profile.POST("", createProfile)
 	profile.PUT(":uuid", updateProfile)
 	profile.DELETE(":uuid", deleteProfile)
 
-	proxy := api.Group("/proxy")
+	proxy := api.Group("/proxy", requireRoles(model.RoleAdmin))
 	proxy.GET("", listProxy)
 	proxy.POST("", addProxy)
 	proxy.PUT("/:uuid", updateProxy)
 	proxy.DELETE("/:uuid", deleteProxy)
 
-	shell := api.Group("/shell/task")
+	shell := api.Group("/shell/task", requireRoles(model.RoleOperator))
 	shell.GET("", listShellTask)
 	shell.POST("", addShellTask)
 	shell.PUT("/:uuid", updateShellTask)
 	shell.DELETE("/:uuid", deleteShellTask)
 
-	shellRecord := api.Group("/shell/record")
+	shellRecord := api.Group("/shell/record", requireRoles(model.RoleOperator))
 	shellRecord.GET("", listShellRecord)
 
-	audits := api.Group("/audit")
+	audits := api.Group("/audit", requireRoles(model.RoleAuditor))
 	audits.GET("/login", listLoginAudit)
 	audits.GET("/scp", listScpAudit)
+	audits.GET("/deny", listApiDenyAudit)
+	audits.GET("/change", listApiChangeAudit)
+	audits.GET("/access", accessReport)
 
 	return r
 }
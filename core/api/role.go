@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/model"
+)
+
+// @Summary 角色授权列表
+// @Description 列出所有角色授权，subject 为 user:用户名 或 group:用户组
+// @Tags Role
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Success 200 {object} []model.RoleBinding
+// @Router /api/v1/role [get]
+func listRoleBinding(c *gin.Context) {
+	bindings, err := app.App.DBIo.ListRoleBinding()
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	c.JSON(200, bindings)
+}
+
+// @Summary 授予角色
+// @Description 授予用户或者用户组角色，支持 admin, auditor, operator, approver
+// @Tags Role
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param request body model.RoleBindingRequest true "request"
+// @Success 200 {string} id
+// @Router /api/v1/role [post]
+func addRoleBinding(c *gin.Context) {
+	var req model.RoleBindingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	id, err := app.App.DBIo.CreateRoleBinding(req)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	after, _ := app.App.DBIo.GetRoleBinding(id)
+	recordChange(c, model.ResourceRole, model.ChangeCreate, id, nil, after)
+	c.String(200, id)
+}
+
+// @Summary 取消角色授权
+// @Tags Role
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param uuid path string true "role binding uuid"
+// @Success 200 {string} success
+// @Router /api/v1/role/:uuid [delete]
+func deleteRoleBinding(c *gin.Context) {
+	id := c.Param("uuid")
+	if id == "" {
+		c.JSON(400, fmt.Errorf("uuid is empty"))
+		return
+	}
+	before, err := app.App.DBIo.GetRoleBinding(id)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	if err := app.App.DBIo.DeleteRoleBinding(id); err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	recordChange(c, model.ResourceRole, model.ChangeDelete, id, before, nil)
+	c.String(200, "success")
+}
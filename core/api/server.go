@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/model"
+)
+
+// @Summary 服务器列表
+// @Description 包括云同步、localServers 配置和手动添加的服务器，过滤条件和策略的 ServerFilterV1 一致(支持 *、!、~正则、CIDR)
+// @Description 多个值用逗号分隔，复杂条件(tags,all,any)通过 filter 传 json
+// @Tags server
+// @Accept json
+// @Produce json
+// @Param name query string false "name"
+// @Param ip_addr query string false "ip_addr"
+// @Param env_type query string false "env_type"
+// @Param team query string false "team"
+// @Param filter query string false "ServerFilterV1 json"
+// @Param page query int false "page, 默认 1"
+// @Param size query int false "size, 默认 20，最大 500"
+// @Success 200 {object} model.ServerListResponse
+// @Router /api/v1/server [get]
+func listServer(c *gin.Context) {
+	filter, err := serverFilterFromQuery(c)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	servers, err := app.App.DBIo.LoadServer()
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	servers = model.FilterServers(servers, filter)
+	c.JSON(200, model.PageServers(servers, cast.ToInt(c.Query("page")), cast.ToInt(c.Query("size"))))
+}
+
+func serverFilterFromQuery(c *gin.Context) (model.ServerFilterV1, error) {
+	var filter model.ServerFilterV1
+	if c.Query("filter") != "" {
+		if err := json.Unmarshal([]byte(c.Query("filter")), &filter); err != nil {
+			return filter, fmt.Errorf("filter invalid: %s", err)
+		}
+	}
+	for key, values := range map[string]*[]string{
+		"name":     &filter.Name,
+		"ip_addr":  &filter.IpAddr,
+		"env_type": &filter.EnvType,
+		"team":     &filter.Team,
+	} {
+		for _, value := range c.QueryArray(key) {
+			for _, v := range strings.Split(value, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					*values = append(*values, v)
+				}
+			}
+		}
+	}
+	return filter, filter.Validate()
+}
+
+// @Summary 查询服务器
+// @Description 依据 ID 查询，和修改、删除以及设置账号密码接口一致，按 IP 或者名称查询使用列表接口的过滤条件
+// @Tags server
+// @Accept json
+// @Produce json
+// @Param id path string true "server id"
+// @Success 200 {object} model.ServerInfo
+// @Router /api/v1/server/{id} [get]
+func getServer(c *gin.Context) {
+	server, err := app.App.DBIo.GetServer(c.Param("id"))
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	c.JSON(200, server.ToInfo())
+}
+
+// @Summary 手动添加服务器
+// @Description 添加云同步之外的服务器，云同步不会删除和覆盖
+// @Tags server
+// @Accept json
+// @Produce json
+// @Param body body model.CreateServerRequest true "server"
+// @Success 200 {object} model.ServerInfo
+// @Router /api/v1/server [post]
+func createServer(c *gin.Context) {
+	var req model.CreateServerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	server, err := req.ToServer()
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	if err := app.App.DBIo.CreateManualServer(server); err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	recordChange(c, model.ResourceServer, model.ChangeCreate, server.ID, nil, server.ToInfo())
+	c.JSON(200, server.ToInfo())
+}
+
+// @Summary 修改手动添加的服务器
+// @Description 只能修改手动添加的服务器，账号密码通过 credentials 接口修改
+// @Tags server
+// @Accept json
+// @Produce json
+// @Param id path string true "server id"
+// @Param body body model.UpdateServerRequest true "server"
+// @Success 200 {object} model.ServerInfo
+// @Router /api/v1/server/{id} [put]
+func updateServer(c *gin.Context) {
+	var req model.UpdateServerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	before, err := app.App.DBIo.GetServer(c.Param("id"))
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	server, err := app.App.DBIo.UpdateManualServer(c.Param("id"), req)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	recordChange(c, model.ResourceServer, model.ChangeUpdate, server.ID, before.ToInfo(), server.ToInfo())
+	c.JSON(200, server.ToInfo())
+}
+
+// @Summary 删除手动添加的服务器
+// @Tags server
+// @Accept json
+// @Produce json
+// @Param id path string true "server id"
+// @Success 200 {string} success
+// @Router /api/v1/server/{id} [delete]
+func deleteServer(c *gin.Context) {
+	before, err := app.App.DBIo.GetServer(c.Param("id"))
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	if err := app.App.DBIo.DeleteManualServer(c.Param("id")); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	recordChange(c, model.ResourceServer, model.ChangeDelete, before.ID, before.ToInfo(), nil)
+	c.String(200, "success")
+}
+
+// @Summary 设置服务器登录账号密码
+// @Description 云同步的服务器也可以设置，同步时保留 user 和 passwd，只设置 user 不设置密码时清除密码改用 key 登录，同步时同样保留 user
+// @Tags server
+// @Accept json
+// @Produce json
+// @Param id path string true "server id"
+// @Param body body model.ServerCredentialRequest true "credential"
+// @Success 200 {object} model.ServerInfo
+// @Router /api/v1/server/{id}/credentials [put]
+func setServerCredential(c *gin.Context) {
+	var req model.ServerCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	before, err := app.App.DBIo.GetServer(c.Param("id"))
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	server, err := app.App.DBIo.SetServerCredential(c.Param("id"), req)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	recordChange(c, model.ResourceServer, model.ChangeUpdate, server.ID, before.ToInfo(), server.ToInfo())
+	c.JSON(200, server.ToInfo())
+}
@@ -48,6 +48,8 @@ func addShellTask(c *gin.Context) {
 		c.String(500, err.Error())
 		return
 	}
+	after, _ := app.App.DBIo.GetShellTask(id)
+	recordChange(c, model.ResourceShellTask, model.ChangeCreate, id, nil, after)
 	c.String(200, id)
 }
 
@@ -65,11 +67,18 @@ func updateShellTask(c *gin.Context) {
 		c.String(400, err.Error())
 		return
 	}
-	err := app.App.DBIo.UpdateShellTask(c.Param("uuid"), &req)
+	before, err := app.App.DBIo.GetShellTask(c.Param("uuid"))
 	if err != nil {
 		c.String(500, err.Error())
 		return
 	}
+	err = app.App.DBIo.UpdateShellTask(c.Param("uuid"), &req)
+	if err != nil {
+		c.String(500, err.Error())
+		return
+	}
+	after, _ := app.App.DBIo.GetShellTask(c.Param("uuid"))
+	recordChange(c, model.ResourceShellTask, model.ChangeUpdate, c.Param("uuid"), before, after)
 	c.String(200, "success")
 }
 
@@ -82,11 +91,17 @@ func updateShellTask(c *gin.Context) {
 // @Success 200 {string} success
 // @Router /api/v1/shell/task/:uuid [delete]
 func deleteShellTask(c *gin.Context) {
-	err := app.App.DBIo.DeleteShellTask(c.Param("uuid"))
+	before, err := app.App.DBIo.GetShellTask(c.Param("uuid"))
+	if err != nil {
+		c.String(500, err.Error())
+		return
+	}
+	err = app.App.DBIo.DeleteShellTask(c.Param("uuid"))
 	if err != nil {
 		c.String(500, err.Error())
 		return
 	}
+	recordChange(c, model.ResourceShellTask, model.ChangeDelete, c.Param("uuid"), before, nil)
 	c.String(200, "success")
 }
 
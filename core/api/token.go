@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/model"
+)
+
+// @Summary 个人访问令牌列表
+// @Description 列出自己的访问令牌，admin 可以通过 user 查询其他人的令牌
+// @Tags Token
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param user query string false "user, only admin"
+// @Success 200 {object} []model.ApiToken
+// @Router /api/v1/token [get]
+func listApiToken(c *gin.Context) {
+	username, err := tokenOwner(c)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	if user := c.Query("user"); user != "" && isAdmin(c) {
+		username = user
+	}
+	tokens, err := app.App.DBIo.ListApiToken(username)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	c.JSON(200, tokens)
+}
+
+// @Summary 创建个人访问令牌
+// @Description 给自动化任务使用的令牌，令牌只在创建时返回一次，scopes 限定可用角色
+// @Description 只能使用登录 token 创建，个人访问令牌不能创建新的令牌，避免扩大权限
+// @Tags Token
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param request body model.CreateApiTokenRequest true "request"
+// @Success 200 {object} model.CreateApiTokenResponse
+// @Router /api/v1/token [post]
+func createApiToken(c *gin.Context) {
+	username, err := tokenOwner(c)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	if _, ok := c.Get(ctxTokenScopes); ok {
+		c.JSON(400, "api token can not create new token, login with password instead")
+		return
+	}
+	var req model.CreateApiTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	resp, err := app.App.DBIo.CreateApiToken(username, req)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	after, _ := app.App.DBIo.GetApiToken(resp.UUID)
+	recordChange(c, model.ResourceToken, model.ChangeCreate, resp.UUID, nil, after)
+	c.JSON(200, resp)
+}
+
+// @Summary 吊销个人访问令牌
+// @Description 只能吊销自己的令牌，admin 可以吊销所有令牌
+// @Tags Token
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string false "token"
+// @Param uuid path string true "token uuid"
+// @Success 200 {string} success
+// @Router /api/v1/token/:uuid [delete]
+func deleteApiToken(c *gin.Context) {
+	username, err := tokenOwner(c)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	if isAdmin(c) {
+		username = ""
+	}
+	before, _ := app.App.DBIo.GetApiToken(c.Param("uuid"))
+	if err := app.App.DBIo.DeleteApiToken(c.Param("uuid"), username); err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
+	recordChange(c, model.ResourceToken, model.ChangeDelete, c.Param("uuid"), before, nil)
+	c.String(200, "success")
+}
+
+// 令牌归属于当前登录用户，未启用认证时无法识别用户
+func tokenOwner(c *gin.Context) (string, error) {
+	if !app.App.Config.WithApiAuth.Enable {
+		return "", fmt.Errorf("api auth not enable, check withApiAuth config")
+	}
+	return getUsername(c), nil
+}
@@ -0,0 +1,85 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/xops-infra/noop/log"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/api"
+	"github.com/xops-infra/jms/core/db"
+	"github.com/xops-infra/jms/model"
+)
+
+const testSecret = "test-secret"
+
+func init() {
+	log.Default().WithLevel(log.InfoLevel).WithFilename("/tmp/test.log").Init()
+	gin.SetMode(gin.TestMode)
+}
+
+// 不依赖 /opt/jms/config.yaml，使用临时 sqlite 数据库
+func newTestRouter(t *testing.T) *gin.Engine {
+	rdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "jms.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, rdb.AutoMigrate(&model.User{}, &model.RoleBinding{}, &model.ApiToken{}, &model.ApiChangeRecord{}, &model.ApiDenyRecord{},
+		&model.Policy{}, &model.PolicyRevision{}, &model.Approval{}, &model.ApprovalDecision{}, &model.Server{}))
+	app.App = &app.Application{
+		Config: &model.Config{WithApiAuth: model.WithApiAuth{Enable: true, Secret: testSecret}},
+		DBIo:   db.NewJmsDbService(rdb),
+	}
+	return api.NewGin()
+}
+
+func jwtToken(t *testing.T, username string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": username,
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(testSecret))
+	assert.NoError(t, err)
+	return token
+}
+
+func createToken(r *gin.Engine, bearer string, req model.CreateApiTokenRequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(req)
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/token", bytes.NewReader(body))
+	httpReq.Header.Set("Authorization", "Bearer "+bearer)
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httpReq)
+	return w
+}
+
+func TestCreateApiTokenByApiToken(t *testing.T) {
+	r := newTestRouter(t)
+
+	// 登录 token 可以创建令牌
+	w := createToken(r, jwtToken(t, "alice"), model.CreateApiTokenRequest{
+		Name:   tea.String("ci-readonly"),
+		Scopes: []model.Role{model.RoleAuditor},
+	})
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	var resp model.CreateApiTokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	// 个人访问令牌不能再创建令牌，scopes 为空也不能继承用户所有角色
+	for _, scopes := range [][]model.Role{nil, {model.RoleAdmin}, {model.RoleAuditor}} {
+		w = createToken(r, resp.Token, model.CreateApiTokenRequest{Name: tea.String("escalate"), Scopes: scopes})
+		assert.Equal(t, 400, w.Code)
+	}
+	tokens, err := app.App.DBIo.ListApiToken("alice")
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 1)
+}
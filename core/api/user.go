@@ -63,11 +63,13 @@ func addUser(c *gin.Context) {
 		c.JSON(400, err.Error())
 		return
 	}
-	_, err := app.App.DBIo.CreateUser(&req)
+	id, err := app.App.DBIo.CreateUser(&req)
 	if err != nil {
 		c.JSON(500, err.Error())
 		return
 	}
+	after, _ := app.App.DBIo.GetUserByID(id)
+	recordChange(c, model.ResourceUser, model.ChangeCreate, id, nil, after)
 	c.String(200, "success")
 }
 
@@ -92,10 +94,17 @@ func updateUserGroup(c *gin.Context) {
 		c.JSON(400, err.Error())
 		return
 	}
+	before, err := app.App.DBIo.GetUserByID(id)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
 	if err := app.App.DBIo.PatchUserGroup(id, req); err != nil {
 		c.JSON(500, err.Error())
 		return
 	}
+	after, _ := app.App.DBIo.GetUserByID(id)
+	recordChange(c, model.ResourceUser, model.ChangeUpdate, id, before, after)
 	c.String(200, "success")
 }
 
@@ -120,9 +129,16 @@ func updateUser(c *gin.Context) {
 		c.JSON(400, err.Error())
 		return
 	}
+	before, err := app.App.DBIo.GetUserByID(id)
+	if err != nil {
+		c.JSON(500, err.Error())
+		return
+	}
 	if err := app.App.DBIo.UpdateUser(id, *req); err != nil {
 		c.JSON(500, err.Error())
 		return
 	}
+	after, _ := app.App.DBIo.GetUserByID(id)
+	recordChange(c, model.ResourceUser, model.ChangeUpdate, id, before, after)
 	c.String(200, "success")
 }
@@ -0,0 +1,169 @@
+package approval
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+
+	"github.com/xops-infra/jms/model"
+)
+
+const defaultDingtalkEndpoint = "https://api.dingtalk.com"
+
+// DingTalk 钉钉审批，使用新版开放平台接口
+// doc: https://open.dingtalk.com/document/orgapp/create-an-approval-instance
+type DingTalk struct {
+	conf   model.WithDingtalk
+	client *http.Client
+
+	lock  sync.Mutex
+	token tokenCache
+}
+
+func NewDingTalk(conf model.WithDingtalk) *DingTalk {
+	if conf.Endpoint == "" {
+		conf.Endpoint = defaultDingtalkEndpoint
+	}
+	conf.Endpoint = strings.TrimSuffix(conf.Endpoint, "/")
+	return &DingTalk{conf: conf, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (d *DingTalk) Name() string {
+	return ProviderDingtalk
+}
+
+func (d *DingTalk) accessToken() (string, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if token := d.token.get(); token != "" {
+		return token, nil
+	}
+	var resp struct {
+		AccessToken string `json:"accessToken"`
+		ExpireIn    int    `json:"expireIn"`
+	}
+	err := doJSON(d.client, http.MethodPost, d.conf.Endpoint+"/v1.0/oauth2/accessToken", nil, map[string]string{
+		"appKey":    d.conf.AppKey,
+		"appSecret": d.conf.AppSecret,
+	}, &resp)
+	if err != nil {
+		return "", fmt.Errorf("get dingtalk access token error: %s", err)
+	}
+	if resp.AccessToken == "" {
+		return "", fmt.Errorf("get dingtalk access token error: empty token")
+	}
+	d.token.set(resp.AccessToken, resp.ExpireIn)
+	return resp.AccessToken, nil
+}
+
+func (d *DingTalk) do(method, path string, body, out interface{}) error {
+	token, err := d.accessToken()
+	if err != nil {
+		return err
+	}
+	return doJSON(d.client, method, d.conf.Endpoint+path, map[string]string{
+		"x-acs-dingtalk-access-token": token,
+	}, body, out)
+}
+
+type dingtalkFormValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Create 按 EnvType 选择审批流程和表单映射
+func (d *DingTalk) Create(applicant model.User, req *model.PolicyRequest, envTypes []string) (string, error) {
+	if applicant.DingtalkID == nil || applicant.DingtalkDeptID == nil {
+		return "", fmt.Errorf("get user %s dingtalkid or dingtalkdeptid failed", tea.StringValue(applicant.Username))
+	}
+	process := d.conf.GetProcess(envTypes)
+	var values []dingtalkFormValue
+	for _, field := range model.ApprovalFormFields(req, process.Form, envTypes) {
+		values = append(values, dingtalkFormValue{Name: field.Name, Value: field.Value})
+	}
+	var resp struct {
+		InstanceID string `json:"instanceId"`
+	}
+	err := d.do(http.MethodPost, "/v1.0/workflow/processInstances", map[string]interface{}{
+		"processCode":         process.ProcessCode,
+		"originatorUserId":    *applicant.DingtalkID,
+		"deptId":              *applicant.DingtalkDeptID,
+		"formComponentValues": values,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.InstanceID == "" {
+		return "", fmt.Errorf("create dingtalk approval error: empty instance id")
+	}
+	return resp.InstanceID, nil
+}
+
+func (d *DingTalk) Status(id string) (*Result, error) {
+	var resp struct {
+		Success bool `json:"success"`
+		Result  struct {
+			Status     string `json:"status"` // RUNNING, COMPLETED, TERMINATED
+			Result     string `json:"result"` // agree, refuse
+			BusinessID string `json:"businessId"`
+			Tasks      []struct {
+				UserID string `json:"userId"`
+				Status string `json:"status"`
+				Result string `json:"result"`
+			} `json:"tasks"`
+		} `json:"result"`
+	}
+	if err := d.do(http.MethodGet, "/v1.0/workflow/processInstances?processInstanceId="+url.QueryEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("get dingtalk approval %s failed", id)
+	}
+	res := &Result{ID: id, Status: model.ApprovalPending}
+	switch resp.Result.Status {
+	case "COMPLETED":
+		res.Status = model.ApprovalRejected
+		if resp.Result.Result == "agree" {
+			res.Status = model.ApprovalApproved
+		}
+	case "TERMINATED":
+		res.Status = model.ApprovalCanceled
+	}
+	for _, task := range resp.Result.Tasks {
+		if task.Status == "COMPLETED" && task.UserID != "" {
+			res.Approver = task.UserID
+		}
+	}
+	if res.Approver == "" && resp.Result.BusinessID != "" {
+		res.Approver = fmt.Sprintf("%s:%s", ProviderDingtalk, resp.Result.BusinessID)
+	}
+	return res, nil
+}
+
+func (d *DingTalk) Cancel(id string, operator model.User, reason string) error {
+	if operator.DingtalkID == nil {
+		return fmt.Errorf("get user %s dingtalkid failed", tea.StringValue(operator.Username))
+	}
+	var resp struct {
+		Success bool `json:"success"`
+		Result  bool `json:"result"`
+	}
+	err := d.do(http.MethodPost, "/v1.0/workflow/processInstances/terminate", map[string]interface{}{
+		"processInstanceId": id,
+		"isSystem":          false,
+		"remark":            reason,
+		"operatingUserId":   *operator.DingtalkID,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if !resp.Success || !resp.Result {
+		return fmt.Errorf("terminate dingtalk approval %s failed", id)
+	}
+	return nil
+}
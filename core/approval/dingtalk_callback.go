@@ -0,0 +1,133 @@
+package approval
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 钉钉事件订阅的加解密，和钉钉官方 DingCallbackCrypto 一致
+// doc: https://open.dingtalk.com/document/orgapp/configure-event-subcription
+type DingtalkCrypto struct {
+	token string
+	key   []byte
+	owner string // 企业内部应用为 appKey
+}
+
+func NewDingtalkCrypto(token, aesKey, owner string) (*DingtalkCrypto, error) {
+	if len(aesKey) != 43 {
+		return nil, fmt.Errorf("dingtalk callback aes key must be 43 characters")
+	}
+	key, err := base64.StdEncoding.DecodeString(aesKey + "=")
+	if err != nil {
+		return nil, fmt.Errorf("decode dingtalk callback aes key error: %s", err)
+	}
+	return &DingtalkCrypto{token: token, key: key, owner: owner}, nil
+}
+
+// Signature sha1(sort(token, timestamp, nonce, encrypt))
+func (c *DingtalkCrypto) Signature(timestamp, nonce, encrypt string) string {
+	items := []string{c.token, timestamp, nonce, encrypt}
+	sort.Strings(items)
+	sum := sha1.Sum([]byte(strings.Join(items, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Decrypt 校验签名后解密，明文格式为 random(16) + len(4) + msg + owner
+func (c *DingtalkCrypto) Decrypt(signature, timestamp, nonce, encrypt string) ([]byte, error) {
+	if subtle.ConstantTimeCompare([]byte(c.Signature(timestamp, nonce, encrypt)), []byte(signature)) != 1 {
+		return nil, fmt.Errorf("dingtalk callback signature mismatch")
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil {
+		return nil, fmt.Errorf("decode dingtalk callback error: %s", err)
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("dingtalk callback invalid encrypt length %d", len(data))
+	}
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, c.key[:aes.BlockSize]).CryptBlocks(plain, data)
+	pad := int(plain[len(plain)-1])
+	if pad < 1 || pad > 32 || pad > len(plain) {
+		return nil, fmt.Errorf("dingtalk callback invalid padding")
+	}
+	plain = plain[:len(plain)-pad]
+	if len(plain) < 20 {
+		return nil, fmt.Errorf("dingtalk callback invalid content")
+	}
+	size := int(binary.BigEndian.Uint32(plain[16:20]))
+	if 20+size > len(plain) {
+		return nil, fmt.Errorf("dingtalk callback invalid content length")
+	}
+	msg, owner := plain[20:20+size], string(plain[20+size:])
+	if owner != c.owner {
+		return nil, fmt.Errorf("dingtalk callback owner %s mismatch", owner)
+	}
+	return msg, nil
+}
+
+// Encrypt 加密回复内容，返回钉钉要求的回复格式
+func (c *DingtalkCrypto) Encrypt(msg, timestamp, nonce string) (map[string]string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(random)
+	binary.Write(&buf, binary.BigEndian, uint32(len(msg)))
+	buf.WriteString(msg)
+	buf.WriteString(c.owner)
+	pad := 32 - buf.Len()%32
+	buf.Write(bytes.Repeat([]byte{byte(pad)}, pad))
+
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, buf.Len())
+	cipher.NewCBCEncrypter(block, c.key[:aes.BlockSize]).CryptBlocks(data, buf.Bytes())
+	encrypt := base64.StdEncoding.EncodeToString(data)
+	return map[string]string{
+		"msg_signature": c.Signature(timestamp, nonce, encrypt),
+		"timeStamp":     timestamp,
+		"nonce":         nonce,
+		"encrypt":       encrypt,
+	}, nil
+}
+
+// 钉钉推送的事件，只关心审批实例变更
+type DingtalkEvent struct {
+	EventType         string `json:"EventType"`
+	ProcessInstanceID string `json:"processInstanceId"`
+	ProcessCode       string `json:"processCode"`
+	Type              string `json:"type"`   // start, finish, terminate
+	Result            string `json:"result"` // agree, refuse
+	StaffID           string `json:"staffId"`
+}
+
+func ParseDingtalkEvent(data []byte) (*DingtalkEvent, error) {
+	var event DingtalkEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("parse dingtalk event error: %s", err)
+	}
+	return &event, nil
+}
+
+// Finished 审批实例结束(通过、拒绝或撤销)
+func (e *DingtalkEvent) Finished() bool {
+	return e.EventType == "bpms_instance_change" && (e.Type == "finish" || e.Type == "terminate")
+}
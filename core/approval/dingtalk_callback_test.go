@@ -0,0 +1,59 @@
+package approval_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/core/approval"
+)
+
+const testAESKey = "4g5j64qlyl3zvetqxz5jiocdr586fn2zvjpa8zls3ij"
+
+func TestDingtalkCrypto(t *testing.T) {
+	_, err := approval.NewDingtalkCrypto("token", "short", "ding-app")
+	assert.Error(t, err)
+
+	crypto, err := approval.NewDingtalkCrypto("token", testAESKey, "ding-app")
+	assert.NoError(t, err)
+
+	event := `{"EventType":"bpms_instance_change","processInstanceId":"proc-inst-1","type":"finish","result":"agree","staffId":"dt-bob"}`
+	resp, err := crypto.Encrypt(event, "1760000000000", "nonce1")
+	assert.NoError(t, err)
+	assert.Equal(t, crypto.Signature("1760000000000", "nonce1", resp["encrypt"]), resp["msg_signature"])
+
+	data, err := crypto.Decrypt(resp["msg_signature"], "1760000000000", "nonce1", resp["encrypt"])
+	if assert.NoError(t, err) {
+		assert.Equal(t, event, string(data))
+	}
+
+	// 签名不对或者参数被改过
+	_, err = crypto.Decrypt("bad", "1760000000000", "nonce1", resp["encrypt"])
+	assert.Error(t, err)
+	_, err = crypto.Decrypt(resp["msg_signature"], "1760000000001", "nonce1", resp["encrypt"])
+	assert.Error(t, err)
+
+	// 其他应用的密文
+	other, _ := approval.NewDingtalkCrypto("token", testAESKey, "other-app")
+	resp, _ = other.Encrypt(event, "1760000000000", "nonce1")
+	_, err = crypto.Decrypt(resp["msg_signature"], "1760000000000", "nonce1", resp["encrypt"])
+	assert.Error(t, err)
+}
+
+func TestParseDingtalkEvent(t *testing.T) {
+	cases := map[string]bool{
+		`{"EventType":"check_url"}`: false,
+		`{"EventType":"bpms_instance_change","processInstanceId":"p1","type":"start"}`:                    false,
+		`{"EventType":"bpms_instance_change","processInstanceId":"p1","type":"finish","result":"refuse"}`: true,
+		`{"EventType":"bpms_instance_change","processInstanceId":"p1","type":"terminate"}`:                true,
+		`{"EventType":"bpms_task_change","processInstanceId":"p1","type":"finish","result":"agree"}`:      false,
+	}
+	for data, finished := range cases {
+		event, err := approval.ParseDingtalkEvent([]byte(data))
+		if assert.NoError(t, err) {
+			assert.Equal(t, finished, event.Finished(), data)
+		}
+	}
+	_, err := approval.ParseDingtalkEvent([]byte("not json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package approval_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/core/approval"
+	"github.com/xops-infra/jms/model"
+)
+
+func newPolicyRequest() *model.PolicyRequest {
+	expiresAt := time.Date(2026, 10, 26, 0, 0, 0, 0, time.UTC)
+	return &model.PolicyRequest{
+		Name:           tea.String("alice-20261019"),
+		Users:          model.ArrayString{"alice"},
+		Actions:        model.ConnectOnly,
+		ServerFilterV1: &model.ServerFilterV1{Name: []string{"web-1"}},
+		ExpiresAt:      &expiresAt,
+		Justification:  tea.String("排查线上问题"),
+		TicketID:       tea.String("OPS-1"),
+	}
+}
+
+// 本地模拟钉钉开放平台
+func newDingtalkStandIn(t *testing.T, status, result string) *httptest.Server {
+	tokens := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.0/oauth2/accessToken", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.Equal(t, "key", req["appKey"])
+		tokens++
+		json.NewEncoder(w).Encode(map[string]interface{}{"accessToken": "dt-token", "expireIn": 7200})
+	})
+	mux.HandleFunc("/v1.0/workflow/processInstances", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "dt-token", r.Header.Get("x-acs-dingtalk-access-token"))
+		assert.Equal(t, 1, tokens, "token should be cached")
+		switch r.Method {
+		case http.MethodPost:
+			var req struct {
+				ProcessCode         string              `json:"processCode"`
+				OriginatorUserID    string              `json:"originatorUserId"`
+				DeptID              string              `json:"deptId"`
+				FormComponentValues []map[string]string `json:"formComponentValues"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			assert.Equal(t, "PROC-1", req.ProcessCode)
+			assert.Equal(t, "dt-alice", req.OriginatorUserID)
+			assert.Equal(t, "100", req.DeptID)
+			form := map[string]string{}
+			for _, v := range req.FormComponentValues {
+				form[v["name"]] = v["value"]
+			}
+			assert.Contains(t, form["Comment"], "排查线上问题")
+			assert.Contains(t, form["Comment"], "OPS-1")
+			assert.Equal(t, "2026-10-26T00:00:00Z", form["DateExpired"])
+			json.NewEncoder(w).Encode(map[string]string{"instanceId": "proc-inst-1"})
+		case http.MethodGet:
+			assert.Equal(t, "proc-inst-1", r.URL.Query().Get("processInstanceId"))
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"result": map[string]interface{}{
+					"status":     status,
+					"result":     result,
+					"businessId": "2026101900001",
+					"tasks": []map[string]string{
+						{"userId": "dt-bob", "status": "COMPLETED", "result": "AGREE"},
+					},
+				},
+			})
+		}
+	})
+	mux.HandleFunc("/v1.0/workflow/processInstances/terminate", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.Equal(t, "proc-inst-1", req["processInstanceId"])
+		assert.Equal(t, "dt-alice", req["operatingUserId"])
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": true})
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestDingTalk(t *testing.T) {
+	alice := model.User{Username: tea.String("alice"), DingtalkID: tea.String("dt-alice"), DingtalkDeptID: tea.String("100")}
+	cases := []struct {
+		status, result string
+		want           model.ApprovalStatus
+	}{
+		{"RUNNING", "", model.ApprovalPending},
+		{"COMPLETED", "agree", model.ApprovalApproved},
+		{"COMPLETED", "refuse", model.ApprovalRejected},
+		{"TERMINATED", "", model.ApprovalCanceled},
+	}
+	for _, c := range cases {
+		server := newDingtalkStandIn(t, c.status, c.result)
+		provider := approval.NewDingTalk(model.WithDingtalk{AppKey: "key", AppSecret: "secret", ProcessCode: "PROC-1", Endpoint: server.URL})
+		assert.Equal(t, approval.ProviderDingtalk, provider.Name())
+
+		id, err := provider.Create(alice, newPolicyRequest(), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "proc-inst-1", id)
+
+		res, err := provider.Status(id)
+		if assert.NoError(t, err) {
+			assert.Equal(t, c.want, res.Status, c.status)
+			assert.Equal(t, "dt-bob", res.Approver)
+		}
+		assert.NoError(t, provider.Cancel(id, alice, "不需要了"))
+		server.Close()
+	}
+
+	provider := approval.NewDingTalk(model.WithDingtalk{Endpoint: "http://127.0.0.1:1"})
+	_, err := provider.Create(model.User{Username: tea.String("bob")}, newPolicyRequest(), nil)
+	assert.Error(t, err, "user without dingtalk id")
+}
+
+func TestDingTalk_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":"InvalidAuthentication","message":"invalid appKey"}`))
+	}))
+	defer server.Close()
+	provider := approval.NewDingTalk(model.WithDingtalk{Endpoint: server.URL})
+	_, err := provider.Status("proc-inst-1")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid appKey")
+	}
+}
+
+func TestDingTalk_Process(t *testing.T) {
+	var got struct {
+		ProcessCode         string              `json:"processCode"`
+		FormComponentValues []map[string]string `json:"formComponentValues"`
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.0/oauth2/accessToken", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"accessToken": "dt-token", "expireIn": 7200})
+	})
+	mux.HandleFunc("/v1.0/workflow/processInstances", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(map[string]string{"instanceId": "proc-inst-1"})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	provider := approval.NewDingTalk(model.WithDingtalk{
+		ProcessCode: "PROC-DEFAULT",
+		Endpoint:    server.URL,
+		Processes: []model.DingtalkProcess{
+			{EnvTypes: []string{"prod"}, ProcessCode: "PROC-PROD", Form: map[string]string{
+				model.FormEnvType:       "环境",
+				model.FormJustification: "申请理由",
+				model.FormTicketID:      "工单",
+			}},
+			{EnvTypes: []string{"dev", "stage"}, ProcessCode: "PROC-DEV"},
+		},
+	})
+	alice := model.User{Username: tea.String("alice"), DingtalkID: tea.String("dt-alice"), DingtalkDeptID: tea.String("100")}
+	form := func() map[string]string {
+		values := map[string]string{}
+		for _, v := range got.FormComponentValues {
+			values[v["name"]] = v["value"]
+		}
+		return values
+	}
+
+	_, err := provider.Create(alice, newPolicyRequest(), []string{"dev", "prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, "PROC-PROD", got.ProcessCode)
+	assert.Equal(t, map[string]string{"环境": "prod", "申请理由": "排查线上问题", "工单": "OPS-1"}, form())
+
+	_, err = provider.Create(alice, newPolicyRequest(), []string{"stage"})
+	assert.NoError(t, err)
+	assert.Equal(t, "PROC-DEV", got.ProcessCode)
+	assert.Equal(t, "stage", form()["EnvType"])
+	assert.Contains(t, form(), "ServerFilter")
+
+	_, err = provider.Create(alice, newPolicyRequest(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "PROC-DEFAULT", got.ProcessCode)
+	assert.Equal(t, "none", form()["EnvType"])
+}
@@ -0,0 +1,179 @@
+package approval
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+
+	"github.com/xops-infra/jms/model"
+)
+
+const defaultFeishuEndpoint = "https://open.feishu.cn"
+
+// Feishu 飞书审批，表单控件的自定义 ID 需要和 model.ApprovalFormFields 的字段名一致
+// doc: https://open.feishu.cn/document/server-docs/approval-v4/instance/create
+type Feishu struct {
+	conf   model.WithFeishu
+	client *http.Client
+
+	lock  sync.Mutex
+	token tokenCache
+}
+
+func NewFeishu(conf model.WithFeishu) *Feishu {
+	if conf.Endpoint == "" {
+		conf.Endpoint = defaultFeishuEndpoint
+	}
+	conf.Endpoint = strings.TrimSuffix(conf.Endpoint, "/")
+	return &Feishu{conf: conf, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (f *Feishu) Name() string {
+	return ProviderFeishu
+}
+
+// 飞书接口统一返回 code，非 0 为失败
+type feishuResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (r feishuResponse) err(action string) error {
+	if r.Code != 0 {
+		return fmt.Errorf("%s error: %d %s", action, r.Code, r.Msg)
+	}
+	return nil
+}
+
+func (f *Feishu) accessToken() (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if token := f.token.get(); token != "" {
+		return token, nil
+	}
+	var resp struct {
+		feishuResponse
+		TenantAccessToken string `json:"tenant_access_token"`
+		Expire            int    `json:"expire"`
+	}
+	err := doJSON(f.client, http.MethodPost, f.conf.Endpoint+"/open-apis/auth/v3/tenant_access_token/internal", nil, map[string]string{
+		"app_id":     f.conf.AppID,
+		"app_secret": f.conf.AppSecret,
+	}, &resp)
+	if err != nil {
+		return "", fmt.Errorf("get feishu access token error: %s", err)
+	}
+	if err := resp.err("get feishu access token"); err != nil {
+		return "", err
+	}
+	f.token.set(resp.TenantAccessToken, resp.Expire)
+	return resp.TenantAccessToken, nil
+}
+
+func (f *Feishu) do(method, path string, body, out interface{}) error {
+	token, err := f.accessToken()
+	if err != nil {
+		return err
+	}
+	return doJSON(f.client, method, f.conf.Endpoint+path, map[string]string{
+		"Authorization": "Bearer " + token,
+	}, body, out)
+}
+
+type feishuFormValue struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (f *Feishu) Create(applicant model.User, req *model.PolicyRequest, envTypes []string) (string, error) {
+	if tea.StringValue(applicant.FeishuID) == "" {
+		return "", fmt.Errorf("get user %s feishu id failed", tea.StringValue(applicant.Username))
+	}
+	var values []feishuFormValue
+	for _, field := range model.ApprovalFormFields(req, nil, envTypes) {
+		values = append(values, feishuFormValue{ID: field.Name, Type: "textarea", Value: field.Value})
+	}
+	// 飞书的表单是 json 字符串
+	form, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		feishuResponse
+		Data struct {
+			InstanceCode string `json:"instance_code"`
+		} `json:"data"`
+	}
+	err = f.do(http.MethodPost, "/open-apis/approval/v4/instances?user_id_type=user_id", map[string]string{
+		"approval_code": f.conf.ApprovalCode,
+		"user_id":       *applicant.FeishuID,
+		"form":          string(form),
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if err := resp.err("create feishu approval"); err != nil {
+		return "", err
+	}
+	return resp.Data.InstanceCode, nil
+}
+
+func (f *Feishu) Status(id string) (*Result, error) {
+	var resp struct {
+		feishuResponse
+		Data struct {
+			Status   string `json:"status"` // PENDING, APPROVED, REJECTED, CANCELED, DELETED
+			TaskList []struct {
+				UserID string `json:"user_id"`
+				Status string `json:"status"`
+			} `json:"task_list"`
+		} `json:"data"`
+	}
+	if err := f.do(http.MethodGet, "/open-apis/approval/v4/instances/"+url.PathEscape(id)+"?user_id_type=user_id", nil, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.err("get feishu approval " + id); err != nil {
+		return nil, err
+	}
+	res := &Result{ID: id, Status: model.ApprovalPending}
+	switch resp.Data.Status {
+	case "APPROVED":
+		res.Status = model.ApprovalApproved
+	case "REJECTED":
+		res.Status = model.ApprovalRejected
+	case "CANCELED", "DELETED":
+		res.Status = model.ApprovalCanceled
+	}
+	for _, task := range resp.Data.TaskList {
+		if (task.Status == "APPROVED" || task.Status == "REJECTED") && task.UserID != "" {
+			res.Approver = task.UserID
+		}
+	}
+	if res.Approver == "" && res.Closed() {
+		res.Approver = fmt.Sprintf("%s:%s", ProviderFeishu, id)
+	}
+	return res, nil
+}
+
+func (f *Feishu) Cancel(id string, operator model.User, reason string) error {
+	if tea.StringValue(operator.FeishuID) == "" {
+		return fmt.Errorf("get user %s feishu id failed", tea.StringValue(operator.Username))
+	}
+	var resp feishuResponse
+	err := f.do(http.MethodPost, "/open-apis/approval/v4/instances/cancel?user_id_type=user_id", map[string]string{
+		"approval_code": f.conf.ApprovalCode,
+		"instance_code": id,
+		"user_id":       *operator.FeishuID,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	return resp.err("cancel feishu approval " + id)
+}
@@ -0,0 +1,104 @@
+package approval_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/core/approval"
+	"github.com/xops-infra/jms/model"
+)
+
+// 本地模拟飞书开放平台
+func newFeishuStandIn(t *testing.T, status string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/open-apis/auth/v3/tenant_access_token/internal", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.Equal(t, "cli_app", req["app_id"])
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 0, "tenant_access_token": "fs-token", "expire": 7200})
+	})
+	mux.HandleFunc("/open-apis/approval/v4/instances", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer fs-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "user_id", r.URL.Query().Get("user_id_type"))
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.Equal(t, "APPROVAL-1", req["approval_code"])
+		assert.Equal(t, "fs-alice", req["user_id"])
+		var form []map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(req["form"]), &form))
+		fields := map[string]string{}
+		for _, v := range form {
+			fields[v["id"]] = v["value"]
+		}
+		assert.Contains(t, fields["Comment"], "排查线上问题")
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 0, "data": map[string]string{"instance_code": "fs-inst-1"}})
+	})
+	mux.HandleFunc("/open-apis/approval/v4/instances/fs-inst-1", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer fs-token", r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code": 0,
+			"data": map[string]interface{}{
+				"status": status,
+				"task_list": []map[string]string{
+					{"user_id": "fs-bob", "status": "APPROVED"},
+					{"user_id": "fs-carol", "status": "PENDING"},
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/open-apis/approval/v4/instances/cancel", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.Equal(t, "fs-inst-1", req["instance_code"])
+		assert.Equal(t, "fs-alice", req["user_id"])
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 0})
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestFeishu(t *testing.T) {
+	alice := model.User{Username: tea.String("alice"), FeishuID: tea.String("fs-alice")}
+	cases := map[string]model.ApprovalStatus{
+		"PENDING":  model.ApprovalPending,
+		"APPROVED": model.ApprovalApproved,
+		"REJECTED": model.ApprovalRejected,
+		"CANCELED": model.ApprovalCanceled,
+		"DELETED":  model.ApprovalCanceled,
+	}
+	for status, want := range cases {
+		server := newFeishuStandIn(t, status)
+		provider := approval.NewFeishu(model.WithFeishu{AppID: "cli_app", AppSecret: "secret", ApprovalCode: "APPROVAL-1", Endpoint: server.URL})
+		assert.Equal(t, approval.ProviderFeishu, provider.Name())
+
+		id, err := provider.Create(alice, newPolicyRequest(), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "fs-inst-1", id)
+
+		res, err := provider.Status(id)
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, res.Status, status)
+			assert.Equal(t, "fs-bob", res.Approver)
+		}
+		assert.NoError(t, provider.Cancel(id, alice, ""))
+		server.Close()
+	}
+}
+
+func TestFeishu_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 99991663, "msg": "invalid app_id"})
+	}))
+	defer server.Close()
+	provider := approval.NewFeishu(model.WithFeishu{Endpoint: server.URL})
+	_, err := provider.Create(model.User{Username: tea.String("alice"), FeishuID: tea.String("fs-alice")}, newPolicyRequest(), nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid app_id")
+	}
+	_, err = provider.Create(model.User{Username: tea.String("bob")}, newPolicyRequest(), nil)
+	assert.Error(t, err, "user without feishu id")
+}
@@ -0,0 +1,96 @@
+package approval
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/xops-infra/jms/model"
+)
+
+// 外部审批系统
+const (
+	ProviderDingtalk = "dingtalk"
+	ProviderFeishu   = "feishu"
+)
+
+// Provider 外部审批系统，PUI 和接口通过它发起审批，定时任务查询审批结果
+type Provider interface {
+	Name() string
+	// Create 以申请人身份发起审批，返回外部审批单 ID，envTypes 为申请的服务器涉及的 EnvType
+	Create(applicant model.User, req *model.PolicyRequest, envTypes []string) (string, error)
+	// Status 查询审批结果，未结束返回 pending
+	Status(id string) (*Result, error)
+	// Cancel 撤销审批，operator 为撤销人
+	Cancel(id string, operator model.User, reason string) error
+}
+
+type Result struct {
+	ID       string               `json:"id"`
+	Status   model.ApprovalStatus `json:"status"`
+	Approver string               `json:"approver"` // 外部系统里最后处理的审批人
+}
+
+func (r *Result) Closed() bool {
+	return r.Status != model.ApprovalPending
+}
+
+// 缓存开放平台的 access token，提前 5 分钟刷新
+type tokenCache struct {
+	token     string
+	expiresAt time.Time
+}
+
+func (t *tokenCache) get() string {
+	if t.token == "" || time.Now().Add(5*time.Minute).After(t.expiresAt) {
+		return ""
+	}
+	return t.token
+}
+
+func (t *tokenCache) set(token string, expiresIn int) {
+	t.token = token
+	t.expiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
+}
+
+// 发送 json 请求并解析返回，非 2xx 返回错误
+func doJSON(client *http.Client, method, url string, headers map[string]string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s status %d: %s", method, url, resp.StatusCode, string(data))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s %s decode response error: %s", method, url, err)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package approval
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/xops-infra/noop/log"
+	"gorm.io/gorm"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/notify"
+	"github.com/xops-infra/jms/model"
+)
+
+var (
+	providersOnce  sync.Once
+	providers      map[string]Provider
+	dingtalkCrypto *DingtalkCrypto // 配置了钉钉事件订阅时不为空
+)
+
+// 按配置初始化启用的外部审批，需要启用数据库
+func loadProviders() map[string]Provider {
+	providersOnce.Do(func() {
+		providers = map[string]Provider{}
+		if !app.App.Config.WithDB.Enable {
+			return
+		}
+		if conf := app.App.Config.WithDingtalk; conf.Enable {
+			providers[ProviderDingtalk] = NewDingTalk(conf)
+			if conf.CallbackEnabled() {
+				crypto, err := NewDingtalkCrypto(conf.CallbackToken, conf.CallbackAESKey, conf.AppKey)
+				if err != nil {
+					log.Errorf("init dingtalk callback error: %s", err)
+				}
+				dingtalkCrypto = crypto
+			}
+		}
+		if app.App.Config.WithFeishu.Enable {
+			providers[ProviderFeishu] = NewFeishu(app.App.Config.WithFeishu)
+		}
+	})
+	return providers
+}
+
+// Enabled 是否启用了外部审批
+func Enabled() bool {
+	return len(loadProviders()) > 0
+}
+
+// Get 按名称获取，为空是早期的钉钉审批
+func Get(name string) (Provider, error) {
+	if name == "" {
+		name = ProviderDingtalk
+	}
+	provider, ok := loadProviders()[name]
+	if !ok {
+		return nil, fmt.Errorf("approval provider %s not enabled", name)
+	}
+	return provider, nil
+}
+
+// ForUser 配置了飞书 ID 的用户优先使用飞书审批，其次钉钉
+func ForUser(user model.User) (Provider, error) {
+	ps := loadProviders()
+	if p, ok := ps[ProviderFeishu]; ok && tea.StringValue(user.FeishuID) != "" {
+		return p, nil
+	}
+	if p, ok := ps[ProviderDingtalk]; ok {
+		return p, nil
+	}
+	if p, ok := ps[ProviderFeishu]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("no approval provider enabled")
+}
+
+// Submit 创建未启用的策略并发起外部审批，审批发起失败时删除策略
+// 返回策略 ID 和外部审批单 ID
+func Submit(applicant string, req *model.PolicyRequest) (string, string, error) {
+	user, err := app.App.DBIo.DescribeUser(applicant)
+	if err != nil {
+		return "", "", fmt.Errorf("user %s not found: %s", applicant, err)
+	}
+	provider, err := ForUser(user)
+	if err != nil {
+		return "", "", err
+	}
+	db := app.App.DBIo.WithAuthor(applicant)
+	policyID, err := db.CreatePolicy(req)
+	if err != nil {
+		return "", "", err
+	}
+	var envTypes []string
+	if servers, err := app.App.DBIo.LoadServer(); err != nil {
+		log.Errorf("load server error: %s", err)
+	} else {
+		envTypes = model.RequestEnvTypes(req.ServerFilterV1, servers)
+	}
+	approvalID, err := provider.Create(user, req, envTypes)
+	if err != nil {
+		log.Errorf("create %s approval error: %s", provider.Name(), err)
+		if err := db.DeletePolicy(policyID); err != nil {
+			log.Errorf("delete policy %s error: %s", policyID, err)
+		}
+		return "", "", err
+	}
+	status := model.ApprovalPending
+	err = db.UpdatePolicy(policyID, &model.PolicyRequest{
+		ApprovalID:       tea.String(approvalID),
+		ApprovalProvider: tea.String(provider.Name()),
+		ApprovalStatus:   &status,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("update policy approval id error, report to admin: %s", err)
+	}
+	go notify.Send(model.ApprovalNotification(approvalID, applicant, model.ApplyComment(tea.StringValue(req.Justification), tea.StringValue(req.TicketID)), status, ""))
+	return policyID, approvalID, nil
+}
+
+// 配置了回调的审批结果实时推送，定时任务只作为兜底
+func hasCallback(provider string) bool {
+	loadProviders()
+	return (provider == "" || provider == ProviderDingtalk) && dingtalkCrypto != nil
+}
+
+// Reconcile 查询等待中的外部审批，审批结束后同步到策略
+// fallback 为 false 时跳过已配置回调的审批，由间隔更长的兜底同步处理
+func Reconcile(fallback bool) {
+	timeStart := time.Now()
+	policies, err := app.App.DBIo.ListPendingExternalApproval()
+	if err != nil {
+		log.Errorf("list pending approval error: %s", err)
+		return
+	}
+	closed, checked := 0, 0
+	for _, policy := range policies {
+		if !fallback && hasCallback(policy.ApprovalProvider) {
+			continue
+		}
+		checked++
+		ok, err := syncPolicy(policy)
+		if err != nil {
+			log.Errorf("sync approval of policy %s error: %s", policy.ID, err)
+			continue
+		}
+		if ok {
+			closed++
+		}
+	}
+	log.Infof("load approval success, %d/%d, cost %v", closed, checked, time.Since(timeStart))
+}
+
+// 查询策略的外部审批结果，审批结束时更新策略，返回是否已结束
+func syncPolicy(policy model.Policy) (bool, error) {
+	provider, err := Get(policy.ApprovalProvider)
+	if err != nil {
+		return false, err
+	}
+	res, err := provider.Status(policy.ApprovalID)
+	if err != nil {
+		return false, fmt.Errorf("get %s approval %s error: %s", provider.Name(), policy.ApprovalID, err)
+	}
+	if !res.Closed() {
+		return false, nil
+	}
+	err = app.App.DBIo.WithAuthor(model.RevisionAuthorSystem).CloseExternalApproval(policy.ID, res.Status, res.Approver)
+	if err != nil {
+		return false, err
+	}
+	log.Infof("update %s approval %s of policy %s to %s", provider.Name(), policy.ApprovalID, policy.Name, res.Status)
+	notify.Send(model.ApprovalNotification(policy.ApprovalID, strings.Join(policy.Users, ","), policy.ApplyComment(), res.Status, res.Approver))
+	return true, nil
+}
+
+// DingtalkCallback 处理钉钉事件订阅回调，审批实例结束时立即同步到策略，返回加密后的回复
+// 审批结果以查询接口为准，重复或者伪造的事件内容不会影响策略状态
+func DingtalkCallback(signature, timestamp, nonce, encrypt string) (map[string]string, error) {
+	if !hasCallback(ProviderDingtalk) {
+		return nil, fmt.Errorf("dingtalk callback not enabled")
+	}
+	data, err := dingtalkCrypto.Decrypt(signature, timestamp, nonce, encrypt)
+	if err != nil {
+		return nil, err
+	}
+	event, err := ParseDingtalkEvent(data)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("dingtalk event %s %s %s", event.EventType, event.ProcessInstanceID, event.Type)
+	if event.Finished() {
+		policy, err := app.App.DBIo.QueryPolicyByApprovalID(event.ProcessInstanceID)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// 同一个应用下其他审批流程的事件
+			log.Debugf("dingtalk approval %s not found in policy, skip", event.ProcessInstanceID)
+		case err != nil:
+			return nil, err
+		case policy.ApprovalStatus == "" || policy.ApprovalStatus == model.ApprovalPending:
+			if _, err := syncPolicy(*policy); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return dingtalkCrypto.Encrypt("success", timestamp, nonce)
+}
+
+// Cancel 撤销策略的外部审批
+func Cancel(policyID, operator, reason string) error {
+	policy, err := app.App.DBIo.QueryPolicyById(policyID)
+	if err != nil {
+		return err
+	}
+	if policy.ApprovalID == "" {
+		return fmt.Errorf("policy %s has no external approval", policyID)
+	}
+	if policy.ApprovalStatus != model.ApprovalPending {
+		return fmt.Errorf("approval of policy %s is %s", policyID, policy.ApprovalStatus)
+	}
+	user, err := app.App.DBIo.DescribeUser(operator)
+	if err != nil {
+		return fmt.Errorf("user %s not found: %s", operator, err)
+	}
+	provider, err := Get(policy.ApprovalProvider)
+	if err != nil {
+		return err
+	}
+	if err := provider.Cancel(policy.ApprovalID, user, reason); err != nil {
+		return err
+	}
+	if err := app.App.DBIo.WithAuthor(operator).CloseExternalApproval(policyID, model.ApprovalCanceled, operator); err != nil {
+		return err
+	}
+	go notify.Send(model.ApprovalNotification(policy.ApprovalID, strings.Join(policy.Users, ","), policy.ApplyComment(), model.ApprovalCanceled, operator))
+	return nil
+}
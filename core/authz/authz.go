@@ -0,0 +1,101 @@
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/model"
+)
+
+// Hook 外部授权服务，决策按 用户+动作+服务器+来源 IP 缓存，调用失败的结果不缓存
+type Hook struct {
+	conf   model.WithAuthzHook
+	client *http.Client
+	cache  *cache.Cache
+}
+
+// New 未启用时返回 nil，nil 的 Hook 不做任何处理
+func New(conf model.WithAuthzHook) *Hook {
+	if !conf.Enable {
+		return nil
+	}
+	log.Infof("enable authz hook: %s", conf.URL)
+	return &Hook{
+		conf:   conf,
+		client: &http.Client{Timeout: conf.GetTimeout()},
+		cache:  cache.New(conf.GetCacheTTL(), 10*time.Minute),
+	}
+}
+
+// Apply 本地策略允许后再询问外部授权服务，client 为空的报表类场景不调用
+func (h *Hook) Apply(explain *model.PolicyExplain, user model.User, action model.Action, server model.Server, client string) {
+	if h == nil || !explain.Allow || client == "" || !h.conf.Match(action) {
+		return
+	}
+	decision := h.Decide(model.NewAuthzRequest(user, action, server, client))
+	if !decision.Allow {
+		explain.Allow = false
+		explain.Message = fmt.Sprintf("denied by authz hook: %s", decision.Message)
+		return
+	}
+	explain.Notice = decision.Message
+}
+
+// Decide 优先使用缓存的决策，调用失败时按 failOpen 放行或者拒绝
+func (h *Hook) Decide(req model.AuthzRequest) model.AuthzDecision {
+	key := req.CacheKey()
+	if v, ok := h.cache.Get(key); ok {
+		return v.(model.AuthzDecision)
+	}
+	decision, err := h.call(req)
+	if err != nil {
+		log.Errorf("authz hook %s error: %s, fail open: %v", key, err, h.conf.FailOpen)
+		if h.conf.FailOpen {
+			return model.AuthzDecision{Allow: true}
+		}
+		return model.AuthzDecision{Allow: false, Message: "authz service unavailable"}
+	}
+	if ttl := h.conf.GetCacheTTL(); ttl > 0 {
+		h.cache.Set(key, decision, ttl)
+	}
+	return decision
+}
+
+func (h *Hook) call(req model.AuthzRequest) (model.AuthzDecision, error) {
+	var decision model.AuthzDecision
+	data, err := json.Marshal(req)
+	if err != nil {
+		return decision, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, h.conf.URL, bytes.NewReader(data))
+	if err != nil {
+		return decision, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range h.conf.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return decision, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return decision, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return decision, fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	if err := json.Unmarshal(body, &decision); err != nil {
+		return decision, fmt.Errorf("decode response error: %s", err)
+	}
+	return decision, nil
+}
@@ -0,0 +1,142 @@
+package authz_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	mcsModel "github.com/xops-infra/multi-cloud-sdk/pkg/model"
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/core/authz"
+	. "github.com/xops-infra/jms/model"
+)
+
+func init() {
+	log.Default().WithLevel(log.InfoLevel).WithFilename("/tmp/test.log").Init()
+}
+
+// 模拟外部授权服务，prod 服务器需要有故障工单
+type authzServer struct {
+	lock     sync.Mutex
+	calls    int
+	requests []AuthzRequest
+	delay    time.Duration
+}
+
+func (s *authzServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req AuthzRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	s.lock.Lock()
+	s.calls++
+	s.requests = append(s.requests, req)
+	delay := s.delay
+	s.lock.Unlock()
+	time.Sleep(delay)
+	if r.Header.Get("X-Token") != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if req.ServerTags["EnvType"] == "prod" {
+		json.NewEncoder(w).Encode(AuthzDecision{Allow: false, Message: "no open incident ticket"})
+		return
+	}
+	json.NewEncoder(w).Encode(AuthzDecision{Allow: true, Message: "session is recorded"})
+}
+
+func (s *authzServer) count() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.calls
+}
+
+// 本地策略允许后调用，返回新的判断结果
+func apply(hook *authz.Hook, user User, action Action, server Server, client string, allow bool) *PolicyExplain {
+	explain := &PolicyExplain{Allow: allow, Message: "local policy"}
+	hook.Apply(explain, user, action, server, client)
+	return explain
+}
+
+func TestAuthzHook(t *testing.T) {
+	hook := &authzServer{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+	authzHook := authz.New(WithAuthzHook{
+		Enable:  true,
+		URL:     server.URL,
+		Headers: map[string]string{"X-Token": "secret"},
+		Actions: []Action{Connect},
+	})
+	user := User{Username: tea.String("alice"), Groups: ArrayString{"sre"}}
+	dev := Server{ID: "i-dev", Host: "10.9.0.1", Tags: mcsModel.Tags{{Key: "EnvType", Value: "dev"}}}
+	prod := Server{ID: "i-prod", Host: "10.9.0.2", Tags: mcsModel.Tags{{Key: "EnvType", Value: "prod"}}}
+
+	explain := apply(authzHook, user, Connect, dev, "1.2.3.4:5678", true)
+	assert.True(t, explain.Allow)
+	assert.Equal(t, "session is recorded", explain.Notice)
+	assert.Equal(t, "alice", hook.requests[0].User)
+	assert.Equal(t, "1.2.3.4", hook.requests[0].ClientIP)
+	assert.Equal(t, []string{"sre"}, hook.requests[0].Groups)
+
+	explain = apply(authzHook, user, Connect, prod, "1.2.3.4:5678", true)
+	assert.False(t, explain.Allow)
+	assert.Contains(t, explain.Message, "no open incident ticket")
+
+	// 决策缓存，来源端口不同也复用
+	assert.True(t, apply(authzHook, user, Connect, dev, "1.2.3.4:6000", true).Allow)
+	assert.False(t, apply(authzHook, user, Connect, prod, "1.2.3.4:6001", true).Allow)
+	assert.Equal(t, 2, hook.count())
+
+	// 本地策略拒绝、没有客户端的报表和没有配置的动作不调用
+	assert.False(t, apply(authzHook, user, Connect, dev, "5.6.7.8:5678", false).Allow)
+	assert.True(t, apply(authzHook, user, Connect, prod, "", true).Allow)
+	assert.True(t, apply(authzHook, user, Upload, prod, "1.2.3.4:5678", true).Allow)
+	assert.Equal(t, 2, hook.count())
+
+	// 未启用时不做处理
+	assert.Nil(t, authz.New(WithAuthzHook{URL: server.URL}))
+	assert.True(t, apply(nil, user, Connect, prod, "1.2.3.4:5678", true).Allow)
+}
+
+func TestAuthzHookFailure(t *testing.T) {
+	hook := &authzServer{delay: 2 * time.Second}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+	user := User{Username: tea.String("alice")}
+	dev := Server{ID: "i-dev", Host: "10.9.0.1"}
+	conf := WithAuthzHook{Enable: true, URL: server.URL, Headers: map[string]string{"X-Token": "secret"}, Timeout: 1}
+
+	// 超时默认拒绝，失败结果不缓存
+	authzHook := authz.New(conf)
+	explain := apply(authzHook, user, Connect, dev, "1.2.3.4:5678", true)
+	assert.False(t, explain.Allow)
+	assert.Contains(t, explain.Message, "unavailable")
+	assert.False(t, apply(authzHook, user, Connect, dev, "1.2.3.4:5678", true).Allow)
+	assert.Equal(t, 2, hook.count())
+
+	// fail open 时放行
+	conf.FailOpen = true
+	assert.True(t, apply(authz.New(conf), user, Connect, dev, "1.2.3.4:5678", true).Allow)
+
+	// 授权服务返回错误状态码同样按失败处理
+	conf.FailOpen = false
+	conf.Headers = nil
+	hook.lock.Lock()
+	hook.delay = 0
+	hook.lock.Unlock()
+	assert.False(t, apply(authz.New(conf), user, Connect, dev, "1.2.3.4:5678", true).Allow)
+
+	// 缓存时间小于 0 时每次都调用
+	conf.Headers = map[string]string{"X-Token": "secret"}
+	conf.CacheTTL = -1
+	authzHook = authz.New(conf)
+	calls := hook.count()
+	assert.True(t, apply(authzHook, user, Connect, dev, "1.2.3.4:5678", true).Allow)
+	assert.True(t, apply(authzHook, user, Connect, dev, "1.2.3.4:5678", true).Allow)
+	assert.Equal(t, calls+2, hook.count())
+}
@@ -0,0 +1,408 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/xops-infra/jms/model"
+	"gorm.io/gorm"
+)
+
+// 单类资源的读写，apply 和 export 共用
+type specStore struct {
+	kind    string
+	list    func() (map[string]interface{}, error) // name => 当前状态(声明式格式)
+	desired func(spec *model.AccessSpec) ([]string, map[string]interface{})
+	create  func(desired interface{}) error
+	update  func(name string, desired interface{}) error
+	delete  func(name string) error
+}
+
+// ApplyAccessSpec 按声明式配置同步用户、策略、代理和密钥元数据，返回变更计划
+// 只修改和清理归属于 spec.Owner 的资源，被接口手工修改过的资源默认跳过
+// 变更在一个事务里执行，失败时没有任何资源被修改
+func (d *DBService) ApplyAccessSpec(spec *model.AccessSpec, opt model.ApplyOptions) (model.ApplyPlan, error) {
+	if spec.Owner == "" {
+		spec.Owner = model.DefaultSpecOwner
+	}
+	var managed []model.ManagedResource
+	if err := d.DB.Find(&managed).Error; err != nil {
+		return nil, err
+	}
+	managedMap := make(map[string]*model.ManagedResource)
+	for i := range managed {
+		managedMap[managed[i].Kind+"/"+managed[i].Name] = &managed[i]
+	}
+
+	type step struct {
+		store  specStore
+		change model.ApplyChange
+		want   interface{}
+	}
+	var plan model.ApplyPlan
+	var steps []step
+	// 先建依赖少的资源，删除时反过来
+	stores := d.specStores()
+	for _, store := range stores {
+		current, err := store.list()
+		if err != nil {
+			return nil, fmt.Errorf("load %s error: %s", store.kind, err)
+		}
+		names, desired := store.desired(spec)
+		for _, name := range names {
+			resource := model.SpecResource{
+				Kind:    store.kind,
+				Name:    name,
+				Current: current[name],
+				Desired: desired[name],
+				Managed: managedMap[store.kind+"/"+name],
+			}
+			if change := resource.Plan(spec.Owner, opt); change != nil {
+				plan = append(plan, *change)
+				steps = append(steps, step{store: store, change: *change, want: desired[name]})
+			}
+		}
+	}
+	for i := len(stores) - 1; i >= 0; i-- {
+		store := stores[i]
+		current, err := store.list()
+		if err != nil {
+			return nil, fmt.Errorf("load %s error: %s", store.kind, err)
+		}
+		_, desired := store.desired(spec)
+		for _, m := range managed {
+			if m.Kind != store.kind || desired[m.Name] != nil {
+				continue
+			}
+			resource := model.SpecResource{Kind: m.Kind, Name: m.Name, Current: current[m.Name], Managed: managedMap[m.Kind+"/"+m.Name]}
+			if change := resource.Plan(spec.Owner, opt); change != nil {
+				plan = append(plan, *change)
+				steps = append(steps, step{store: store, change: *change})
+			}
+		}
+	}
+	if opt.DryRun {
+		return plan, nil
+	}
+
+	// 所有变更和归属记录在一个事务里，中途失败全部回滚，不会只应用一部分
+	err := d.transaction(func(tx *DBService) error {
+		txStores := make(map[string]specStore)
+		for _, store := range tx.specStores() {
+			txStores[store.kind] = store
+		}
+		for _, s := range steps {
+			store := txStores[s.store.kind]
+			var err error
+			switch s.change.Op {
+			case model.ApplyCreate:
+				err = store.create(s.want)
+			case model.ApplyUpdate:
+				err = store.update(s.change.Name, s.want)
+			case model.ApplyDelete:
+				err = store.delete(s.change.Name)
+			default:
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s %s %s error: %s", s.change.Op, s.change.Kind, s.change.Name, err)
+			}
+			if err := tx.markManaged(store, s.change, spec.Owner); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return plan, err
+}
+
+// 记录归属和 apply 后的状态摘要，删除的资源去掉归属
+func (d *DBService) markManaged(store specStore, change model.ApplyChange, owner string) error {
+	where := d.DB.Where("kind = ? and name = ?", change.Kind, change.Name)
+	if change.Op == model.ApplyDelete {
+		return where.Delete(&model.ManagedResource{}).Error
+	}
+	current, err := store.list()
+	if err != nil {
+		return err
+	}
+	record := model.ManagedResource{Kind: change.Kind, Name: change.Name, Owner: owner, Hash: model.SpecHash(current[change.Name])}
+	var exist model.ManagedResource
+	err = where.First(&exist).Error
+	if err == gorm.ErrRecordNotFound {
+		return d.DB.Create(&record).Error
+	}
+	if err != nil {
+		return err
+	}
+	return d.DB.Model(&exist).Updates(map[string]interface{}{"owner": record.Owner, "hash": record.Hash}).Error
+}
+
+// ExportAccessSpec 导出当前状态，owner 不为空时只导出归属于 owner 的资源
+func (d *DBService) ExportAccessSpec(owner string) (*model.AccessSpec, error) {
+	owned := make(map[string]bool)
+	if owner != "" {
+		var managed []model.ManagedResource
+		if err := d.DB.Where("owner = ?", owner).Find(&managed).Error; err != nil {
+			return nil, err
+		}
+		for _, m := range managed {
+			owned[m.Kind+"/"+m.Name] = true
+		}
+	}
+	spec := &model.AccessSpec{Owner: owner}
+	for _, store := range d.specStores() {
+		current, err := store.list()
+		if err != nil {
+			return nil, fmt.Errorf("load %s error: %s", store.kind, err)
+		}
+		for _, name := range sortedKeys(current) {
+			if owner != "" && !owned[store.kind+"/"+name] {
+				continue
+			}
+			switch item := current[name].(type) {
+			case model.AddKeyRequest:
+				spec.Keys = append(spec.Keys, item)
+			case model.CreateProxyRequest:
+				spec.Proxies = append(spec.Proxies, item)
+			case model.UserRequest:
+				spec.Users = append(spec.Users, item)
+			case model.PolicyRequest:
+				spec.Policies = append(spec.Policies, item)
+			}
+		}
+	}
+	return spec, nil
+}
+
+func (d *DBService) specStores() []specStore {
+	return []specStore{d.keySpecStore(), d.proxySpecStore(), d.userSpecStore(), d.policySpecStore()}
+}
+
+func (d *DBService) keySpecStore() specStore {
+	return specStore{
+		kind: model.SpecKindKey,
+		list: func() (map[string]interface{}, error) {
+			var keys []model.Key
+			if err := d.DB.Where("is_delete is false").Find(&keys).Error; err != nil {
+				return nil, err
+			}
+			res := make(map[string]interface{})
+			for _, key := range keys {
+				res[key.KeyID] = model.KeyToSpec(key)
+			}
+			return res, nil
+		},
+		desired: func(spec *model.AccessSpec) ([]string, map[string]interface{}) {
+			var names []string
+			res := make(map[string]interface{})
+			for _, key := range spec.Keys {
+				names = append(names, *key.KeyID)
+				res[*key.KeyID] = key
+			}
+			return names, res
+		},
+		create: func(desired interface{}) error {
+			_, err := d.AddKey(desired.(model.AddKeyRequest))
+			return err
+		},
+		update: func(name string, desired interface{}) error {
+			return d.UpdateKeyMeta(name, desired.(model.AddKeyRequest))
+		},
+		delete: func(name string) error {
+			var key model.Key
+			if err := d.DB.Where("key_id = ? and is_delete is false", name).First(&key).Error; err != nil {
+				return err
+			}
+			return d.DeleteKey(key.UUID)
+		},
+	}
+}
+
+func (d *DBService) proxySpecStore() specStore {
+	return specStore{
+		kind: model.SpecKindProxy,
+		list: func() (map[string]interface{}, error) {
+			proxies, err := d.ListProxy()
+			if err != nil {
+				return nil, err
+			}
+			res := make(map[string]interface{})
+			for _, proxy := range proxies {
+				res[tea.StringValue(proxy.Name)] = model.ProxyToSpec(proxy)
+			}
+			return res, nil
+		},
+		desired: func(spec *model.AccessSpec) ([]string, map[string]interface{}) {
+			var names []string
+			res := make(map[string]interface{})
+			for _, proxy := range spec.Proxies {
+				names = append(names, *proxy.Name)
+				res[*proxy.Name] = proxy
+			}
+			return names, res
+		},
+		create: func(desired interface{}) error {
+			_, err := d.CreateProxy(desired.(model.CreateProxyRequest))
+			return err
+		},
+		update: func(name string, desired interface{}) error {
+			proxy, err := d.getProxyByName(name)
+			if err != nil {
+				return err
+			}
+			_, err = d.UpdateProxy(proxy.UUID, desired.(model.CreateProxyRequest))
+			return err
+		},
+		delete: func(name string) error {
+			proxy, err := d.getProxyByName(name)
+			if err != nil {
+				return err
+			}
+			return d.DeleteProxy(proxy.UUID)
+		},
+	}
+}
+
+func (d *DBService) userSpecStore() specStore {
+	return specStore{
+		kind: model.SpecKindUser,
+		list: func() (map[string]interface{}, error) {
+			users, err := d.QueryAllUser()
+			if err != nil {
+				return nil, err
+			}
+			res := make(map[string]interface{})
+			for _, user := range users {
+				if user.Username == nil || tea.BoolValue(user.IsDeleted) {
+					continue
+				}
+				res[*user.Username] = model.UserToSpec(user)
+			}
+			return res, nil
+		},
+		desired: func(spec *model.AccessSpec) ([]string, map[string]interface{}) {
+			var names []string
+			res := make(map[string]interface{})
+			for _, user := range spec.Users {
+				names = append(names, *user.Username)
+				res[*user.Username] = user
+			}
+			return names, res
+		},
+		create: func(desired interface{}) error {
+			req := desired.(model.UserRequest)
+			// 之前删除过的用户直接恢复
+			var user model.User
+			err := d.DB.Where("username = ? and is_deleted = ?", *req.Username, true).First(&user).Error
+			if err == nil {
+				if err := d.DB.Model(&user).Update("is_deleted", false).Error; err != nil {
+					return err
+				}
+				return d.UpdateUser(user.ID, req)
+			}
+			_, err = d.CreateUser(&req)
+			return err
+		},
+		update: func(name string, desired interface{}) error {
+			user, err := d.DescribeUser(name)
+			if err != nil {
+				return err
+			}
+			return d.UpdateUser(user.ID, desired.(model.UserRequest))
+		},
+		delete: func(name string) error {
+			user, err := d.DescribeUser(name)
+			if err != nil {
+				return err
+			}
+			return d.DeleteUser(user.ID)
+		},
+	}
+}
+
+func (d *DBService) policySpecStore() specStore {
+	return specStore{
+		kind: model.SpecKindPolicy,
+		list: func() (map[string]interface{}, error) {
+			policies, err := d.QueryAllPolicy()
+			if err != nil {
+				return nil, err
+			}
+			res := make(map[string]interface{})
+			for _, policy := range policies {
+				res[policy.Name] = model.PolicyToSpec(policy)
+			}
+			return res, nil
+		},
+		desired: func(spec *model.AccessSpec) ([]string, map[string]interface{}) {
+			var names []string
+			res := make(map[string]interface{})
+			for _, policy := range spec.Policies {
+				if policy.ExpiresAt != nil {
+					expiresAt := policy.ExpiresAt.UTC()
+					policy.ExpiresAt = &expiresAt
+				}
+				names = append(names, *policy.Name)
+				res[*policy.Name] = policy
+			}
+			return names, res
+		},
+		create: func(desired interface{}) error {
+			req := desired.(model.PolicyRequest)
+			id, err := d.CreatePolicy(&req)
+			if err != nil {
+				return err
+			}
+			// 新建策略默认不启用，声明了启用的直接启用
+			if tea.BoolValue(req.IsEnabled) {
+				return d.UpdatePolicy(id, &model.PolicyRequest{IsEnabled: tea.Bool(true)})
+			}
+			return nil
+		},
+		update: func(name string, desired interface{}) error {
+			policy, err := d.getPolicyByName(name)
+			if err != nil {
+				return err
+			}
+			req := desired.(model.PolicyRequest)
+			return d.UpdatePolicy(policy.ID, &req)
+		},
+		delete: func(name string) error {
+			policy, err := d.getPolicyByName(name)
+			if err != nil {
+				return err
+			}
+			return d.DeletePolicy(policy.ID)
+		},
+	}
+}
+
+func (d *DBService) getPolicyByName(name string) (*model.Policy, error) {
+	policies, err := d.QueryPolicyByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) != 1 {
+		return nil, fmt.Errorf("policy %s matched %d rows", name, len(policies))
+	}
+	return &policies[0], nil
+}
+
+func (d *DBService) getProxyByName(name string) (*model.Proxy, error) {
+	var proxy model.Proxy
+	if err := d.DB.Where("name = ? and is_delete is false", name).First(&proxy).Error; err != nil {
+		return nil, err
+	}
+	return &proxy, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,113 @@
+package db_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/xops-infra/jms/core/db"
+	"github.com/xops-infra/jms/model"
+)
+
+// 重复 apply 没有变更，prune 删除的用户不能再用公钥登录，也不再匹配策略
+func TestApplyAccessSpec_PruneUser(t *testing.T) {
+	d := newTestDB(t, &model.User{}, &model.Policy{}, &model.PolicyRevision{}, &model.ManagedResource{},
+		&model.Key{}, &model.Proxy{}, &model.AuthorizedKey{})
+	expiresAt := time.Now().Add(24 * time.Hour)
+	policy := model.PolicyRequest{
+		Name:           tea.String("alice-dev"),
+		Users:          model.ArrayString{"alice"},
+		Actions:        model.ArrayString{string(model.Connect)},
+		ServerFilterV1: &model.ServerFilterV1{EnvType: []string{"dev"}},
+		ExpiresAt:      &expiresAt,
+		IsEnabled:      tea.Bool(true),
+		SourceCIDRs:    model.ArrayString{"10.8.0.0/16"},
+	}
+	spec := &model.AccessSpec{
+		Users:    []model.UserRequest{{Username: tea.String("alice"), Groups: model.ArrayString{"dev"}}},
+		Policies: []model.PolicyRequest{policy},
+	}
+	plan, err := d.ApplyAccessSpec(spec, model.ApplyOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, plan, 2)
+	plan, err = d.ApplyAccessSpec(spec, model.ApplyOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, plan)
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	sshPub, err := gossh.NewPublicKey(pub)
+	assert.NoError(t, err)
+	assert.NoError(t, d.AddAuthorizedKey("alice", string(gossh.MarshalAuthorizedKey(sshPub))))
+	assert.True(t, d.AuthKey("alice", sshPub))
+	policies, err := d.QueryPolicyByUser("alice")
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+
+	spec.Users = nil
+	plan, err = d.ApplyAccessSpec(spec, model.ApplyOptions{Prune: true})
+	assert.NoError(t, err)
+	assert.Len(t, plan, 1)
+	assert.Equal(t, model.ApplyDelete, plan[0].Op)
+	assert.False(t, d.AuthKey("alice", sshPub))
+	policies, err = d.QueryPolicyByUser("alice")
+	assert.NoError(t, err)
+	assert.Empty(t, policies)
+
+	// 不在数据库里的用户(如 ldap 用户)公钥正常使用
+	assert.NoError(t, d.AddAuthorizedKey("bob", "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl bob"))
+	keys, err := d.GetKeyByUsername("bob")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+// 中途失败时整个 apply 回滚，也不推送策略变更事件
+func TestApplyAccessSpec_Rollback(t *testing.T) {
+	d := newTestDB(t, &model.User{}, &model.Policy{}, &model.PolicyRevision{}, &model.ManagedResource{},
+		&model.Key{}, &model.Proxy{})
+	var events []string
+	db.OnPolicyChange = func(policy model.Policy, action model.RevisionAction, author string) {
+		events = append(events, policy.Name)
+	}
+	t.Cleanup(func() { db.OnPolicyChange = nil })
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	policy := func(name string, cidrs ...string) model.PolicyRequest {
+		return model.PolicyRequest{
+			Name:           tea.String(name),
+			Users:          model.ArrayString{"alice"},
+			Actions:        model.ArrayString{string(model.Connect)},
+			ServerFilterV1: &model.ServerFilterV1{EnvType: []string{"dev"}},
+			ExpiresAt:      &expiresAt,
+			SourceCIDRs:    cidrs,
+		}
+	}
+	spec := &model.AccessSpec{
+		Users:    []model.UserRequest{{Username: tea.String("alice")}},
+		Policies: []model.PolicyRequest{policy("a-ok"), policy("b-bad", "not-a-cidr")},
+	}
+	_, err := d.ApplyAccessSpec(spec, model.ApplyOptions{})
+	assert.Error(t, err)
+	users, err := d.QueryAllUser()
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+	policies, err := d.QueryAllPolicy()
+	assert.NoError(t, err)
+	assert.Empty(t, policies)
+	var managed int64
+	assert.NoError(t, d.DB.Model(&model.ManagedResource{}).Count(&managed).Error)
+	assert.Zero(t, managed)
+	assert.Empty(t, events)
+
+	// 修正后重新 apply，提交后才推送事件
+	spec.Policies[1] = policy("b-ok", "10.8.0.0/16")
+	plan, err := d.ApplyAccessSpec(spec, model.ApplyOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, plan, 3)
+	assert.ElementsMatch(t, []string{"a-ok", "b-ok"}, events)
+}
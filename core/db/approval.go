@@ -0,0 +1,167 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/google/uuid"
+	"github.com/xops-infra/jms/model"
+	"gorm.io/gorm"
+)
+
+// SubmitApproval 创建未启用的策略和对应的审批单，按申请的服务器 team 路由审批人
+func (d *DBService) SubmitApproval(req *model.ApprovalMut, route model.WithApproval) (*model.Approval, error) {
+	return d.SubmitPolicyApproval(tea.StringValue(req.Applicant), req.ToPolicyMut(), route)
+}
+
+// SubmitPolicyApproval 按策略申请创建审批单，SSH 菜单申请时使用
+// 策略和审批单在一个事务里创建，失败时不会留下没有审批单的策略
+func (d *DBService) SubmitPolicyApproval(applicant string, policyReq *model.PolicyRequest, route model.WithApproval) (*model.Approval, error) {
+	if tea.StringValue(policyReq.Justification) == "" {
+		return nil, fmt.Errorf("justification is required")
+	}
+	servers, err := d.LoadServer()
+	if err != nil {
+		return nil, err
+	}
+	teams := model.ArrayString{}
+	for _, server := range servers {
+		if !model.MatchServerByFilter(*policyReq.ServerFilterV1, server, false) {
+			continue
+		}
+		for _, tag := range server.Tags {
+			if tag.Key == route.GetTagKey() && tag.Value != "" && !slices.Contains(teams, tag.Value) {
+				teams = append(teams, tag.Value)
+			}
+		}
+	}
+	approvers, required := route.Route(teams)
+	approval := &model.Approval{
+		ID:            uuid.NewString(),
+		Applicant:     applicant,
+		Justification: tea.StringValue(policyReq.Justification),
+		TicketID:      tea.StringValue(policyReq.TicketID),
+		Teams:         teams,
+		Approvers:     approvers,
+		Required:      required,
+		Status:        model.ApprovalPending,
+	}
+	err = d.transaction(func(tx *DBService) error {
+		policyID, err := tx.CreatePolicy(policyReq)
+		if err != nil {
+			return err
+		}
+		approval.PolicyID = policyID
+		return tx.DB.Create(approval).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// ListApproval status 为空查询所有
+func (d *DBService) ListApproval(status string) ([]model.Approval, error) {
+	sql := d.DB.Model(&model.Approval{})
+	if status != "" {
+		sql = sql.Where("status = ?", status)
+	}
+	var approvals []model.Approval
+	if err := sql.Order("created_at desc").Find(&approvals).Error; err != nil {
+		return nil, err
+	}
+	for i := range approvals {
+		if err := d.loadApprovalDecisions(d.DB, &approvals[i]); err != nil {
+			return nil, err
+		}
+	}
+	return approvals, nil
+}
+
+func (d *DBService) GetApproval(id string) (*model.Approval, error) {
+	var approval model.Approval
+	if err := d.DB.Where("id = ?", id).First(&approval).Error; err != nil {
+		return nil, err
+	}
+	return &approval, d.loadApprovalDecisions(d.DB, &approval)
+}
+
+// 策略对应的审批单，PUI 审批菜单使用
+func (d *DBService) GetApprovalByPolicy(policyID string) (*model.Approval, error) {
+	var approval model.Approval
+	if err := d.DB.Where("policy_id = ?", policyID).First(&approval).Error; err != nil {
+		return nil, err
+	}
+	return &approval, d.loadApprovalDecisions(d.DB, &approval)
+}
+
+func (d *DBService) loadApprovalDecisions(tx *gorm.DB, approval *model.Approval) error {
+	return tx.Where("approval_id = ?", approval.ID).Order("id").Find(&approval.Decisions).Error
+}
+
+// DecideApproval 记录审批意见，审批结束后启用或者拒绝策略
+// 审批单关闭和策略状态更新在一个事务里，策略更新失败时审批单保持待审批，可以重新审批
+func (d *DBService) DecideApproval(id, approver string, approve bool, comment string) (*model.Approval, error) {
+	user, err := d.DescribeUser(approver)
+	if err != nil {
+		return nil, fmt.Errorf("approver %s not found: %s", approver, err)
+	}
+	var approval model.Approval
+	err = d.transaction(func(tx *DBService) error {
+		if err := tx.DB.Where("id = ?", id).First(&approval).Error; err != nil {
+			return err
+		}
+		if err := tx.loadApprovalDecisions(tx.DB, &approval); err != nil {
+			return err
+		}
+		if err := approval.CanApprove(user); err != nil {
+			return err
+		}
+		decision := model.ApprovalDecision{
+			ApprovalID: approval.ID,
+			Approver:   approver,
+			Approve:    approve,
+			Comment:    comment,
+		}
+		if err := tx.DB.Create(&decision).Error; err != nil {
+			return err
+		}
+		approval.Decisions = append(approval.Decisions, decision)
+		approval.Status = approval.Decide()
+		if approval.Status == model.ApprovalPending {
+			return nil
+		}
+		now := time.Now()
+		approval.ClosedAt = &now
+		// 并发审批时只有一个能关闭审批单
+		res := tx.DB.Model(&model.Approval{}).Where("id = ? and status = ?", approval.ID, model.ApprovalPending).Updates(map[string]interface{}{
+			"status":    approval.Status,
+			"closed_at": now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("approval %s already closed", approval.ID)
+		}
+		// 通过时记录所有同意的审批人，拒绝时记录拒绝人
+		approvedBy := approver
+		if approval.Status == model.ApprovalApproved {
+			approvedBy = approval.ApprovedBy()
+		}
+		err := tx.WithAuthor(approver).UpdatePolicyStatus(approval.PolicyID, model.ApprovalResult{
+			Applicant: tea.String(approvedBy),
+			IsPass:    tea.Bool(approval.Status == model.ApprovalApproved),
+		})
+		if err != nil {
+			return fmt.Errorf("update policy %s error: %s", approval.PolicyID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
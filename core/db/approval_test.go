@@ -0,0 +1,64 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func approvalMut() *model.ApprovalMut {
+	return &model.ApprovalMut{
+		Users:         model.ArrayString{"alice"},
+		Applicant:     tea.String("alice"),
+		ServerFilter:  &model.ServerFilterV1{EnvType: []string{"prod"}},
+		Justification: tea.String("排查线上问题"),
+	}
+}
+
+// 审批单创建失败时不留下策略
+func TestSubmitApproval_Rollback(t *testing.T) {
+	d := newTestDB(t, &model.Policy{}, &model.PolicyRevision{}, &model.Server{})
+	_, err := d.SubmitApproval(approvalMut(), model.WithApproval{})
+	assert.Error(t, err)
+	policies, err := d.QueryAllPolicy()
+	assert.NoError(t, err)
+	assert.Empty(t, policies)
+}
+
+// 策略更新失败时审批单不关闭，审批意见也不记录，可以重新审批
+func TestDecideApproval_Rollback(t *testing.T) {
+	d := newTestDB(t, &model.User{}, &model.Policy{}, &model.PolicyRevision{}, &model.Server{},
+		&model.Approval{}, &model.ApprovalDecision{})
+	_, err := d.CreateUser(&model.UserRequest{Username: tea.String("bob"), Groups: model.ArrayString{"admin"}})
+	assert.NoError(t, err)
+	approval, err := d.SubmitApproval(approvalMut(), model.WithApproval{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, d.DB.Delete(&model.Policy{}, "id = ?", approval.PolicyID).Error)
+	_, err = d.DecideApproval(approval.ID, "bob", true, "")
+	assert.Error(t, err)
+	after, err := d.GetApproval(approval.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ApprovalPending, after.Status)
+	assert.Empty(t, after.Decisions)
+}
+
+func TestDecideApproval(t *testing.T) {
+	d := newTestDB(t, &model.User{}, &model.Policy{}, &model.PolicyRevision{}, &model.Server{},
+		&model.Approval{}, &model.ApprovalDecision{})
+	_, err := d.CreateUser(&model.UserRequest{Username: tea.String("bob"), Groups: model.ArrayString{"admin"}})
+	assert.NoError(t, err)
+	approval, err := d.SubmitApproval(approvalMut(), model.WithApproval{})
+	assert.NoError(t, err)
+
+	after, err := d.DecideApproval(approval.ID, "bob", true, "ok")
+	assert.NoError(t, err)
+	assert.Equal(t, model.ApprovalApproved, after.Status)
+	policy, err := d.QueryPolicyById(approval.PolicyID)
+	assert.NoError(t, err)
+	assert.True(t, policy.IsEnabled)
+	assert.Equal(t, "bob", policy.Approver)
+}
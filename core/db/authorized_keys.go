@@ -1,13 +1,16 @@
 package db
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/alibabacloud-go/tea/tea"
 	"github.com/elfgzp/ssh"
 	"github.com/google/uuid"
 	"github.com/xops-infra/jms/model"
 	"github.com/xops-infra/noop/log"
+	"gorm.io/gorm"
 )
 
 // 支持单个用户多个公钥认证
@@ -26,9 +29,17 @@ func (d *DBService) AuthKey(username string, pub ssh.PublicKey) bool {
 	return false
 }
 
+// 已删除的用户不返回公钥，ldap 等不在数据库里的用户正常返回
 func (d *DBService) GetKeyByUsername(username string) ([]model.AuthorizedKey, error) {
 	var keys []model.AuthorizedKey
-	err := d.DB.Where("user_name = ? and is_delete = false", username).Find(&keys).Error
+	user, err := d.DescribeUser(username)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return keys, err
+	}
+	if tea.BoolValue(user.IsDeleted) {
+		return keys, nil
+	}
+	err = d.DB.Where("user_name = ? and is_delete = false", username).Find(&keys).Error
 	return keys, err
 }
 
@@ -12,6 +12,7 @@ import (
 // TEST AddAuthorizedKey
 // 本地认证信息迁移到数据库
 func TestAddAuthorizedKey(t *testing.T) {
+	requireConfig(t)
 	// 解析本地公钥
 	hostAuthorizedKeys := "/opt/jms/.ssh/authorized_keys"
 	hostAuthorizedKeys = strings.Replace(hostAuthorizedKeys, "~", os.Getenv("HOME"), 1)
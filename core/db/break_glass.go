@@ -0,0 +1,118 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/google/uuid"
+	"github.com/xops-infra/jms/model"
+)
+
+// CreateBreakGlass 创建立即生效的限时策略和待复盘的紧急访问记录
+func (d *DBService) CreateBreakGlass(user model.User, reason string, server model.Server, conf model.WithBreakGlass) (*model.BreakGlass, error) {
+	username := tea.StringValue(user.Username)
+	if !conf.Allow(user) {
+		return nil, fmt.Errorf("user %s is not allowed to use break glass access", username)
+	}
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+	now := time.Now()
+	req := conf.PolicyRequest(username, reason, server, now)
+	policyID, err := d.WithAuthor(username).CreatePolicy(req)
+	if err != nil {
+		return nil, err
+	}
+	err = d.WithAuthor(username).UpdatePolicyStatus(policyID, model.ApprovalResult{
+		Applicant: tea.String(model.BreakGlassApprover),
+		IsPass:    tea.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	breakGlass := &model.BreakGlass{
+		ID:         uuid.NewString(),
+		User:       username,
+		Reason:     reason,
+		ServerHost: server.Host,
+		ServerName: server.Name,
+		PolicyID:   policyID,
+		ExpiresAt:  *req.ExpiresAt,
+		Recordings: model.ArrayString{},
+		Status:     model.BreakGlassOpen,
+	}
+	if err := d.DB.Create(breakGlass).Error; err != nil {
+		return nil, err
+	}
+	return breakGlass, nil
+}
+
+// ListBreakGlass status 为空查询所有
+func (d *DBService) ListBreakGlass(status string) ([]model.BreakGlass, error) {
+	sql := d.DB.Model(&model.BreakGlass{})
+	if status != "" {
+		sql = sql.Where("status = ?", status)
+	}
+	var list []model.BreakGlass
+	if err := sql.Order("created_at desc").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (d *DBService) GetBreakGlass(id string) (*model.BreakGlass, error) {
+	var breakGlass model.BreakGlass
+	if err := d.DB.Where("id = ?", id).First(&breakGlass).Error; err != nil {
+		return nil, fmt.Errorf("break glass %s not found: %s", id, err)
+	}
+	return &breakGlass, nil
+}
+
+// 用户在该服务器上还在有效期内的紧急访问，会话需要全程录像
+func (d *DBService) QueryActiveBreakGlass(username, host string, now time.Time) (*model.BreakGlass, error) {
+	var breakGlass model.BreakGlass
+	err := d.DB.Where("username = ? and server_host = ? and expires_at > ?", username, host, now).
+		Order("created_at desc").First(&breakGlass).Error
+	if err != nil {
+		return nil, err
+	}
+	return &breakGlass, nil
+}
+
+// 记录紧急访问会话的录像文件，复盘时查看
+func (d *DBService) AddBreakGlassRecording(id string, files ...string) error {
+	breakGlass, err := d.GetBreakGlass(id)
+	if err != nil {
+		return err
+	}
+	return d.DB.Model(breakGlass).Update("recordings", appendUnique(breakGlass.Recordings, files)).Error
+}
+
+// ReviewBreakGlass 管理员复盘后关闭
+func (d *DBService) ReviewBreakGlass(id, reviewer, comment string) (*model.BreakGlass, error) {
+	breakGlass, err := d.GetBreakGlass(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := breakGlass.CanReview(reviewer); err != nil {
+		return nil, err
+	}
+	if comment == "" {
+		return nil, fmt.Errorf("review comment is required")
+	}
+	now := time.Now()
+	res := d.DB.Model(&model.BreakGlass{}).Where("id = ? and status = ?", id, model.BreakGlassOpen).Updates(map[string]interface{}{
+		"status":         model.BreakGlassClosed,
+		"reviewed_by":    reviewer,
+		"review_comment": comment,
+		"reviewed_at":    now,
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, fmt.Errorf("break glass %s already reviewed", id)
+	}
+	return d.GetBreakGlass(id)
+}
@@ -67,6 +67,15 @@ func (d *DBService) AddKey(req model.AddKeyRequest) (string, error) {
 	return key.UUID, d.DB.Create(key).Error
 }
 
+func (d *DBService) GetKey(uuid string) (*model.Key, error) {
+	var key model.Key
+	err := d.DB.Where("uuid = ?", uuid).Where("is_delete is false").First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
 func (d *DBService) DeleteKey(uuid string) error {
 	// 先查询是否存在
 	var key model.Key
@@ -76,3 +85,21 @@ func (d *DBService) DeleteKey(uuid string) error {
 	}
 	return d.DB.Model(&key).Update("is_delete", true).Error
 }
+
+// 只更新密钥元数据，私钥不变
+func (d *DBService) UpdateKeyMeta(keyID string, req model.AddKeyRequest) error {
+	updates := map[string]interface{}{}
+	if req.IdentityFile != nil {
+		updates["key_name"] = *req.IdentityFile
+	}
+	if req.UserName != nil {
+		updates["user_name"] = *req.UserName
+	}
+	if req.Profile != nil {
+		updates["profile"] = *req.Profile
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return d.DB.Model(&model.Key{}).Where("key_id = ? and is_delete is false", keyID).Updates(updates).Error
+}
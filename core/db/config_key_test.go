@@ -14,6 +14,7 @@ import (
 
 // AddKey
 func TestAddKey(t *testing.T) {
+	requireConfig(t)
 	// 读取pem目录下所有.pem文件
 	_ = filepath.Walk("./pem", func(path string, info os.FileInfo, err error) error {
 		if info.IsDir() {
@@ -46,6 +47,7 @@ func TestAddKey(t *testing.T) {
 
 // ListKey
 func TestListKey(t *testing.T) {
+	requireConfig(t)
 	keys, err := app.App.DBIo.ListKey()
 	if err != nil {
 		t.Fatal(err)
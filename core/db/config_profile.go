@@ -96,6 +96,15 @@ func (d *DBService) UpdateProfile(uuid string, req model.CreateProfileRequest) e
 	return err
 }
 
+func (d *DBService) GetProfile(uuid string) (*model.Profile, error) {
+	var profile model.Profile
+	err := d.DB.Where("uuid = ?", uuid).Where("is_delete is false").First(&profile).Error
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
 func (d *DBService) DeleteProfile(uuid string) error {
 	// 先查询是否存在
 	var profile model.Profile
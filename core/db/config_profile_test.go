@@ -10,6 +10,7 @@ import (
 
 // TEST LoadProfile
 func TestLoadProfile(t *testing.T) {
+	requireConfig(t)
 	profiles, err := app.App.DBIo.LoadProfile()
 	if err != nil {
 		t.Error(err)
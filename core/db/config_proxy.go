@@ -74,7 +74,7 @@ func (d *DBService) CreateProxy(req model.CreateProxyRequest) (model.Proxy, erro
 }
 
 func (d *DBService) UpdateProxy(uuid string, req model.CreateProxyRequest) (model.Proxy, error) {
-	err := d.DB.Where("uuid = ? and is_delete is false", uuid).Updates(req).Error
+	err := d.DB.Model(&model.Proxy{}).Where("uuid = ? and is_delete is false", uuid).Updates(req).Error
 	if err != nil {
 		return model.Proxy{}, err
 	}
@@ -83,6 +83,15 @@ func (d *DBService) UpdateProxy(uuid string, req model.CreateProxyRequest) (mode
 	return proxy, err
 }
 
+func (d *DBService) GetProxy(uuid string) (*model.Proxy, error) {
+	var proxy model.Proxy
+	err := d.DB.Where("uuid = ? and is_delete is false", uuid).First(&proxy).Error
+	if err != nil {
+		return nil, err
+	}
+	return &proxy, nil
+}
+
 func (d *DBService) DeleteProxy(uuid string) error {
 	// 先找
 	var proxy model.Proxy
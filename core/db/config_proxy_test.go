@@ -10,6 +10,7 @@ import (
 
 // TEST ListProxy
 func TestListProxy(t *testing.T) {
+	requireConfig(t)
 	proxies, err := app.App.DBIo.ListProxy()
 	if err != nil {
 		t.Error(err)
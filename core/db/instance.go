@@ -28,8 +28,24 @@ func (d *DBService) GetInstanceByHost(host string) (*model.Server, error) {
 	return &server, nil
 }
 
+// 依据 ID，IP 或者名称查询服务器，名称重复时报错
+func (d *DBService) FindServer(key string) (*model.Server, error) {
+	var servers []model.Server
+	err := d.DB.Where("id = ? or host = ? or name = ?", key, key, key).Find(&servers).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("server %s not found", key)
+	}
+	if len(servers) > 1 {
+		return nil, fmt.Errorf("server %s matched %d servers, use id or ip instead", key, len(servers))
+	}
+	return &servers[0], nil
+}
+
 // 更新数据库服务器列表，支持删除没有的服务器
-// 注意支持 passwd 字段可以保留
+// 注意支持 passwd 字段可以保留，接口手动添加的服务器不会被删除和覆盖
 func (d *DBService) UpdateServerWithDelete(newServers []model.Server) error {
 	// Step 1: Load existing servers
 	var existingServers []model.Server
@@ -37,10 +53,17 @@ func (d *DBService) UpdateServerWithDelete(newServers []model.Server) error {
 	if err != nil {
 		return err
 	}
+	manualServers := map[string]bool{}
+	for _, server := range existingServers {
+		if server.IsManual() {
+			manualServers[server.ID] = true
+			manualServers[server.Host] = true
+		}
+	}
 
 	var manualPasswdServers model.Servers
-	// find passwd not '' to reset new server
-	err = d.DB.Where("passwd != ''").Find(&manualPasswdServers).Error
+	// 配置了密码或者通过接口设置过账号的，同步时保留账号密码
+	err = d.DB.Where("passwd != '' or credential_set = ?", true).Find(&manualPasswdServers).Error
 	if err != nil {
 		return err
 	}
@@ -48,19 +71,30 @@ func (d *DBService) UpdateServerWithDelete(newServers []model.Server) error {
 
 	// Step 2: Build a map of new servers for quick lookup
 	newServerMap := make(map[string]model.Server)
-	for id, server := range newServers {
+	syncServers := make([]model.Server, 0, len(newServers))
+	for _, server := range newServers {
+		// 和手动添加的服务器冲突时保留手动添加的
+		if manualServers[server.ID] || manualServers[server.Host] {
+			log.Warnf("server %s(%s) conflicts with manual server, skip", server.ID, server.Host)
+			continue
+		}
 		// find manual passwd move to new server
 		if manual_server, found := manualPasswdServersMap[server.Host]; found {
 			server.Passwd = manual_server.Passwd
 			server.User = manual_server.User
-			newServers[id] = server
+			server.CredentialSet = manual_server.CredentialSet
 			log.Infof("reset server from manual passwd: %s", server.Host)
 		}
 		newServerMap[server.Host] = server
+		syncServers = append(syncServers, server)
 	}
+	newServers = syncServers
 
 	// Step 3: Find servers to delete
 	for _, existingServer := range existingServers {
+		if existingServer.IsManual() {
+			continue
+		}
 		if _, found := newServerMap[existingServer.Host]; !found {
 			// keep manual passwd server
 			if existingServer.Passwd != "" {
@@ -79,5 +113,96 @@ func (d *DBService) UpdateServerWithDelete(newServers []model.Server) error {
 	}
 
 	// Step 4: Save (insert or update) the new servers
+	if len(newServers) == 0 {
+		return nil
+	}
 	return d.DB.Save(&newServers).Error
 }
+
+func (d *DBService) GetServer(id string) (*model.Server, error) {
+	var server model.Server
+	if err := d.DB.Where("id = ?", id).First(&server).Error; err != nil {
+		return nil, fmt.Errorf("server %s not found: %s", id, err)
+	}
+	return &server, nil
+}
+
+// 手动添加服务器，id 和 host 都不能和已有的服务器重复
+func (d *DBService) CreateManualServer(server model.Server) error {
+	var count int64
+	if err := d.DB.Model(&model.Server{}).Where("id = ? or host = ?", server.ID, server.Host).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("server id %s or host %s already exists", server.ID, server.Host)
+	}
+	server.Source = model.ServerSourceManual
+	return d.DB.Create(&server).Error
+}
+
+// 只能修改手动添加的服务器，云同步的服务器会被下次同步覆盖
+func (d *DBService) UpdateManualServer(id string, req model.UpdateServerRequest) (*model.Server, error) {
+	server, err := d.getManualServer(id)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := req.Apply(*server)
+	if err != nil {
+		return nil, err
+	}
+	if updated.Host != server.Host {
+		var count int64
+		if err := d.DB.Model(&model.Server{}).Where("host = ? and id != ?", updated.Host, id).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("server host %s already exists", updated.Host)
+		}
+	}
+	if err := d.DB.Save(&updated).Error; err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (d *DBService) DeleteManualServer(id string) error {
+	server, err := d.getManualServer(id)
+	if err != nil {
+		return err
+	}
+	return d.DB.Delete(server).Error
+}
+
+func (d *DBService) getManualServer(id string) (*model.Server, error) {
+	server, err := d.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+	if !server.IsManual() {
+		return nil, fmt.Errorf("server %s is managed by cloud sync or localServers, only manual server can be modified", id)
+	}
+	return server, nil
+}
+
+// 设置登录账号密码，云同步时按 host 保留
+func (d *DBService) SetServerCredential(id string, req model.ServerCredentialRequest) (*model.Server, error) {
+	server, err := d.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+	server.User = *req.User
+	server.Passwd = ""
+	if req.Passwd != nil {
+		server.Passwd = *req.Passwd
+	}
+	server.CredentialSet = true
+	err = d.DB.Model(&model.Server{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"user":           server.User,
+		"passwd":         server.Passwd,
+		"credential_set": true,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return server, nil
+}
@@ -0,0 +1,80 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	mcsModel "github.com/xops-infra/multi-cloud-sdk/pkg/model"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func cloudServer(id, host string) model.Server {
+	return model.Server{ID: id, Name: id, Host: host, Port: 22, Status: mcsModel.InstanceStatusRunning}
+}
+
+// 手动添加的服务器不会被云同步删除和覆盖，设置的密码同步时保留
+func TestUpdateServerWithDelete_Manual(t *testing.T) {
+	d := newTestDB(t, &model.Server{})
+	assert.NoError(t, d.UpdateServerWithDelete([]model.Server{cloudServer("i-1", "10.0.0.1"), cloudServer("i-2", "10.0.0.2")}))
+
+	manual, err := model.CreateServerRequest{Name: tea.String("idc-db"), Host: tea.String("192.168.1.10")}.ToServer()
+	assert.NoError(t, err)
+	assert.NoError(t, d.CreateManualServer(manual))
+	assert.Error(t, d.CreateManualServer(manual))
+	_, err = d.SetServerCredential("i-1", model.ServerCredentialRequest{User: tea.String("root"), Passwd: tea.String("secret")})
+	assert.NoError(t, err)
+
+	// 云上 i-2 下线，同时出现一台和手动服务器同 IP 的机器
+	assert.NoError(t, d.UpdateServerWithDelete([]model.Server{cloudServer("i-1", "10.0.0.1"), cloudServer("i-3", "192.168.1.10")}))
+	servers, err := d.LoadServer()
+	assert.NoError(t, err)
+	byID := map[string]model.Server{}
+	for _, server := range servers {
+		byID[server.ID] = server
+	}
+	assert.Len(t, byID, 2)
+	assert.Equal(t, "secret", byID["i-1"].Passwd)
+	assert.Equal(t, "root", byID["i-1"].User)
+	assert.Equal(t, "idc-db", byID["192.168.1.10"].Name)
+	assert.True(t, byID["192.168.1.10"].IsManual())
+
+	// 云同步的服务器只能设置账号密码
+	_, err = d.UpdateManualServer("i-1", model.UpdateServerRequest{Name: tea.String("x")})
+	assert.Error(t, err)
+	assert.Error(t, d.DeleteManualServer("i-1"))
+
+	updated, err := d.UpdateManualServer("192.168.1.10", model.UpdateServerRequest{Port: tea.Int(2222), Tags: map[string]string{"EnvType": "prod"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2222, updated.Port)
+	_, err = d.UpdateManualServer("192.168.1.10", model.UpdateServerRequest{Host: tea.String("10.0.0.1")})
+	assert.Error(t, err)
+
+	// 同步为空时手动服务器也保留
+	assert.NoError(t, d.UpdateServerWithDelete(nil))
+	server, err := d.GetServer("192.168.1.10")
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", *server.Tags.GetEnvType())
+
+	assert.NoError(t, d.DeleteManualServer("192.168.1.10"))
+	_, err = d.GetServer("192.168.1.10")
+	assert.Error(t, err)
+}
+
+// 只设置用户不设置密码(key 登录)的服务器，同步时同样保留用户
+func TestUpdateServerWithDelete_CredentialUserOnly(t *testing.T) {
+	d := newTestDB(t, &model.Server{})
+	assert.NoError(t, d.UpdateServerWithDelete([]model.Server{cloudServer("i-1", "10.0.0.1")}))
+	server, err := d.SetServerCredential("i-1", model.ServerCredentialRequest{User: tea.String("ubuntu")})
+	assert.NoError(t, err)
+	assert.True(t, server.CredentialSet)
+
+	assert.NoError(t, d.UpdateServerWithDelete([]model.Server{cloudServer("i-1", "10.0.0.1")}))
+	server, err = d.GetServer("i-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "ubuntu", server.User)
+	assert.Empty(t, server.Passwd)
+	assert.True(t, server.CredentialSet)
+	assert.True(t, server.ToInfo().CredentialSet)
+}
@@ -1,7 +1,10 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/alibabacloud-go/tea/tea"
 	"github.com/google/uuid"
@@ -13,6 +16,18 @@ func (d *DBService) CreatePolicy(req *model.PolicyRequest) (string, error) {
 	if req.Name == nil || req.ServerFilterV1 == nil || req.ExpiresAt == nil {
 		return "", fmt.Errorf("invalid request. please check required fields")
 	}
+	if err := req.ServerFilterV1.Validate(); err != nil {
+		return "", err
+	}
+	if req.Schedule != nil {
+		if err := req.Schedule.Validate(); err != nil {
+			return "", err
+		}
+	}
+	if err := model.ValidateSourceCIDRs(req.SourceCIDRs); err != nil {
+		return "", err
+	}
+	req.NormalizeSubjects()
 	// 判断策略是否存在
 	var count int64
 	if err := d.DB.Model(&model.Policy{}).Where("name = ?", *req.Name).Count(&count).Error; err != nil {
@@ -26,23 +41,103 @@ func (d *DBService) CreatePolicy(req *model.PolicyRequest) (string, error) {
 		Name:           tea.StringValue(req.Name),
 		IsEnabled:      false, // 默认不启用，需要审批
 		Users:          req.Users,
+		Groups:         req.Groups,
 		Actions:        req.Actions,
 		ServerFilter:   nil,
 		ServerFilterV1: req.ServerFilterV1,
 		ExpiresAt:      *req.ExpiresAt,
+		Schedule:       req.Schedule,
+		SourceCIDRs:    req.SourceCIDRs,
+		LoginUsers:     req.LoginUsers,
+		Justification:  tea.StringValue(req.Justification),
+		TicketID:       tea.StringValue(req.TicketID),
+		RenewFrom:      tea.StringValue(req.RenewFrom),
 	}
-	if d.DB.Create(newPolicy).Error != nil {
-		return "", d.DB.Error
+	err := d.changePolicy([]string{newPolicy.ID}, model.RevisionCreate, 0, func(tx *gorm.DB) error {
+		return tx.Create(newPolicy).Error
+	})
+	if err != nil {
+		return "", err
 	}
 	return newPolicy.ID, nil
 }
 
 func (d *DBService) UpdatePolicy(id string, mut *model.PolicyRequest) error {
+	if mut.ServerFilterV1 != nil {
+		if err := mut.ServerFilterV1.Validate(); err != nil {
+			return err
+		}
+	}
+	if mut.Schedule != nil {
+		if err := mut.Schedule.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := model.ValidateSourceCIDRs(mut.SourceCIDRs); err != nil {
+		return err
+	}
+	mut.NormalizeSubjects()
 	policy, err := d.QueryPolicyById(id)
 	if err != nil {
 		return err
 	}
-	return d.DB.Model(policy).Updates(mut).Error
+	return d.changePolicy([]string{id}, model.RevisionUpdate, 0, func(tx *gorm.DB) error {
+		return tx.Model(policy).Updates(policyUpdateColumns(mut)).Error
+	})
+}
+
+// 只更新请求里带上的字段，请求结构体不和表字段绑定
+func policyUpdateColumns(mut *model.PolicyRequest) map[string]interface{} {
+	columns := map[string]interface{}{}
+	if mut.Name != nil {
+		columns["name"] = *mut.Name
+	}
+	if mut.Users != nil {
+		columns["users"] = mut.Users
+	}
+	if mut.Groups != nil {
+		columns["groups"] = mut.Groups
+	}
+	if mut.Actions != nil {
+		columns["actions"] = mut.Actions
+	}
+	if mut.ServerFilterV1 != nil {
+		columns["server_filter_v1"] = mut.ServerFilterV1
+	}
+	if mut.ExpiresAt != nil {
+		columns["expires_at"] = *mut.ExpiresAt
+	}
+	if mut.IsEnabled != nil {
+		columns["is_enabled"] = *mut.IsEnabled
+	}
+	if mut.ApprovalID != nil {
+		columns["approval_id"] = *mut.ApprovalID
+	}
+	if mut.ApprovalProvider != nil {
+		columns["approval_provider"] = *mut.ApprovalProvider
+	}
+	if mut.ApprovalStatus != nil {
+		columns["approval_status"] = *mut.ApprovalStatus
+	}
+	if mut.Schedule != nil {
+		columns["schedule"] = mut.Schedule
+	}
+	if mut.SourceCIDRs != nil {
+		columns["source_cidrs"] = mut.SourceCIDRs
+	}
+	if mut.LoginUsers != nil {
+		columns["login_users"] = mut.LoginUsers
+	}
+	if mut.Justification != nil {
+		columns["justification"] = *mut.Justification
+	}
+	if mut.TicketID != nil {
+		columns["ticket_id"] = *mut.TicketID
+	}
+	if mut.RenewFrom != nil {
+		columns["renew_from"] = *mut.RenewFrom
+	}
+	return columns
 }
 
 func (d *DBService) UpdatePolicyStatus(id string, mut model.ApprovalResult) error {
@@ -50,47 +145,130 @@ func (d *DBService) UpdatePolicyStatus(id string, mut model.ApprovalResult) erro
 	if err != nil {
 		return err
 	}
-	return d.DB.Model(policy).Updates(map[string]interface{}{
-		"is_enabled": mut.IsPass,
-		"approver":   mut.Applicant,
-	}).Error
+	return d.changePolicy([]string{id}, model.RevisionApprove, 0, func(tx *gorm.DB) error {
+		return tx.Model(policy).Updates(map[string]interface{}{
+			"is_enabled": mut.IsPass,
+			"approver":   mut.Applicant,
+		}).Error
+	})
 }
 
+// 软删除，版本记录保留
 func (d *DBService) DeletePolicy(id string) error {
-	return d.DB.Model(&model.Policy{}).Where("id = ?", id).UpdateColumn("is_deleted", true).Error
+	if _, err := d.QueryPolicyById(id); err != nil {
+		return err
+	}
+	return d.changePolicy([]string{id}, model.RevisionDelete, 0, func(tx *gorm.DB) error {
+		return tx.Model(&model.Policy{}).Where("id = ?", id).UpdateColumn("is_deleted", true).Error
+	})
 }
 
 func (d *DBService) ApprovePolicy(policyName, Approver string, IsEnabled bool) error {
-	return d.DB.Model(&model.Policy{}).Where("name = ?", policyName).Updates(map[string]interface{}{
-		"is_enabled": IsEnabled,
-		"approver":   Approver,
-	}).Error
+	var ids []string
+	if err := d.DB.Model(&model.Policy{}).Where("name = ?", policyName).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("policy %s not found", policyName)
+	}
+	return d.WithAuthor(Approver).changePolicy(ids, model.RevisionApprove, 0, func(tx *gorm.DB) error {
+		return tx.Model(&model.Policy{}).Where("id in ?", ids).Updates(map[string]interface{}{
+			"is_enabled": IsEnabled,
+			"approver":   Approver,
+		}).Error
+	})
 }
 
 func (d *DBService) AddUsersToPolicy(name string, usernames []string) error {
-	return d.DB.Model(&model.Policy{}).Where("name = ?", name).Update("users", gorm.Expr("json_array_append(users, ?)", usernames)).Error
+	return d.updatePolicySubjects(name, func(policy *model.Policy) {
+		policy.Users = appendUnique(policy.Users, usernames)
+	})
 }
 
 func (d *DBService) RemoveUsersFromPolicy(name string, usernames []string) error {
-	return d.DB.Model(&model.Policy{}).Where("name = ?", name).Update("users", gorm.Expr("json_remove(users, ?)", usernames)).Error
+	return d.updatePolicySubjects(name, func(policy *model.Policy) {
+		policy.Users = removeAll(policy.Users, usernames)
+	})
 }
 
 func (d *DBService) AddGroupsToPolicy(name string, groups []string) error {
-	return d.DB.Model(&model.Policy{}).Where("name = ?", name).Update("groups", gorm.Expr("json_array_append(groups, ?)", groups)).Error
+	return d.updatePolicySubjects(name, func(policy *model.Policy) {
+		policy.Groups = appendUnique(policy.Groups, groups)
+	})
 }
 
 // RemoveGroupsFromPolicy
 func (d *DBService) RemoveGroupsFromPolicy(name string, groups []string) error {
-	return d.DB.Model(&model.Policy{}).Where("name = ?", name).Update("groups", gorm.Expr("json_remove(groups, ?)", groups)).Error
+	return d.updatePolicySubjects(name, func(policy *model.Policy) {
+		policy.Groups = removeAll(policy.Groups, groups)
+	})
+}
+
+// json 数组函数各个数据库不通用，这里读出来修改后整体写回
+func (d *DBService) updatePolicySubjects(name string, update func(policy *model.Policy)) error {
+	var ids []string
+	if err := d.DB.Model(&model.Policy{}).Where("name = ? and is_deleted = ?", name, false).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("policy %s not found", name)
+	}
+	return d.changePolicy(ids, model.RevisionUpdate, 0, func(tx *gorm.DB) error {
+		var policies []model.Policy
+		if err := tx.Where("id in ?", ids).Find(&policies).Error; err != nil {
+			return err
+		}
+		for _, policy := range policies {
+			update(&policy)
+			err := tx.Model(&policy).Updates(map[string]interface{}{
+				"users":  policy.Users,
+				"groups": policy.Groups,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func appendUnique(items model.ArrayString, adds []string) model.ArrayString {
+	for _, add := range adds {
+		if !slices.Contains(items, add) {
+			items = append(items, add)
+		}
+	}
+	return items
+}
+
+func removeAll(items model.ArrayString, removes []string) model.ArrayString {
+	res := model.ArrayString{}
+	for _, item := range items {
+		if !slices.Contains(removes, item) {
+			res = append(res, item)
+		}
+	}
+	return res
 }
 
 func (d *DBService) UpdateActionsOfPolicy(name string, actions []string) error {
 	return d.DB.Model(&model.Policy{}).Where("name = ?", name).Update("actions", actions).Error
 }
 
-// 只查询用户的策略
+// 只查询用户的策略，包括用户所在组的策略
 // 支持policy users 包含*的情况，表示都能命中
 func (d *DBService) QueryPolicyByUser(username string) ([]model.Policy, error) {
+	user, err := d.DescribeUser(username)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	// 已删除的用户不再匹配任何策略
+	if tea.BoolValue(user.IsDeleted) {
+		return nil, nil
+	}
+	if user.Username == nil {
+		user.Username = &username
+	}
 	sql := d.DB.Model(&model.Policy{}).Where("is_deleted = ?", false)
 	var policies []model.Policy
 	if err := sql.Find(&policies).Error; err != nil {
@@ -99,7 +277,7 @@ func (d *DBService) QueryPolicyByUser(username string) ([]model.Policy, error) {
 	var matchPolicies []model.Policy
 	// 精确返回
 	for _, policy := range policies {
-		if policy.Users.Contains(username) {
+		if policy.MatchSubject(user) != "" {
 			// log.Debugf("policy: %s", tea.Prettify(policy))
 			matchPolicies = append(matchPolicies, policy)
 		}
@@ -107,6 +285,22 @@ func (d *DBService) QueryPolicyByUser(username string) ([]model.Policy, error) {
 	return matchPolicies, nil
 }
 
+// 查询授予用户组的策略
+func (d *DBService) QueryPolicyByGroup(group string) ([]model.Policy, error) {
+	sql := d.DB.Model(&model.Policy{}).Where("is_deleted = ?", false)
+	var policies []model.Policy
+	if err := sql.Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	var matchPolicies []model.Policy
+	for _, policy := range policies {
+		if slices.Contains(policy.Groups, group) {
+			matchPolicies = append(matchPolicies, policy)
+		}
+	}
+	return matchPolicies, nil
+}
+
 // 查询策略名称
 func (d *DBService) QueryPolicyByName(name string) ([]model.Policy, error) {
 	sql := d.DB.Model(&model.Policy{}).Where("is_deleted = ?", false)
@@ -147,3 +341,55 @@ func (d *DBService) QueryAllPolicy() ([]model.Policy, error) {
 	}
 	return policies, nil
 }
+
+// 检查所有策略，用当前服务器和用户计算策略之间的重叠
+func (d *DBService) LintPolicies() (model.LintReport, error) {
+	policies, err := d.QueryAllPolicy()
+	if err != nil {
+		return model.LintReport{}, err
+	}
+	servers, err := d.LoadServer()
+	if err != nil {
+		return model.LintReport{}, err
+	}
+	users, err := d.QueryAllUser()
+	if err != nil {
+		return model.LintReport{}, err
+	}
+	var activeUsers []model.User
+	for _, user := range users {
+		if !tea.BoolValue(user.IsDeleted) {
+			activeUsers = append(activeUsers, user)
+		}
+	}
+	return model.LintPolicies(policies, servers, activeUsers, time.Now()), nil
+}
+
+// 还在等待外部审批结果的策略，早期钉钉审批处理后 approver 会写入 BusinessId
+func (d *DBService) ListPendingExternalApproval() ([]model.Policy, error) {
+	var policies []model.Policy
+	err := d.DB.Where("is_deleted = ? and approval_id <> ''", false).
+		Where("approval_status = ? or ((approval_status is null or approval_status = '') and (approver is null or approver not like ?))", model.ApprovalPending, "%BusinessId%").
+		Find(&policies).Error
+	return policies, err
+}
+
+// 按外部审批单 ID 查询策略，用于处理审批回调
+func (d *DBService) QueryPolicyByApprovalID(approvalID string) (*model.Policy, error) {
+	var policy model.Policy
+	if err := d.DB.Where("is_deleted = ? and approval_id = ?", false, approvalID).First(&policy).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// 外部审批结束，同步审批结果到策略
+func (d *DBService) CloseExternalApproval(id string, status model.ApprovalStatus, approver string) error {
+	return d.changePolicy([]string{id}, model.RevisionApprove, 0, func(tx *gorm.DB) error {
+		return tx.Model(&model.Policy{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"is_enabled":      status == model.ApprovalApproved,
+			"approver":        approver,
+			"approval_status": status,
+		}).Error
+	})
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/xops-infra/jms/model"
+	"gorm.io/gorm"
+)
+
+// 需要发送到期提醒的策略
+func (d *DBService) ListPolicyNeedExpireNotify(now time.Time, notifyBefore time.Duration) ([]model.Policy, error) {
+	var policies []model.Policy
+	err := d.DB.Where("is_deleted = ? and is_enabled = ? and expired = ?", false, true, false).
+		Where("expire_notified_at is null").
+		Where("expires_at > ? and expires_at <= ?", now, now.Add(notifyBefore)).
+		Find(&policies).Error
+	return policies, err
+}
+
+// 标记已经提醒，多个实例同时执行时只有一个会返回 true
+func (d *DBService) MarkPolicyExpireNotified(id string, now time.Time) (bool, error) {
+	res := d.DB.Model(&model.Policy{}).Where("id = ? and expire_notified_at is null", id).UpdateColumn("expire_notified_at", now)
+	return res.RowsAffected > 0, res.Error
+}
+
+// 标记过期的策略，返回本次标记的策略
+func (d *DBService) ExpirePolicies(now time.Time) ([]model.Policy, error) {
+	var policies []model.Policy
+	if err := d.DB.Where("is_deleted = ? and expired = ? and expires_at <= ?", false, false, now).Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	var expired []model.Policy
+	for _, policy := range policies {
+		err := d.WithAuthor(model.RevisionAuthorSystem).changePolicy([]string{policy.ID}, model.RevisionExpire, 0, func(tx *gorm.DB) error {
+			res := tx.Model(&model.Policy{}).Where("id = ? and expired = ?", policy.ID, false).UpdateColumn("expired", true)
+			if res.Error == nil && res.RowsAffected == 0 {
+				// 已经被其他实例标记，回滚不记录版本
+				return gorm.ErrRecordNotFound
+			}
+			return res.Error
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		policy.Expired = true
+		expired = append(expired, policy)
+	}
+	return expired, nil
+}
+
+// 授予该用户的即将过期或者刚过期的策略，用于 PUI 续期
+func (d *DBService) ListRenewablePolicy(username string, now time.Time, notifyBefore time.Duration) ([]model.Policy, error) {
+	policies, err := d.QueryPolicyByUser(username)
+	if err != nil {
+		return nil, err
+	}
+	var renewable []model.Policy
+	for _, policy := range policies {
+		if policy.CanRenew(username, now, notifyBefore) {
+			renewable = append(renewable, policy)
+		}
+	}
+	return renewable, nil
+}
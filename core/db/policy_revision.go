@@ -0,0 +1,122 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xops-infra/jms/model"
+	"gorm.io/gorm"
+)
+
+// WithAuthor 返回记录操作人的 DBService，策略变更的版本记录会带上操作人
+func (d *DBService) WithAuthor(author string) *DBService {
+	return &DBService{DB: d.DB, author: author, afterCommit: d.afterCommit}
+}
+
+// OnPolicyChange 策略变更提交后调用，用于推送审计事件，基线快照不会触发，外层事务回滚也不会触发
+var OnPolicyChange func(policy model.Policy, action model.RevisionAction, author string)
+
+// 在事务里变更策略，变更前没有版本记录的补一份基线快照，变更后记录新版本
+func (d *DBService) changePolicy(ids []string, action model.RevisionAction, restoreFrom int, change func(tx *gorm.DB) error) error {
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			var count int64
+			if err := tx.Model(&model.PolicyRevision{}).Where("policy_id = ?", id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 || action == model.RevisionCreate {
+				continue
+			}
+			if err := addPolicyRevision(tx, id, model.RevisionBaseline, model.RevisionAuthorSystem, 0); err != nil {
+				return err
+			}
+		}
+		if err := change(tx); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := addPolicyRevision(tx, id, action, d.author, restoreFrom); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || OnPolicyChange == nil {
+		return err
+	}
+	for _, id := range ids {
+		var policy model.Policy
+		if err := d.DB.Where("id = ?", id).First(&policy).Error; err != nil {
+			continue
+		}
+		author := d.author
+		d.afterCommitDo(func() { OnPolicyChange(policy, action, author) })
+	}
+	return nil
+}
+
+func addPolicyRevision(tx *gorm.DB, id string, action model.RevisionAction, author string, restoreFrom int) error {
+	var policy model.Policy
+	if err := tx.Where("id = ?", id).First(&policy).Error; err != nil {
+		return err
+	}
+	var last int
+	if err := tx.Model(&model.PolicyRevision{}).Where("policy_id = ?", id).Select("coalesce(max(revision), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+	revision, err := model.NewPolicyRevision(policy, last+1, action, author, restoreFrom)
+	if err != nil {
+		return err
+	}
+	return tx.Create(revision).Error
+}
+
+func (d *DBService) ListPolicyRevision(id string) ([]model.PolicyRevision, error) {
+	var revisions []model.PolicyRevision
+	if err := d.DB.Where("policy_id = ?", id).Order("revision desc").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (d *DBService) QueryPolicyRevision(id string, revision int) (*model.PolicyRevision, error) {
+	var rev model.PolicyRevision
+	if err := d.DB.Where("policy_id = ? and revision = ?", id, revision).First(&rev).Error; err != nil {
+		return nil, fmt.Errorf("policy %s revision %d not found: %s", id, revision, err)
+	}
+	return &rev, nil
+}
+
+func (d *DBService) DiffPolicyRevision(id string, from, to int) (*model.PolicyRevisionDiff, error) {
+	fromRev, err := d.QueryPolicyRevision(id, from)
+	if err != nil {
+		return nil, err
+	}
+	toRev, err := d.QueryPolicyRevision(id, to)
+	if err != nil {
+		return nil, err
+	}
+	return model.DiffPolicyRevision(*fromRev, *toRev)
+}
+
+// RestorePolicyRevision 用历史版本快照覆盖当前策略，恢复本身也会记录为新版本
+func (d *DBService) RestorePolicyRevision(id string, revision int) error {
+	rev, err := d.QueryPolicyRevision(id, revision)
+	if err != nil {
+		return err
+	}
+	policy, err := rev.Policy()
+	if err != nil {
+		return err
+	}
+	if policy.ServerFilterV1 != nil {
+		if err := policy.ServerFilterV1.Validate(); err != nil {
+			return err
+		}
+	}
+	policy.ID = id
+	policy.UpdatedAt = time.Now()
+	return d.changePolicy([]string{id}, model.RevisionRestore, revision, func(tx *gorm.DB) error {
+		return tx.Model(&model.Policy{}).Where("id = ?", id).Select("*").Omit("id", "created_at").Updates(policy).Error
+	})
+}
@@ -0,0 +1,63 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/model"
+)
+
+// 修改策略后请求里带上的字段都能写入，没带上的字段不变
+func TestUpdatePolicy_RoundTrip(t *testing.T) {
+	d := newTestDB(t, &model.Policy{}, &model.PolicyRevision{})
+	expiresAt := time.Now().Add(time.Hour)
+	id, err := d.CreatePolicy(&model.PolicyRequest{
+		Name:           tea.String("vpn-only"),
+		Users:          model.ArrayString{"alice"},
+		Actions:        model.ArrayString{string(model.Connect)},
+		ServerFilterV1: &model.ServerFilterV1{EnvType: []string{"dev"}},
+		ExpiresAt:      &expiresAt,
+		SourceCIDRs:    model.ArrayString{"10.8.0.0/16"},
+	})
+	assert.NoError(t, err)
+
+	renewAt := expiresAt.Add(24 * time.Hour)
+	err = d.UpdatePolicy(id, &model.PolicyRequest{
+		ServerFilterV1: &model.ServerFilterV1{EnvType: []string{"prod"}},
+		SourceCIDRs:    model.ArrayString{"10.9.0.0/16", "192.168.1.1"},
+		LoginUsers:     model.ArrayString{"ec2-user"},
+		Groups:         model.ArrayString{"sre"},
+		Name:           tea.String("vpn-only-prod"),
+		ExpiresAt:      &renewAt,
+		IsEnabled:      tea.Bool(true),
+		Schedule:       &model.PolicySchedule{Start: "09:00", End: "19:00"},
+		Justification:  tea.String("oncall"),
+		TicketID:       tea.String("OPS-1"),
+	})
+	assert.NoError(t, err)
+
+	policy, err := d.QueryPolicyById(id)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ArrayString{"10.9.0.0/16", "192.168.1.1"}, policy.SourceCIDRs)
+	assert.Equal(t, model.ArrayString{"ec2-user"}, policy.LoginUsers)
+	assert.Equal(t, model.ArrayString{"sre"}, policy.Groups)
+	assert.Equal(t, []string{"prod"}, policy.ServerFilterV1.EnvType)
+	assert.Equal(t, model.ArrayString{"alice"}, policy.Users)
+	assert.Equal(t, model.ArrayString{string(model.Connect)}, policy.Actions)
+	assert.Equal(t, "vpn-only-prod", policy.Name)
+	assert.True(t, renewAt.Equal(policy.ExpiresAt))
+	assert.True(t, policy.IsEnabled)
+	assert.Equal(t, "09:00", policy.Schedule.Start)
+	assert.Equal(t, "oncall", policy.Justification)
+	assert.Equal(t, "OPS-1", policy.TicketID)
+
+	// is_enabled 为 false 也要写入
+	assert.NoError(t, d.UpdatePolicy(id, &model.PolicyRequest{IsEnabled: tea.Bool(false)}))
+	policy, err = d.QueryPolicyById(id)
+	assert.NoError(t, err)
+	assert.False(t, policy.IsEnabled)
+	assert.Equal(t, "vpn-only-prod", policy.Name)
+}
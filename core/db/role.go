@@ -0,0 +1,83 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/xops-infra/jms/model"
+	"gorm.io/gorm"
+)
+
+func (d *DBService) ListRoleBinding() ([]model.RoleBinding, error) {
+	var bindings []model.RoleBinding
+	err := d.DB.Where("is_delete is false").Order("created_at").Find(&bindings).Error
+	return bindings, err
+}
+
+// 支持判断是否重复授予
+func (d *DBService) CreateRoleBinding(req model.RoleBindingRequest) (string, error) {
+	if err := req.Validate(); err != nil {
+		return "", err
+	}
+	var count int64
+	err := d.DB.Model(&model.RoleBinding{}).Where("role = ? and subject = ? and is_delete is false", *req.Role, *req.Subject).Count(&count).Error
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "", fmt.Errorf("role %s already bound to %s", *req.Role, *req.Subject)
+	}
+	binding := &model.RoleBinding{
+		UUID:    uuid.NewString(),
+		Role:    *req.Role,
+		Subject: *req.Subject,
+	}
+	return binding.UUID, d.DB.Create(binding).Error
+}
+
+func (d *DBService) GetRoleBinding(uuid string) (*model.RoleBinding, error) {
+	var binding model.RoleBinding
+	err := d.DB.Where("uuid = ? and is_delete is false", uuid).First(&binding).Error
+	if err != nil {
+		return nil, err
+	}
+	return &binding, nil
+}
+
+func (d *DBService) DeleteRoleBinding(uuid string) error {
+	var binding model.RoleBinding
+	err := d.DB.Where("uuid = ? and is_delete is false", uuid).First(&binding).Error
+	if err != nil {
+		return err
+	}
+	return d.DB.Model(&binding).Update("is_delete", true).Error
+}
+
+// 获取用户所有角色，包括用户组授予的角色
+// admin 组默认拥有 admin 角色，兼容之前的 admin 组判断
+func (d *DBService) GetUserRoles(username string) (model.Roles, error) {
+	subjects := []string{model.UserSubject(username)}
+	var roles model.Roles
+
+	user, err := d.DescribeUser(username)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	for _, group := range user.Groups {
+		if group == string(model.RoleAdmin) {
+			roles = append(roles, model.RoleAdmin)
+		}
+		subjects = append(subjects, model.GroupSubject(group))
+	}
+
+	var bindings []model.RoleBinding
+	err = d.DB.Where("subject in ? and is_delete is false", subjects).Find(&bindings).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, binding := range bindings {
+		roles = append(roles, binding.Role)
+	}
+	return roles, nil
+}
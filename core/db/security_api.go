@@ -0,0 +1,36 @@
+package db
+
+import (
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/xops-infra/jms/model"
+)
+
+func (d *DBService) AddApiDenyRecord(req *model.AddApiDenyRecordRequest) error {
+	record := &model.ApiDenyRecord{
+		User:     tea.StringValue(req.User),
+		Client:   tea.StringValue(req.Client),
+		Method:   tea.StringValue(req.Method),
+		Path:     tea.StringValue(req.Path),
+		Required: tea.StringValue(req.Required),
+	}
+	return d.DB.Create(record).Error
+}
+
+// ListApiDenyRecord
+func (d *DBService) ListApiDenyRecord(req model.QueryApiDenyRequest) (records []model.ApiDenyRecord, err error) {
+	sql := d.DB.Model(&model.ApiDenyRecord{})
+	if req.Duration != nil {
+		sql = sql.Where("created_at >= ?", time.Now().Add(-time.Hour*time.Duration(*req.Duration)))
+	} else {
+		sql = sql.Where("created_at >= ?", time.Now().AddDate(0, 0, -1))
+	}
+	if req.User != nil {
+		sql = sql.Where("\"user\" = ?", *req.User)
+	}
+	if req.Path != nil {
+		sql = sql.Where("path like ?", "%"+*req.Path+"%")
+	}
+	return records, sql.Find(&records).Error
+}
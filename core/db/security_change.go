@@ -0,0 +1,61 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/xops-infra/jms/model"
+)
+
+// 变更前后的数据会脱敏后入库
+func (d *DBService) AddApiChangeRecord(req *model.AddApiChangeRequest) error {
+	before := model.ToRedactedMap(req.Before)
+	after := model.ToRedactedMap(req.After)
+	record := &model.ApiChangeRecord{
+		Actor:      tea.StringValue(req.Actor),
+		Client:     tea.StringValue(req.Client),
+		Resource:   tea.StringValue(req.Resource),
+		ResourceID: tea.StringValue(req.ResourceID),
+	}
+	if req.Action != nil {
+		record.Action = string(*req.Action)
+	}
+	if before != nil {
+		data, _ := json.Marshal(before)
+		record.Before = string(data)
+	}
+	if after != nil {
+		data, _ := json.Marshal(after)
+		record.After = string(data)
+	}
+	diff, err := json.Marshal(model.DiffChange(before, after))
+	if err != nil {
+		return err
+	}
+	record.Diff = string(diff)
+	return d.DB.Create(record).Error
+}
+
+// ListApiChangeRecord
+func (d *DBService) ListApiChangeRecord(req model.QueryApiChangeRequest) (records []model.ApiChangeRecord, err error) {
+	sql := d.DB.Model(&model.ApiChangeRecord{})
+	if req.Duration != nil {
+		sql = sql.Where("created_at >= ?", time.Now().Add(-time.Hour*time.Duration(*req.Duration)))
+	} else {
+		sql = sql.Where("created_at >= ?", time.Now().AddDate(0, 0, -1))
+	}
+	if req.Actor != nil {
+		sql = sql.Where("actor = ?", *req.Actor)
+	}
+	if req.Action != nil {
+		sql = sql.Where("action = ?", *req.Action)
+	}
+	if req.Resource != nil {
+		sql = sql.Where("resource = ?", *req.Resource)
+	}
+	if req.ResourceID != nil {
+		sql = sql.Where("resource_id = ?", *req.ResourceID)
+	}
+	return records, sql.Order("created_at desc").Find(&records).Error
+}
@@ -12,7 +12,9 @@ import (
 )
 
 type DBService struct {
-	DB *gorm.DB
+	DB          *gorm.DB
+	author      string    // 操作人，见 WithAuthor
+	afterCommit *[]func() // 在 transaction 里时，事务提交后才执行的回调，如推送审计事件
 }
 
 func NewJmsDbService(db *gorm.DB) *DBService {
@@ -21,6 +23,31 @@ func NewJmsDbService(db *gorm.DB) *DBService {
 	}
 }
 
+// 在一个事务里执行多个操作，fn 收到的 DBService 所有读写都走这个事务
+// 事务里的策略变更事件等提交后再推送，回滚时不推送；嵌套调用时使用 savepoint，事件交给外层事务
+func (d *DBService) transaction(fn func(tx *DBService) error) error {
+	var events []func()
+	err := d.DB.Transaction(func(db *gorm.DB) error {
+		return fn(&DBService{DB: db, author: d.author, afterCommit: &events})
+	})
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		d.afterCommitDo(event)
+	}
+	return nil
+}
+
+// 在事务里时等事务提交后执行，否则直接执行
+func (d *DBService) afterCommitDo(fn func()) {
+	if d.afterCommit != nil {
+		*d.afterCommit = append(*d.afterCommit, fn)
+		return
+	}
+	fn()
+}
+
 // getServerCount
 func (d *DBService) GetServerCount() int {
 	var count int64
@@ -29,17 +56,14 @@ func (d *DBService) GetServerCount() int {
 }
 
 func (d *DBService) NeedApprove(username string) ([]*Policy, error) {
-	// 是否 admin组，且有需要审批的策略
+	// 是否有审批角色(admin 组默认有)，且有需要审批的策略
 	var policies []*Policy
-	user, err := d.DescribeUser(username)
+	roles, err := d.GetUserRoles(username)
 	if err != nil {
 		return nil, err
 	}
-	if user.Groups == nil {
-		return nil, nil
-	}
-	if user.Groups.Contains("admin") {
-		if err := d.DB.Where("is_enabled = ?", false).Where("approver is null").Find(&policies).Error; err != nil {
+	if roles.Has(RoleApprover) {
+		if err := d.DB.Where("is_enabled = ? and expired = ?", false, false).Where("approver is null").Find(&policies).Error; err != nil {
 			return nil, err
 		}
 	}
@@ -60,6 +84,14 @@ func (d *DBService) DescribeUser(name string) (User, error) {
 	return user, nil
 }
 
+func (d *DBService) GetUserByID(id string) (*User, error) {
+	var user User
+	if err := d.DB.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (d *DBService) QueryUserByGroup(group string) ([]User, error) {
 	var users []User
 	// json 字段不支持like查询
@@ -92,6 +124,7 @@ func (d *DBService) CreateUser(req *UserRequest) (string, error) {
 		Groups:         req.Groups,
 		DingtalkID:     req.DingtalkID,
 		DingtalkDeptID: req.DingtalkDeptID,
+		FeishuID:       req.FeishuID,
 	}
 	if req.Passwd != nil {
 		// base64加密
@@ -122,6 +155,11 @@ func (d *DBService) UpdateUser(id string, req UserRequest) error {
 	return d.DB.Model(&User{}).Where("id = ?", id).Updates(req).Error
 }
 
+// 软删除，删除后不能再登录
+func (d *DBService) DeleteUser(id string) error {
+	return d.DB.Model(&User{}).Where("id = ?", id).Update("is_deleted", true).Error
+}
+
 func (d *DBService) PatchUserGroup(id string, req *UserPatchMut) error {
 	// 先依据 id查到用户
 	var user User
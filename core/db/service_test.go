@@ -1,21 +1,49 @@
 package db_test
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
 	"github.com/xops-infra/noop/log"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 
 	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/db"
 	"github.com/xops-infra/jms/model"
 )
 
+const configFile = "/opt/jms/config.yaml"
+
+// 集成测试依赖本机配置和数据库，没有配置时跳过，其他测试使用临时 sqlite 数据库
 func init() {
-	app.NewApplication(true, "", "---", "/opt/jms/config.yaml").WithDB(false)
+	if _, err := os.Stat(configFile); err != nil {
+		log.Default().WithLevel(log.InfoLevel).WithFilename("/tmp/test.log").Init()
+		return
+	}
+	app.NewApplication(true, "", "---", configFile).WithDB(false)
+}
+
+func requireConfig(t *testing.T) {
+	if app.App == nil {
+		t.Skipf("%s not found, skip integration test", configFile)
+	}
+}
+
+// 临时 sqlite 数据库，不依赖全局配置
+func newTestDB(t *testing.T, models ...interface{}) *db.DBService {
+	rdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "jms.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, rdb.AutoMigrate(models...))
+	return db.NewJmsDbService(rdb)
 }
 
 func TestCreatePolicy(t *testing.T) {
+	requireConfig(t)
 	expiredAt := time.Now().Add(time.Hour * 24 * 365 * 100)
 	req := model.PolicyRequest{
 		Name:  tea.String("zhoushoujian-test-!-manual"),
@@ -36,6 +64,7 @@ func TestCreatePolicy(t *testing.T) {
 
 // TEST UpdatePolicy
 func TestUpdatePolicy(t *testing.T) {
+	requireConfig(t)
 	// {"name":null,"ip_addr":["39.101.72.129"],"env_type":null,"team":null}
 	req := model.PolicyRequest{
 		Users: model.ArrayString{"xupeng", "fangyan",
@@ -50,6 +79,7 @@ func TestUpdatePolicy(t *testing.T) {
 }
 
 func TestDeletePolicy(t *testing.T) {
+	requireConfig(t)
 	err := app.App.DBIo.DeletePolicy("default")
 	if err != nil {
 		t.Error(err)
@@ -58,6 +88,7 @@ func TestDeletePolicy(t *testing.T) {
 }
 
 func TestUpdateUserGroups(t *testing.T) {
+	requireConfig(t)
 	err := app.App.DBIo.UpdateUser("yaolong", model.UserRequest{
 		Groups: model.ArrayString{"admin"},
 	})
@@ -67,6 +98,7 @@ func TestUpdateUserGroups(t *testing.T) {
 }
 
 func TestQueryPolicy(t *testing.T) {
+	requireConfig(t)
 	result, err := app.App.DBIo.QueryAllPolicy()
 	if err != nil {
 		t.Error(err)
@@ -76,6 +108,7 @@ func TestQueryPolicy(t *testing.T) {
 }
 
 func TestQueryUser(t *testing.T) {
+	requireConfig(t)
 	result, err := app.App.DBIo.DescribeUser("zhoushoujian")
 	if err != nil {
 		t.Error(err)
@@ -85,6 +118,7 @@ func TestQueryUser(t *testing.T) {
 }
 
 func TestQueryPolicyByUser(t *testing.T) {
+	requireConfig(t)
 	result, err := app.App.DBIo.QueryPolicyByUser("zhoushoujian")
 	if err != nil {
 		t.Error(err)
@@ -95,6 +129,7 @@ func TestQueryPolicyByUser(t *testing.T) {
 
 // TEST ListServerLoginRecord
 func TestListServerLoginRecord(t *testing.T) {
+	requireConfig(t)
 	req := model.QueryLoginRequest{
 		Duration: tea.Int(4),
 		User:     tea.String("zhoushoujian"),
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xops-infra/jms/model"
+)
+
+func hashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 创建个人访问令牌，令牌明文只在这里返回一次，库里只存 hash
+func (d *DBService) CreateApiToken(username string, req model.CreateApiTokenRequest) (*model.CreateApiTokenResponse, error) {
+	if username == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+	if req.Name == nil {
+		return nil, fmt.Errorf("name is required")
+	}
+	var scopes model.ArrayString
+	for _, scope := range req.Scopes {
+		if !scope.IsValid() {
+			return nil, fmt.Errorf("invalid scope %s, must be one of %v", scope, model.AllRoles)
+		}
+		scopes = append(scopes, string(scope))
+	}
+	days := 90
+	if req.ExpiresDays != nil && *req.ExpiresDays > 0 {
+		days = *req.ExpiresDays
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	token := model.ApiTokenPrefix + hex.EncodeToString(buf)
+	apiToken := &model.ApiToken{
+		UUID:      uuid.NewString(),
+		Name:      *req.Name,
+		User:      username,
+		TokenHash: hashApiToken(token),
+		Prefix:    token[:len(model.ApiTokenPrefix)+6],
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(time.Duration(days) * 24 * time.Hour),
+	}
+	if err := d.DB.Create(apiToken).Error; err != nil {
+		return nil, err
+	}
+	return &model.CreateApiTokenResponse{
+		UUID:      apiToken.UUID,
+		Token:     token,
+		ExpiresAt: apiToken.ExpiresAt,
+	}, nil
+}
+
+// user 为空查询所有
+func (d *DBService) ListApiToken(username string) ([]model.ApiToken, error) {
+	sql := d.DB.Model(&model.ApiToken{}).Where("is_delete is false")
+	if username != "" {
+		sql = sql.Where("\"user\" = ?", username)
+	}
+	var tokens []model.ApiToken
+	err := sql.Order("created_at").Find(&tokens).Error
+	return tokens, err
+}
+
+func (d *DBService) GetApiToken(uuid string) (*model.ApiToken, error) {
+	var token model.ApiToken
+	err := d.DB.Where("uuid = ? and is_delete is false", uuid).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// username 不为空时只能删除自己的令牌
+func (d *DBService) DeleteApiToken(uuid, username string) error {
+	sql := d.DB.Where("uuid = ? and is_delete is false", uuid)
+	if username != "" {
+		sql = sql.Where("\"user\" = ?", username)
+	}
+	var token model.ApiToken
+	if err := sql.First(&token).Error; err != nil {
+		return err
+	}
+	return d.DB.Model(&token).Update("is_delete", true).Error
+}
+
+// 校验令牌，并记录最后使用时间和 IP
+func (d *DBService) AuthApiToken(token, clientIP string) (*model.ApiToken, error) {
+	var apiToken model.ApiToken
+	err := d.DB.Where("token_hash = ? and is_delete is false", hashApiToken(token)).First(&apiToken).Error
+	if err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+	if apiToken.IsExpired() {
+		return nil, fmt.Errorf("token expired")
+	}
+	now := time.Now()
+	err = d.DB.Model(&apiToken).Updates(map[string]interface{}{
+		"last_used_at": now,
+		"last_used_ip": clientIP,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return &apiToken, nil
+}
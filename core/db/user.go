@@ -2,6 +2,7 @@ package db
 
 import (
 	"encoding/base64"
+	"fmt"
 
 	"github.com/alibabacloud-go/tea/tea"
 	. "github.com/xops-infra/jms/model"
@@ -13,6 +14,9 @@ func (d *DBService) Login(username, password string) (bool, error) {
 	if err := d.DB.Where("username = ?", username).First(&user).Error; err != nil {
 		return false, err
 	}
+	if tea.BoolValue(user.IsDeleted) {
+		return false, fmt.Errorf("user %s is deleted", username)
+	}
 	// bas64 加密后比较
 	base64Pass := base64.StdEncoding.EncodeToString([]byte(password))
 	return base64Pass == tea.StringValue(user.Passwd), nil
@@ -1,7 +1,6 @@
 package dingtalk
 
 import (
-	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -15,37 +14,6 @@ import (
 	. "github.com/xops-infra/jms/model"
 )
 
-var robot *dt.RobotClient
-
-func init() {
-	robot = dt.NewRobotClient()
-}
-
-func CreateApproval(applicant string, values []dt.FormComponentValue) (string, error) {
-
-	user, err := app.App.DBIo.DescribeUser(applicant)
-	if err != nil {
-		return "", err
-	}
-	log.Debugf(tea.Prettify(user), tea.Prettify(values))
-	if user.DingtalkID == nil || user.DingtalkDeptID == nil {
-		return "", fmt.Errorf("get user %s dingtalkid or dingtalkdeptid failed", applicant)
-	}
-
-	// 主动刷新token
-	err = app.App.Scheduler.DingTalkClient.SetAccessToken()
-	if err != nil {
-		log.Errorf("SetAccessToken failed! %s", err)
-		return "", err
-	}
-	return app.App.Scheduler.DingTalkClient.Workflow.CreateProcessInstance(&dt.CreateProcessInstanceInput{
-		ProcessCode:         app.App.Config.WithDingtalk.ProcessCode,
-		OriginatorUserID:    tea.StringValue(user.DingtalkID),
-		DeptId:              tea.StringValue(user.DingtalkDeptID),
-		FormComponentValues: values,
-	}, app.App.Scheduler.DingTalkClient.AccessToken.Token)
-}
-
 // 同步钉钉用户到数据库user表
 func LoadUsers() error {
 	err := app.App.Scheduler.DingTalkClient.SetAccessToken()
@@ -139,89 +107,3 @@ func saveDingtalkUsers(users []*dt.UserInfo) error {
 	}
 	return nil
 }
-
-// 本地审批列表到云上获取审批状态并更新。
-func LoadApproval() {
-	timeStart := time.Now()
-	var successes []string
-	err := app.App.Scheduler.DingTalkClient.SetAccessToken() // 更新 token
-	if err != nil {
-		log.Errorf("SetAccessToken failed! %s", err)
-		return
-	}
-	log.Infof("tonkens: %s", app.App.Scheduler.DingTalkClient.AccessToken.Token)
-	// 获取审批列表
-	policies, err := app.App.DBIo.QueryAllPolicy()
-	if err != nil {
-		log.Errorf("QueryAllPolicy failed! %s", err)
-		return
-	}
-	for _, policy := range policies {
-		if policy.ApprovalID == "" {
-			continue
-		}
-		if strings.Contains(policy.Approver, "BusinessId") {
-			// 已经更新过的审批不再更新
-			continue
-		}
-		resp, err := app.App.Scheduler.DingTalkClient.Workflow.GetProcessInstance(policy.ApprovalID, app.App.Scheduler.DingTalkClient.AccessToken.Token)
-		if err != nil {
-			log.Errorf("GetProcessInstance failed! %s", err)
-		}
-		// 更新
-		if !resp.Success {
-			continue
-		}
-		if resp.Result.Result != nil {
-			update := ApprovalResult{
-				Applicant: tea.String(fmt.Sprintf("%s: %s", "BusinessId", *resp.Result.BusinessId)),
-				IsPass:    tea.Bool(false),
-			}
-			switch *resp.Result.Status {
-			case "COMPLETED":
-				if *resp.Result.Result == "agree" {
-					update.IsPass = tea.Bool(true)
-				}
-			case "TERMINATED":
-				update.Applicant = tea.String("BusinessId: TERMINATED")
-				update.IsPass = tea.Bool(false)
-			default:
-				continue
-			}
-			err = app.App.DBIo.UpdatePolicyStatus(policy.ID, update)
-			if err != nil {
-				log.Errorf("UpdatePolicyStatus failed! %s", err)
-				continue
-			}
-			successes = append(successes, *resp.Result.BusinessId)
-			log.Infof("update dingtalk approval %s(%s) to %v from DTCloud", *resp.Result.BusinessId, *resp.Result.Title, *update.IsPass)
-		}
-	}
-	log.Infof("load dingtalk approval success, %d/%d, cost %v", len(successes), len(policies), time.Since(timeStart))
-}
-
-// 发送钉钉机器人通知
-func SendRobotText(robotToken, content, userID string) error {
-	if robotToken == "" {
-		return fmt.Errorf("robot token is empty, can not send robot message")
-	}
-	// 发送通知
-	err := robot.SendMessage(context.Background(), &dt.SendMessageRequest{
-		AccessToken: robotToken,
-		MessageContent: dt.MessageContent{
-			MsgType: "text",
-			Text: dt.TextBody{
-				Content: content,
-			},
-			At: dt.AtBody{
-				AtUserIDS: []string{userID},
-			},
-		},
-	})
-	if err != nil {
-		if strings.Contains(err.Error(), "ok") {
-			return nil
-		}
-	}
-	return err
-}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/notify"
+	"github.com/xops-infra/jms/model"
+)
+
+// 临时策略到期管理：到期前提醒用户和审批人，到期后标记过期
+// 断开依赖过期策略的会话由 sshd 的 SessionScheduleChecker 完成
+func PolicyExpiryChecker() {
+	startTime := time.Now()
+	defer func() {
+		log.Debugf("PolicyExpiryChecker cost: %s", time.Since(startTime))
+	}()
+	conf := app.App.Config.WithPolicyExpiry
+	policies, err := app.App.DBIo.ListPolicyNeedExpireNotify(startTime, conf.GetNotifyBefore())
+	if err != nil {
+		log.Errorf("list expiring policy error: %s", err)
+	}
+	for _, policy := range policies {
+		ok, err := app.App.DBIo.MarkPolicyExpireNotified(policy.ID, startTime)
+		if err != nil {
+			log.Errorf("mark policy %s expire notified error: %s", policy.ID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		log.Infof("policy %s will expire at %s", policy.Name, policy.ExpiresAt)
+		notify.Send(model.Notification{
+			Event: model.EventPolicyExpire,
+			Title: fmt.Sprintf("[jms] 策略 %s 即将到期", policy.Name),
+			Text:  policy.ExpireNotifyMessage(),
+			Data:  map[string]interface{}{"policy": policy.Name, "users": policy.Users, "expires_at": policy.ExpiresAt},
+			To:    expiryRecipients(policy),
+		})
+	}
+	if len(policies) > 0 && !notify.Routed(model.EventPolicyExpire) {
+		log.Warnf("no withNotify route for %s, expiring policies only shown in PUI", model.EventPolicyExpire)
+	}
+
+	expired, err := app.App.DBIo.ExpirePolicies(startTime)
+	if err != nil {
+		log.Errorf("mark expired policy error: %s", err)
+	}
+	for _, policy := range expired {
+		log.Infof("policy %s expired at %s", policy.Name, policy.ExpiresAt)
+	}
+}
+
+// 到期提醒发给策略的用户和审批人，数据库里没有的用户只带上用户名
+func expiryRecipients(policy model.Policy) []model.NotifyRecipient {
+	var recipients []model.NotifyRecipient
+	for _, name := range policy.ExpireNotifyUsers() {
+		user, err := app.App.DBIo.DescribeUser(name)
+		if err != nil {
+			recipients = append(recipients, model.NotifyRecipient{Username: name})
+			continue
+		}
+		recipients = append(recipients, model.NewNotifyRecipient(user))
+	}
+	return recipients
+}
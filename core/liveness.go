@@ -1,19 +1,19 @@
 package core
 
 import (
-	"context"
 	"fmt"
 	"time"
 
-	dt "github.com/xops-infra/go-dingtalk-sdk-wrapper"
 	"github.com/xops-infra/noop/log"
 
 	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/notify"
 	"github.com/xops-infra/jms/core/sshd"
+	"github.com/xops-infra/jms/model"
 )
 
-// dingtalkToken 为钉钉机器人的token
-func ServerLiveness(dingtalkToken string) {
+// 检查配置的服务器 ssh 可连接性，失联和恢复时发送 liveness 通知
+func ServerLiveness() {
 	timeStart := time.Now()
 	servers, err := app.App.DBIo.LoadServer()
 	if err != nil {
@@ -32,7 +32,7 @@ func ServerLiveness(dingtalkToken string) {
 	for _, checkIp := range app.App.Config.WithSSHCheck.IPS {
 		if _, ok := serversMap[checkIp]; !ok {
 			log.Errorf("server liveness check error: %s not found", checkIp)
-			SendMessage(dingtalkToken, fmt.Sprintf("（紧急）机器 %s 不存在，请检查机器是否存在，若已经下线请及时更新配置", checkIp))
+			sendLiveness(checkIp, "", "not_found", fmt.Sprintf("（紧急）机器 %s 不存在，请检查机器是否存在，若已经下线请及时更新配置", checkIp))
 			continue
 		}
 		server := serversMap[checkIp]
@@ -51,7 +51,7 @@ func ServerLiveness(dingtalkToken string) {
 					return
 				}
 				app.App.Config.WithSSHCheck.LivenessCache.Add(server.Host, 1, 0)
-				SendMessage(dingtalkToken, fmt.Sprintf("（紧急）机器ssh连接失败，请检查机器是否失联！\n机器名称：%s\n机器IP：%s\n登录用户：%s\n告警时间：%s\n错误信息：%s", server.Name, server.Host,
+				sendLiveness(server.Host, server.Name, "down", fmt.Sprintf("（紧急）机器ssh连接失败，请检查机器是否失联！\n机器名称：%s\n机器IP：%s\n登录用户：%s\n告警时间：%s\n错误信息：%s", server.Name, server.Host,
 					sshUser.UserName, time.Now().Format(time.RFC3339), err))
 				continue
 			}
@@ -74,7 +74,7 @@ func ServerLiveness(dingtalkToken string) {
 
 			_, found := app.App.Config.WithSSHCheck.LivenessCache.Get(server.Host)
 			if found {
-				SendMessage(dingtalkToken, fmt.Sprintf("机器ssh连接已经恢复！\n机器名称：%s\n机器IP：%s\n告警时间：%s\n登录用户：%s", server.Name, server.Host, time.Now().Format(time.RFC3339), sshUser.UserName))
+				sendLiveness(server.Host, server.Name, "recovered", fmt.Sprintf("机器ssh连接已经恢复！\n机器名称：%s\n机器IP：%s\n告警时间：%s\n登录用户：%s", server.Name, server.Host, time.Now().Format(time.RFC3339), sshUser.UserName))
 				app.App.Config.WithSSHCheck.LivenessCache.Delete(server.Host)
 			}
 			break // 只检查一个
@@ -84,20 +84,13 @@ func ServerLiveness(dingtalkToken string) {
 	log.Infof("server liveness check done cost: %s", time.Since(timeStart))
 }
 
-// 发送到群里
-func SendMessage(token, msg string) {
-	log.Infof("send dingtalk msg: %s", msg)
-	err := app.App.Scheduler.RobotClient.SendMessage(context.Background(), &dt.SendMessageRequest{
-		AccessToken: token,
-		MessageContent: dt.MessageContent{
-			MsgType: "text",
-			Text: dt.TextBody{
-				Content: msg,
-			},
-		},
+// status 为 not_found, down, recovered
+func sendLiveness(host, name, status, msg string) {
+	log.Infof("send liveness notify: %s", msg)
+	notify.Send(model.Notification{
+		Event: model.EventLiveness,
+		Title: fmt.Sprintf("[jms] %s %s", host, status),
+		Text:  msg,
+		Data:  map[string]interface{}{"host": host, "name": name, "status": status},
 	})
-	if err != nil {
-		log.Errorf("send dingtalk msg error: %s", err)
-	}
-	log.Infof("send dingtalk msg: %s", msg)
 }
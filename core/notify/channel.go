@@ -0,0 +1,255 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xops-infra/jms/model"
+)
+
+const defaultDingtalkRobotURL = "https://oapi.dingtalk.com/robot/send"
+
+// Channel 通知渠道，title 和 text 为路由模板渲染后的内容
+type Channel interface {
+	Send(title, text string, n model.Notification) error
+}
+
+// NewChannel 按类型创建渠道
+func NewChannel(conf model.NotifyChannel) (Channel, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	switch conf.Type {
+	case model.ChannelWebhook:
+		return &webhook{url: conf.URL, headers: conf.Headers, client: client}, nil
+	case model.ChannelWecom:
+		return &wecom{url: conf.URL, client: client}, nil
+	case model.ChannelSlack:
+		return &slack{url: conf.URL, client: client}, nil
+	case model.ChannelDingtalk:
+		robotURL := conf.URL
+		if robotURL == "" {
+			robotURL = defaultDingtalkRobotURL + "?access_token=" + url.QueryEscape(conf.Token)
+		}
+		return &dingtalk{url: robotURL, client: client}, nil
+	case model.ChannelEmail:
+		return &email{conf: conf.SMTP}, nil
+	}
+	return nil, fmt.Errorf("notify channel type %s not supported", conf.Type)
+}
+
+func postJSON(client *http.Client, url string, headers map[string]string, body interface{}) ([]byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
+
+// 钉钉和企业微信机器人返回 errcode，非 0 为失败
+func checkErrcode(data []byte) error {
+	var resp struct {
+		Errcode int    `json:"errcode"`
+		Errmsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("decode response error: %s", err)
+	}
+	if resp.Errcode != 0 {
+		return fmt.Errorf("errcode %d: %s", resp.Errcode, resp.Errmsg)
+	}
+	return nil
+}
+
+// 通用 webhook，发送完整的通知内容
+type webhook struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (w *webhook) Send(title, text string, n model.Notification) error {
+	n.Title, n.Text = title, text
+	_, err := postJSON(w.client, w.url, w.headers, n)
+	return err
+}
+
+// 企业微信群机器人
+// doc: https://developer.work.weixin.qq.com/document/path/91770
+type wecom struct {
+	url    string
+	client *http.Client
+}
+
+func (w *wecom) Send(title, text string, n model.Notification) error {
+	data, err := postJSON(w.client, w.url, nil, map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": text},
+	})
+	if err != nil {
+		return err
+	}
+	return checkErrcode(data)
+}
+
+// slack incoming webhook，成功返回 ok
+type slack struct {
+	url    string
+	client *http.Client
+}
+
+func (s *slack) Send(title, text string, n model.Notification) error {
+	content := text
+	if title != "" {
+		content = fmt.Sprintf("*%s*\n%s", title, text)
+	}
+	_, err := postJSON(s.client, s.url, nil, map[string]string{"text": content})
+	return err
+}
+
+// 钉钉群机器人，通知指定了接收人时 @ 配置了钉钉 ID 的接收人
+type dingtalk struct {
+	url    string
+	client *http.Client
+}
+
+func (d *dingtalk) Send(title, text string, n model.Notification) error {
+	var atUserIds []string
+	for _, to := range n.To {
+		if to.DingtalkID != "" {
+			atUserIds = append(atUserIds, to.DingtalkID)
+			text += " @" + to.DingtalkID
+		}
+	}
+	body := map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": text},
+	}
+	if len(atUserIds) > 0 {
+		body["at"] = map[string]interface{}{"atUserIds": atUserIds}
+	}
+	data, err := postJSON(d.client, d.url, nil, body)
+	if err != nil {
+		return err
+	}
+	return checkErrcode(data)
+}
+
+// smtp 邮件，465 端口使用 tls 直连，其他端口服务器支持时使用 starttls
+// 收件人为配置的 to 加上通知接收人的邮箱
+type email struct {
+	conf model.SMTPConfig
+}
+
+func (e *email) recipients(n model.Notification) []string {
+	to := append([]string{}, e.conf.To...)
+	for _, recipient := range n.To {
+		if recipient.Email != "" && !slices.Contains(to, recipient.Email) {
+			to = append(to, recipient.Email)
+		}
+	}
+	return to
+}
+
+func (e *email) Send(title, text string, n model.Notification) error {
+	to := e.recipients(n)
+	if len(to) == 0 {
+		return nil
+	}
+	port := e.conf.Port
+	if port == 0 {
+		port = 25
+	}
+	addr := net.JoinHostPort(e.conf.Host, strconv.Itoa(port))
+	var auth smtp.Auth
+	if e.conf.Username != "" {
+		auth = smtp.PlainAuth("", e.conf.Username, e.conf.Password, e.conf.Host)
+	}
+	msg := e.message(title, text, to)
+	if port != 465 {
+		return smtp.SendMail(addr, auth, e.conf.From, to, msg)
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", addr, &tls.Config{ServerName: e.conf.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, e.conf.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(e.conf.From); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (e *email) message(title, text string, to []string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", e.conf.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	body := base64.StdEncoding.EncodeToString([]byte(text))
+	for len(body) > 76 {
+		buf.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	buf.WriteString(body + "\r\n")
+	return buf.Bytes()
+}
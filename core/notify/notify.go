@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/model"
+)
+
+// Notifier 按路由把通知发送到对应的渠道
+type Notifier struct {
+	channels map[string]Channel
+	routes   []model.NotifyRoute
+}
+
+func New(conf model.WithNotify) (*Notifier, error) {
+	n := &Notifier{channels: map[string]Channel{}, routes: conf.Routes}
+	for _, c := range conf.Channels {
+		channel, err := NewChannel(c)
+		if err != nil {
+			return nil, err
+		}
+		n.channels[c.Name] = channel
+	}
+	return n, nil
+}
+
+// Send 发送到所有匹配的路由，同一个渠道只发送一次，返回所有失败的渠道
+func (n *Notifier) Send(notification model.Notification) error {
+	if notification.Time.IsZero() {
+		notification.Time = time.Now()
+	}
+	if notification.Title == "" {
+		notification.Title = fmt.Sprintf("[jms] %s", notification.Event)
+	}
+	var errs []error
+	sent := map[string]bool{}
+	for _, route := range n.routes {
+		if !route.Match(notification.Event) {
+			continue
+		}
+		title, text, err := route.Render(notification)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, name := range route.Channels {
+			channel, ok := n.channels[name]
+			if !ok || sent[name] {
+				continue
+			}
+			sent[name] = true
+			if err := channel.Send(title, text, notification); err != nil {
+				errs = append(errs, fmt.Errorf("notify %s to %s error: %s", notification.Event, name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultNotifier *Notifier
+)
+
+// 按 withNotify 初始化，早期配置的钉钉机器人 token 转为对应事件的路由
+func loadDefault() *Notifier {
+	defaultOnce.Do(func() {
+		conf := app.App.Config.WithNotify
+		conf.Channels = append([]model.NotifyChannel{}, conf.Channels...)
+		conf.Routes = append([]model.NotifyRoute{}, conf.Routes...)
+		legacy := map[model.NotifyEvent]string{
+			model.EventLiveness:     app.App.Config.WithSSHCheck.Alert.RobotToken,
+			model.EventShellTask:    os.Getenv("JMS_DINGTALK_WEB_HOOK_TOKEN"),
+			model.EventPolicyExpire: app.App.Config.WithPolicyExpiry.RobotToken,
+			model.EventBreakGlass:   app.App.Config.WithBreakGlass.RobotToken,
+		}
+		for event, token := range legacy {
+			if token == "" {
+				continue
+			}
+			name := fmt.Sprintf("dingtalk-%s", event)
+			conf.Channels = append(conf.Channels, model.NotifyChannel{Name: name, Type: model.ChannelDingtalk, Token: token})
+			conf.Routes = append(conf.Routes, model.NotifyRoute{Events: []model.NotifyEvent{event}, Channels: []string{name}})
+		}
+		notifier, err := New(conf)
+		if err != nil {
+			log.Errorf("init notifier error: %s", err)
+			notifier = &Notifier{}
+		}
+		defaultNotifier = notifier
+	})
+	return defaultNotifier
+}
+
+// Routed 是否有路由会发送该事件，没有路由时通知不会发出去
+func (n *Notifier) Routed(event model.NotifyEvent) bool {
+	for _, route := range n.routes {
+		if route.Match(event) && len(route.Channels) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Routed 按配置的路由判断事件是否会发送
+func Routed(event model.NotifyEvent) bool {
+	return loadDefault().Routed(event)
+}
+
+// Send 按配置的路由发送通知，失败只记录日志
+func Send(n model.Notification) {
+	if err := loadDefault().Send(n); err != nil {
+		log.Errorf("%s", err)
+	}
+}
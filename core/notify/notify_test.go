@@ -0,0 +1,226 @@
+package notify_test
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/core/notify"
+	"github.com/xops-infra/jms/model"
+)
+
+// 本地模拟各个渠道的 webhook，记录收到的请求
+type receiver struct {
+	lock   sync.Mutex
+	bodies map[string][]map[string]interface{}
+}
+
+func (r *receiver) handler(name, resp string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		r.lock.Lock()
+		if name == "webhook" {
+			body["_header"] = req.Header.Get("X-Token")
+		}
+		r.bodies[name] = append(r.bodies[name], body)
+		r.lock.Unlock()
+		w.Write([]byte(resp))
+	}
+}
+
+func newReceiver() (*receiver, *httptest.Server) {
+	r := &receiver{bodies: map[string][]map[string]interface{}{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook", r.handler("webhook", ""))
+	mux.HandleFunc("/wecom", r.handler("wecom", `{"errcode":0,"errmsg":"ok"}`))
+	mux.HandleFunc("/wecom-bad", r.handler("wecom-bad", `{"errcode":93000,"errmsg":"invalid webhook url"}`))
+	mux.HandleFunc("/slack", r.handler("slack", "ok"))
+	mux.HandleFunc("/dingtalk", r.handler("dingtalk", `{"errcode":0,"errmsg":"ok"}`))
+	return r, httptest.NewServer(mux)
+}
+
+func TestNotifier(t *testing.T) {
+	r, server := newReceiver()
+	defer server.Close()
+	notifier, err := notify.New(model.WithNotify{
+		Channels: []model.NotifyChannel{
+			{Name: "hook", Type: model.ChannelWebhook, URL: server.URL + "/webhook", Headers: map[string]string{"X-Token": "secret"}},
+			{Name: "wecom", Type: model.ChannelWecom, URL: server.URL + "/wecom"},
+			{Name: "slack", Type: model.ChannelSlack, URL: server.URL + "/slack"},
+			{Name: "dingtalk", Type: model.ChannelDingtalk, URL: server.URL + "/dingtalk"},
+		},
+		Routes: []model.NotifyRoute{
+			{Events: []model.NotifyEvent{"*"}, Channels: []string{"hook"}},
+			{Events: []model.NotifyEvent{model.EventLiveness}, Channels: []string{"wecom", "hook"}, Template: "机器 {{.Data.host}} {{.Data.status}}"},
+			{Events: []model.NotifyEvent{model.EventApproval}, Channels: []string{"slack", "dingtalk"}, Title: "审批 {{.Data.id}}"},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, notifier.Send(model.Notification{
+		Event: model.EventLiveness,
+		Text:  "ssh 连接失败",
+		Data:  map[string]interface{}{"host": "10.0.0.1", "status": "down"},
+	}))
+	assert.Len(t, r.bodies["webhook"], 1, "same channel only once")
+	assert.Equal(t, "ssh 连接失败", r.bodies["webhook"][0]["text"])
+	assert.Equal(t, "[jms] liveness", r.bodies["webhook"][0]["title"])
+	assert.Equal(t, "liveness", r.bodies["webhook"][0]["event"])
+	assert.Equal(t, "secret", r.bodies["webhook"][0]["_header"])
+	assert.Equal(t, map[string]interface{}{"content": "机器 10.0.0.1 down"}, r.bodies["wecom"][0]["text"])
+	assert.Empty(t, r.bodies["slack"])
+
+	assert.NoError(t, notifier.Send(model.ApprovalNotification("proc-1", "alice", "申请理由: test", model.ApprovalApproved, "bob")))
+	assert.Len(t, r.bodies["webhook"], 2)
+	assert.True(t, strings.HasPrefix(r.bodies["slack"][0]["text"].(string), "*审批 proc-1*\n"))
+	assert.Contains(t, r.bodies["dingtalk"][0]["text"].(map[string]interface{})["content"], "处理人：bob")
+	assert.Len(t, r.bodies["wecom"], 1)
+
+	// 指定接收人时钉钉 @ 接收人，webhook 带上接收人
+	assert.NoError(t, notifier.Send(model.Notification{
+		Event: model.EventApproval,
+		Text:  "策略即将过期",
+		To:    []model.NotifyRecipient{{Username: "alice", DingtalkID: "ding-alice"}, {Username: "bob"}},
+	}))
+	at := r.bodies["dingtalk"][1]["at"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"ding-alice"}, at["atUserIds"])
+	assert.Contains(t, r.bodies["dingtalk"][1]["text"].(map[string]interface{})["content"], "@ding-alice")
+	assert.Len(t, r.bodies["webhook"][2]["to"], 2)
+}
+
+func TestNotifier_Error(t *testing.T) {
+	_, server := newReceiver()
+	defer server.Close()
+	notifier, err := notify.New(model.WithNotify{
+		Channels: []model.NotifyChannel{
+			{Name: "bad", Type: model.ChannelWecom, URL: server.URL + "/wecom-bad"},
+			{Name: "down", Type: model.ChannelWebhook, URL: server.URL + "/not-found"},
+			{Name: "slack", Type: model.ChannelSlack, URL: server.URL + "/slack"},
+		},
+		Routes: []model.NotifyRoute{{Channels: []string{"bad", "down", "slack"}}},
+	})
+	assert.NoError(t, err)
+	err = notifier.Send(model.Notification{Event: model.EventShellTask, Text: "done"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid webhook url")
+		assert.Contains(t, err.Error(), "404")
+		assert.NotContains(t, err.Error(), "slack")
+	}
+
+	_, err = notify.New(model.WithNotify{Channels: []model.NotifyChannel{{Name: "x", Type: "sms"}}})
+	assert.Error(t, err)
+}
+
+// 最简单的 smtp 服务，只支持明文发送
+func fakeSMTP(t *testing.T) (int, chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	mails := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		defer ln.Close()
+		reader := bufio.NewReader(conn)
+		write := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		write("220 localhost ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					mails <- data.String()
+					write("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				write("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				write("354 go ahead")
+			case cmd == "QUIT":
+				write("221 bye")
+				return
+			default:
+				write("250 OK")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, mails
+}
+
+func TestEmail(t *testing.T) {
+	port, mails := fakeSMTP(t)
+	channel, err := notify.NewChannel(model.NotifyChannel{Name: "mail", Type: model.ChannelEmail, SMTP: model.SMTPConfig{
+		Host: "127.0.0.1",
+		Port: port,
+		From: "jms@example.com",
+		To:   []string{"ops@example.com", "sec@example.com"},
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, channel.Send("[jms] 登录失败", "用户 alice 登录失败", model.Notification{Event: model.EventAuthFailure}))
+	mail := <-mails
+	assert.Contains(t, mail, "From: jms@example.com\r\n")
+	assert.Contains(t, mail, "To: ops@example.com, sec@example.com\r\n")
+	assert.Contains(t, mail, "Subject: =?utf-8?q?")
+	assert.Contains(t, mail, "Content-Transfer-Encoding: base64")
+	_, body, _ := strings.Cut(mail, "\r\n\r\n")
+	text, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(body, "\r\n", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "用户 alice 登录失败", string(text))
+}
+
+// 没有配置固定收件人时只发给通知的接收人，没有接收人不发送
+func TestEmail_Recipients(t *testing.T) {
+	port, mails := fakeSMTP(t)
+	channel, err := notify.NewChannel(model.NotifyChannel{Name: "mail", Type: model.ChannelEmail, SMTP: model.SMTPConfig{
+		Host: "127.0.0.1",
+		Port: port,
+		From: "jms@example.com",
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, channel.Send("[jms] 策略即将到期", "策略即将过期", model.Notification{Event: model.EventPolicyExpire}))
+	assert.NoError(t, channel.Send("[jms] 策略即将到期", "策略即将过期", model.Notification{
+		Event: model.EventPolicyExpire,
+		To:    []model.NotifyRecipient{{Username: "alice", Email: "alice@example.com"}, {Username: "ldap-user"}},
+	}))
+	mail := <-mails
+	assert.Contains(t, mail, "To: alice@example.com\r\n")
+}
+
+func TestAuthFailureThrottle(t *testing.T) {
+	throttle := notify.NewAuthFailureThrottle(time.Minute, 3)
+	// 同一用户和 IP 只通知一次，来源端口不同也算同一个
+	assert.True(t, throttle.Allow("sshd", "root", "1.2.3.4:50000"))
+	assert.False(t, throttle.Allow("sshd", "root", "1.2.3.4:50001"))
+	assert.True(t, throttle.Allow("api", "root", "1.2.3.4"))
+	assert.True(t, throttle.Allow("sshd", "admin", "1.2.3.4:50002"))
+	// 超过窗口内总数后不再通知
+	assert.False(t, throttle.Allow("sshd", "ubuntu", "5.6.7.8:50003"))
+
+	throttle = notify.NewAuthFailureThrottle(50*time.Millisecond, 3)
+	assert.True(t, throttle.Allow("sshd", "root", "1.2.3.4:50000"))
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, throttle.Allow("sshd", "root", "1.2.3.4:50001"))
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/xops-infra/jms/model"
+)
+
+const (
+	authFailureWindow = 10 * time.Minute
+	authFailureLimit  = 30 // 窗口内所有登录失败最多通知次数
+	authFailureTotal  = "total"
+)
+
+// AuthFailureThrottle 登录失败通知限流，暴力破解时避免刷屏所有渠道
+// 同一来源、用户和 IP 在窗口内只通知一次，窗口内通知总数超过 limit 后不再发送
+type AuthFailureThrottle struct {
+	cache  *cache.Cache
+	window time.Duration
+	limit  int
+}
+
+func NewAuthFailureThrottle(window time.Duration, limit int) *AuthFailureThrottle {
+	return &AuthFailureThrottle{
+		cache:  cache.New(window, time.Minute),
+		window: window,
+		limit:  limit,
+	}
+}
+
+// Allow client 为 ip:port 时只取 ip，每次连接的来源端口都不一样
+func (t *AuthFailureThrottle) Allow(source, user, client string) bool {
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+	if t.cache.Add(strings.Join([]string{source, user, client}, "|"), true, t.window) != nil {
+		return false
+	}
+	t.cache.Add(authFailureTotal, 0, t.window)
+	total, err := t.cache.IncrementInt(authFailureTotal, 1)
+	return err == nil && total <= t.limit
+}
+
+var authFailureThrottle = NewAuthFailureThrottle(authFailureWindow, authFailureLimit)
+
+// AuthFailure 发送登录失败通知，限流后异步发送
+func AuthFailure(source, user, client string, err error) {
+	if !authFailureThrottle.Allow(source, user, client) {
+		return
+	}
+	go Send(model.AuthFailureNotification(source, user, client, err))
+}
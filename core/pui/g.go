@@ -12,6 +12,7 @@ import (
 	"github.com/xops-infra/noop/log"
 
 	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/approval"
 	"github.com/xops-infra/jms/core/sshd"
 	. "github.com/xops-infra/jms/model"
 )
@@ -102,7 +103,8 @@ loopMenu:
 			// 顶级菜单，如果有审批则主页支持选择审批或者服务器
 			// menu = make([]MenuItem, 0)
 
-			if app.App.Config.WithDB.Enable && !app.App.Config.WithDingtalk.Enable {
+			extraMenus := make([]MenuItem, 0)
+			if app.App.Config.WithDB.Enable && !approval.Enabled() {
 				// 没有审批策略时候，会在 admin 服务器选择列表里面显示审批菜单
 				policies, err := app.App.DBIo.NeedApprove((*ui.sess).User())
 				if err != nil {
@@ -110,7 +112,18 @@ loopMenu:
 				}
 				if len(policies) > 0 {
 					sshd.Info(fmt.Sprintf("作为管理员，有新的审批工单(%d)待处理。", len(policies)), ui.sess)
-					ui.menuItem = append(ui.menuItem, getApproveMenu(policies)...)
+					extraMenus = append(extraMenus, getApproveMenu(policies)...)
+				}
+			}
+			if app.App.Config.WithDB.Enable {
+				// 即将过期或者刚过期的策略提示续期
+				policies, err := app.App.DBIo.ListRenewablePolicy((*ui.sess).User(), time.Now(), app.App.Config.WithPolicyExpiry.GetNotifyBefore())
+				if err != nil {
+					log.Errorf("Get renewable policy error: %s", err)
+				}
+				if len(policies) > 0 {
+					sshd.Info(fmt.Sprintf("有 %d 条策略即将过期或已过期，可以在菜单中选择续期。", len(policies)), ui.sess)
+					extraMenus = append(extraMenus, getRenewMenu(policies)...)
 				}
 			}
 
@@ -122,6 +135,7 @@ loopMenu:
 			{
 				// 实现新旧菜单内容的合并
 				newMenus := make([]MenuItem, 0)
+				newMenus = append(newMenus, extraMenus...)
 				newMenus = append(newMenus, _menus...)
 				ui.menuItem = newMenus
 			}
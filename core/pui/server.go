@@ -8,12 +8,13 @@ import (
 
 	"github.com/alibabacloud-go/tea/tea"
 	"github.com/elfgzp/ssh"
-	dt "github.com/xops-infra/go-dingtalk-sdk-wrapper"
+	"github.com/manifoldco/promptui"
 	"github.com/xops-infra/multi-cloud-sdk/pkg/model"
 	"github.com/xops-infra/noop/log"
 
 	"github.com/xops-infra/jms/app"
-	"github.com/xops-infra/jms/core/dingtalk"
+	"github.com/xops-infra/jms/core/approval"
+	"github.com/xops-infra/jms/core/notify"
 	"github.com/xops-infra/jms/core/sshd"
 	. "github.com/xops-infra/jms/model"
 )
@@ -62,8 +63,8 @@ func (ui *PUI) getServersMenuV2(sess *ssh.Session) ([]MenuItem, error) {
 			SubMenuTitle: fmt.Sprintf("%s '%s'", UserLoginLabel, server.Name),
 			GetSubMenu:   ui.getServerSSHUsersMenu(server, serversMap),
 		}
-		// 判断机器权限进入不同菜单
-		if !app.App.Sshd.SshdIO.MatchPolicy(user, Connect, server, matchPolicies, false) {
+		// 判断机器权限进入不同菜单，只看本地策略，连接时再调用外部授权
+		if !app.App.Sshd.SshdIO.MatchLocalPolicy(user, Connect, server, matchPolicies, false, (*sess).RemoteAddr().String()) {
 			subMenu.Label = fmt.Sprintf("%s\t[x]\t%s\t%s", server.ID, server.Host, server.Name)
 			subMenu.SubMenuTitle = SelectServer
 			subMenu.GetSubMenu = getServerApproveMenu(server)
@@ -92,12 +93,12 @@ func getApproveMenu(policies []*Policy) []MenuItem {
 func getApproveSubMenu(policy *Policy) func(int, MenuItem, *ssh.Session, []MenuItem) []MenuItem {
 	return func(index int, menuItem MenuItem, sess *ssh.Session, selectedChain []MenuItem) []MenuItem {
 		sshd.Info(tea.Prettify(policy), sess)
+		sshd.Info(policy.ApplyComment(), sess)
 		var menu []MenuItem
 		menu = append(menu, MenuItem{
 			Label: "Approve",
 			SelectedFunc: func(index int, menuItem MenuItem, sess *ssh.Session, selectedChain []MenuItem) (bool, error) {
-				err := app.App.DBIo.ApprovePolicy(policy.Name, (*sess).User(), true)
-				if err != nil {
+				if err := decidePolicy(policy, (*sess).User(), true, sess); err != nil {
 					return false, err
 				}
 				sshd.Info("Approve Success", sess)
@@ -106,8 +107,7 @@ func getApproveSubMenu(policy *Policy) func(int, MenuItem, *ssh.Session, []MenuI
 		menu = append(menu, MenuItem{
 			Label: "Reject",
 			SelectedFunc: func(index int, menuItem MenuItem, sess *ssh.Session, selectedChain []MenuItem) (bool, error) {
-				err := app.App.DBIo.ApprovePolicy(policy.Name, (*sess).User(), false)
-				if err != nil {
+				if err := decidePolicy(policy, (*sess).User(), false, sess); err != nil {
 					return false, err
 				}
 				sshd.Info("Reject Success", sess)
@@ -117,6 +117,34 @@ func getApproveSubMenu(policy *Policy) func(int, MenuItem, *ssh.Session, []MenuI
 	}
 }
 
+// 即将过期或者刚过期的策略，沿用原策略的服务器范围和动作重新申请
+func getRenewMenu(policies []Policy) []MenuItem {
+	var menu []MenuItem
+	for _, policy := range policies {
+		policy := policy
+		menu = append(menu, MenuItem{
+			Label:        fmt.Sprintf("%s\t[-]\t续期策略\t(到期时间 %s)", policy.Name, policy.ExpiresAt.Local().Format(time.DateTime)),
+			SubMenuTitle: "选择续期后的有效期",
+			GetSubMenu:   getExpireMenu(policy.RenewRequest),
+		})
+	}
+	return menu
+}
+
+// 有内置审批单的走审批流程，需要的审批人数够了才会启用策略，否则直接修改策略状态
+func decidePolicy(policy *Policy, approver string, approve bool, sess *ssh.Session) error {
+	approval, err := app.App.DBIo.GetApprovalByPolicy(policy.ID)
+	if err != nil {
+		return app.App.DBIo.ApprovePolicy(policy.Name, approver, approve)
+	}
+	approval, err = app.App.DBIo.DecideApproval(approval.ID, approver, approve, "")
+	if err != nil {
+		return err
+	}
+	sshd.Info(fmt.Sprintf("审批单 %s 状态 %s，已审批 %d/%d", approval.ID, approval.Status, len(approval.Decisions), approval.Required), sess)
+	return nil
+}
+
 // func sortMenu(menu []MenuItem) []MenuItem {
 // 	for i := 0; i < len(menu); i++ {
 // 		for j := i + 1; j < len(menu); j++ {
@@ -150,13 +178,40 @@ func (ui *PUI) getServerSSHUsersMenu(server Server, serversMap map[string]Server
 			return menu
 		}
 
+		// 按策略过滤可用的登录用户，没有限制的策略允许所有登录用户，只看本地策略
+		explain, _, err := app.App.Sshd.SshdIO.ExplainUserLocalPolicy((*sess).User(), Connect, server, (*sess).RemoteAddr().String())
+		if err != nil {
+			log.Errorf("explain policy error: %s", err)
+			sshd.ErrorInfo(err, sess)
+			return menu
+		}
+		denied := 0
 		for _, sshUser := range ssh_users {
+			if !explain.AllowLoginUser(sshUser.UserName) {
+				log.Debugf("server:%s user:%s not allowed by policy", server.Host, sshUser.UserName)
+				denied++
+				continue
+			}
 			subMenu := MenuItem{}
 			log.Debugf("server:%s user:%s", server.Host, sshUser.UserName)
 			subMenu.SelectedFunc = func(index int, menuItem MenuItem, sess *ssh.Session, selectedChain []MenuItem) (bool, error) {
 				if server.Status != model.InstanceStatusRunning {
 					return false, fmt.Errorf("%s status %s, can not login", server.Host, strings.ToLower(string(server.Status)))
 				}
+				// 菜单加载后策略可能已经变化，比如时间窗口已经关闭，连接前实时校验
+				explain, _, err := app.App.Sshd.SshdIO.ExplainUserPolicy((*sess).User(), Connect, server, (*sess).RemoteAddr().String())
+				if err != nil {
+					return false, err
+				}
+				if !explain.Allow {
+					return false, sshd.EmitDenied(sess, server, fmt.Errorf("no permission for %s: %s", server.Host, explain.Message))
+				}
+				if !explain.AllowLoginUser(sshUser.UserName) {
+					return false, sshd.EmitDenied(sess, server, fmt.Errorf("no permission for %s as %s", server.Host, sshUser.UserName))
+				}
+				if explain.Notice != "" {
+					sshd.Info(explain.Notice, sess)
+				}
 				// 记录登录日志到数据库
 				if app.App.Config.WithDB.Enable {
 					err := app.App.DBIo.AddServerLoginRecord(&AddSshLoginRequest{
@@ -172,7 +227,7 @@ func (ui *PUI) getServerSSHUsersMenu(server Server, serversMap map[string]Server
 				// 进入的时候标记超时暂停检查
 				ui.pause()
 				defer ui.resume()
-				err := sshd.NewTerminal(server, sshUser, sess)
+				err = sshd.NewTerminal(server, sshUser, sess)
 				if err != nil {
 					return false, err
 				}
@@ -183,6 +238,14 @@ func (ui *PUI) getServerSSHUsersMenu(server Server, serversMap map[string]Server
 			menu = append(menu, subMenu)
 		}
 
+		if len(menu) == 0 && denied > 0 {
+			menu = append(menu, MenuItem{
+				Label: "策略不允许使用该机器的任何登录用户",
+				SelectedFunc: func(index int, menuItem MenuItem, sess *ssh.Session, selectedChain []MenuItem) (bool, error) {
+					return false, fmt.Errorf("no login user allowed for %s, check policy login_users", server.Host)
+				},
+			})
+		}
 		if len(menu) == 0 {
 			menu = append(menu, MenuItem{
 				Label: "该机器密钥没有被 JMS 托管，无法登录",
@@ -210,6 +273,14 @@ func getServerApproveMenu(server Server) func(int, MenuItem, *ssh.Session, []Men
 				Name:   []string{server.Name},
 			}),
 		})
+		if user, err := app.App.DBIo.DescribeUser((*sess).User()); err == nil && app.App.Config.WithBreakGlass.Allow(user) {
+			menu = append(menu, MenuItem{
+				Label:         fmt.Sprintf("紧急访问(break-glass): %s，%s 内有效", server.Host, app.App.Config.WithBreakGlass.GetDuration()),
+				SubMenuTitle:  "Break Glass",
+				NoSubMenuInfo: "紧急访问理由不能为空，请重新选择",
+				GetSubMenu:    getBreakGlassMenu(user, server),
+			})
+		}
 		// serverTeam := server.Tags.GetTeam()
 		// if serverTeam != nil {
 		// 	// 申请机器所在组权限
@@ -226,45 +297,93 @@ func getServerApproveMenu(server Server) func(int, MenuItem, *ssh.Session, []Men
 	}
 }
 
+// 紧急访问：填写理由后立即开通限时权限，同时告警、全程录像并生成复盘单
+func getBreakGlassMenu(user User, server Server) func(int, MenuItem, *ssh.Session, []MenuItem) []MenuItem {
+	return func(index int, menuItem MenuItem, sess *ssh.Session, selectedChain []MenuItem) []MenuItem {
+		sshd.Info("紧急访问会立即告警，会话输入输出全程录像，事后需要管理员复盘。", sess)
+		reason, err := promptInput("紧急访问理由(必填)", true, sess)
+		if err != nil {
+			log.Errorf("prompt break glass reason error: %s", err)
+			return nil
+		}
+		var menu []MenuItem
+		menu = append(menu, MenuItem{
+			Label: "确定开通紧急访问",
+			SelectedFunc: func(index int, menuItem MenuItem, sess *ssh.Session, selectedChain []MenuItem) (bool, error) {
+				breakGlass, err := app.App.DBIo.CreateBreakGlass(user, reason, server, app.App.Config.WithBreakGlass)
+				if err != nil {
+					log.Errorf("create break glass error: %s", err)
+					return false, err
+				}
+				log.Warnf("break glass %s created by %s for %s, reason: %s", breakGlass.ID, breakGlass.User, server.Host, reason)
+				notify.Send(Notification{
+					Event: EventBreakGlass,
+					Title: fmt.Sprintf("[jms] 紧急访问 %s", server.Host),
+					Text:  breakGlass.AlertMessage(),
+					Data:  map[string]interface{}{"id": breakGlass.ID, "user": breakGlass.User, "server": server.Host, "reason": reason},
+				})
+				sshd.Info(fmt.Sprintf("紧急访问已开通，到期时间 %s，复盘单 %s。返回主菜单重新选择服务器登录。", breakGlass.ExpiresAt.Local().Format(time.DateTime), breakGlass.ID), sess)
+				return true, nil
+			}})
+		return menu
+	}
+}
+
 func getActionMenu(serverFilter ServerFilterV1) func(int, MenuItem, *ssh.Session, []MenuItem) []MenuItem {
 	return func(index int, menuItem MenuItem, sess *ssh.Session, selectedChain []MenuItem) []MenuItem {
 		sshd.Info("申请行为，包括连接，上传和下载文件的权限。", sess)
 		var menu []MenuItem
 		for key, value := range DefaultPolicies {
+			actions := value
 			menu = append(menu, MenuItem{
-				Label:      fmt.Sprintf("申请 %s 权限", key),
-				GetSubMenu: getExpireMenu(serverFilter, value),
+				Label: fmt.Sprintf("申请 %s 权限", key),
+				GetSubMenu: getExpireMenu(func(username string, expiresAt time.Time) *PolicyRequest {
+					return &PolicyRequest{
+						Actions:        actions,
+						Users:          ArrayString{username},
+						ServerFilterV1: &serverFilter,
+						ExpiresAt:      &expiresAt,
+						Name:           tea.String(fmt.Sprintf("%s-%s", username, time.Now().Format("20060102_1504"))),
+					}
+				}),
 			})
 		}
 		return menu
 	}
 }
 
-func getExpireMenu(serverFilter ServerFilterV1, actions ArrayString) func(int, MenuItem, *ssh.Session, []MenuItem) []MenuItem {
+// newRequest 按申请人和到期时间生成策略申请
+func getExpireMenu(newRequest func(username string, expiresAt time.Time) *PolicyRequest) func(int, MenuItem, *ssh.Session, []MenuItem) []MenuItem {
 	return func(index int, menuItem MenuItem, sess *ssh.Session, selectedChain []MenuItem) []MenuItem {
 		var menu []MenuItem
-		sshd.Info("选择策略生效周期，到期后会自动删除策略。", sess)
+		sshd.Info("选择策略生效周期，到期后策略自动失效。", sess)
 		for expiredKey, value := range ExpireTimes {
 			menu = append(menu, MenuItem{
-				Label:        fmt.Sprintf("策略有效期 %s", expiredKey),
-				SubMenuTitle: "Summary",
-				GetSubMenu:   getSureApplyMenu(serverFilter, actions, value),
+				Label:         fmt.Sprintf("策略有效期 %s", expiredKey),
+				SubMenuTitle:  "Summary",
+				NoSubMenuInfo: "申请理由不能为空，请重新选择",
+				GetSubMenu:    getSureApplyMenu(newRequest, value),
 			})
 		}
 		return menu
 	}
 }
 
-func getSureApplyMenu(serverFilter ServerFilterV1, actions ArrayString, expiredDuration time.Duration) func(int, MenuItem, *ssh.Session, []MenuItem) []MenuItem {
+func getSureApplyMenu(newRequest func(username string, expiresAt time.Time) *PolicyRequest, expiredDuration time.Duration) func(int, MenuItem, *ssh.Session, []MenuItem) []MenuItem {
 	return func(index int, menuItem MenuItem, sess *ssh.Session, selectedChain []MenuItem) []MenuItem {
-		expired := time.Now().Add(expiredDuration)
-		policyNew := &PolicyRequest{
-			Actions:        actions,
-			Users:          ArrayString{(*sess).User()},
-			ServerFilterV1: &serverFilter,
-			ExpiresAt:      &expired,
-			Name:           tea.String(fmt.Sprintf("%s-%s", (*sess).User(), time.Now().Format("20060102_1504"))),
+		justification, err := promptInput("申请理由(必填)", true, sess)
+		if err != nil {
+			log.Errorf("prompt justification error: %s", err)
+			return nil
+		}
+		ticketID, err := promptInput("关联工单号(可选，直接回车跳过)", false, sess)
+		if err != nil {
+			log.Errorf("prompt ticket id error: %s", err)
+			return nil
 		}
+		policyNew := newRequest((*sess).User(), time.Now().Add(expiredDuration))
+		policyNew.Justification = &justification
+		policyNew.TicketID = &ticketID
 		var menu []MenuItem
 		sshd.Info(fmt.Sprintf("%s\n确定申请权限？", tea.Prettify(policyNew)), sess)
 		menu = append(menu, MenuItem{
@@ -275,57 +394,55 @@ func getSureApplyMenu(serverFilter ServerFilterV1, actions ArrayString, expiredD
 					return false, fmt.Errorf("server filter is nil")
 				}
 
-				// 创建审批策略
-				policyId, err := app.App.DBIo.CreatePolicy(policyNew)
-				if err != nil {
-					log.Errorf("create policy error: %s", err)
-					return false, err
-				}
-				log.Infof("create approve success, id: %s", policyId)
-
-				// 创建dingtalk审批
-				if app.App.Config.WithDingtalk.Enable {
-					id, err := dingtalk.CreateApproval((*sess).User(), []dt.FormComponentValue{
-						{
-							Name:  tea.String("EnvType"),
-							Value: tea.String(FmtDingtalkApproveFile(policyNew.ServerFilterV1.EnvType)),
-						},
-						{
-							Name:  tea.String("ServerFilter"),
-							Value: tea.String(tea.Prettify(policyNew.ServerFilterV1)),
-						},
-						{
-							Name:  tea.String("DateExpired"),
-							Value: tea.String(policyNew.ExpiresAt.Format(time.RFC3339)),
-						},
-						{
-							Name:  tea.String("Actions"),
-							Value: tea.String(tea.Prettify(policyNew.Actions)),
-						},
-						{
-							Name:  tea.String("Comment"),
-							Value: tea.String("来自jmsCli发起的策略申请"),
-						},
-					})
+				// 启用外部审批的，创建策略后发起审批，审批通过后策略自动生效
+				if approval.Enabled() {
+					policyId, approvalID, err := approval.Submit((*sess).User(), policyNew)
 					if err != nil {
-						log.Errorf("dingtalk.CreateApproval error: %s", err)
-						return false, err
-					}
-					// 更新审批ID到策略字段
-					if err := app.App.DBIo.UpdatePolicy(policyId, &PolicyRequest{
-						ApprovalID: &id,
-					}); err != nil {
-						log.Errorf("update policy approval id error, report to admin: %s", err)
+						log.Errorf("approval.Submit error: %s", err)
 						return false, err
 					}
+					sshd.Info(fmt.Sprintf("成功创建审批:%s 等待管理员审批 完成后策略自动生效", approvalID), sess)
+					log.Infof("create approve success, id: %s", policyId)
+					return true, nil
+				}
 
-					sshd.Info(fmt.Sprintf("成功创建钉钉审批:%s 等等管理员审批 完成后策略自动生效", id), sess)
+				// 内置审批，按服务器 team 路由审批人，需要的审批人数够了才会启用策略
+				applicant := (*sess).User()
+				builtin, err := app.App.DBIo.WithAuthor(applicant).SubmitPolicyApproval(applicant, policyNew, app.App.Config.WithApproval)
+				if err != nil {
+					log.Errorf("submit approval error: %s", err)
+					return false, err
 				}
+				log.Infof("create approve success, id: %s, policy: %s", builtin.ID, builtin.PolicyID)
+				go notify.Send(ApprovalNotification(builtin.ID, builtin.Applicant, ApplyComment(builtin.Justification, builtin.TicketID), builtin.Status, ""))
 
-				// 产生一个申请权限的任务，等待管理员审核
-				sshd.Info(fmt.Sprintf("审批ID:%s，创建成功！等待管理员审核。", policyId), sess)
+				approvers := strings.Join(builtin.Approvers, ",")
+				if approvers == "" {
+					approvers = "approver 角色用户"
+				}
+				sshd.Info(fmt.Sprintf("审批ID:%s，创建成功！等待 %s 审核，需要 %d 人同意。", builtin.ID, approvers, builtin.Required), sess)
 				return true, nil
 			}})
 		return menu
 	}
 }
+
+// 读取一行输入，required 为 true 时不允许为空
+func promptInput(label string, required bool, sess *ssh.Session) (string, error) {
+	prompt := promptui.Prompt{
+		Label:  label,
+		Stdin:  *sess,
+		Stdout: *sess,
+		Validate: func(input string) error {
+			if required && strings.TrimSpace(input) == "" {
+				return errors.New("不能为空")
+			}
+			return nil
+		},
+	}
+	input, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(input), nil
+}
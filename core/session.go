@@ -0,0 +1,37 @@
+package core
+
+import (
+	"time"
+
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/sshd"
+	"github.com/xops-infra/jms/model"
+)
+
+// 检查正在连接的会话，策略时间窗口关闭且配置了 terminate_on_close 的会话主动断开
+// 会话建立后依赖的策略过期了也会断开，只检查本地策略，不调用外部授权
+func SessionScheduleChecker() {
+	startTime := time.Now()
+	defer func() {
+		log.Debugf("SessionScheduleChecker cost: %s", time.Since(startTime))
+	}()
+	for _, sess := range sshd.ListActiveSessions() {
+		explain, policies, err := app.App.Sshd.SshdIO.ExplainUserLocalPolicy(sess.User, model.Connect, sess.Server, sess.Client)
+		if err != nil {
+			log.Errorf("session %s check error: %s", sess.ID, err)
+			continue
+		}
+		if explain.Allow {
+			continue
+		}
+		if policy := model.ClosedSchedulePolicy(explain, policies, sess.Server); policy != nil {
+			sess.Close("policy " + policy.Name + " time window closed")
+			continue
+		}
+		if policy := model.ExpiredSessionPolicy(explain, policies, sess.Server, sess.StartAt); policy != nil {
+			sess.Close("policy " + policy.Name + " expired")
+		}
+	}
+}
@@ -2,14 +2,14 @@ package core
 
 import (
 	"fmt"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/alibabacloud-go/tea/tea"
 	"github.com/robfig/cron"
 	"github.com/xops-infra/jms/app"
-	"github.com/xops-infra/jms/core/dingtalk"
+	"github.com/xops-infra/jms/core/notify"
+	"github.com/xops-infra/jms/core/siem"
 	"github.com/xops-infra/jms/core/sshd"
 	"github.com/xops-infra/jms/model"
 	"github.com/xops-infra/noop/log"
@@ -56,10 +56,13 @@ func ServerShellRun() error {
 						log.Errorf("update shell task status error: %s", err)
 					}
 					// 发送任务执行完成通知
-					err = dingtalk.SendRobotText(os.Getenv("JMS_DINGTALK_WEB_HOOK_TOKEN"), fmt.Sprintf("shell task %s(%s) status:%s  %s", task.Name, task.UUID, state, result), "")
-					if err != nil {
-						log.Errorf("send dingtalk error: %s", err)
-					}
+					notify.Send(model.Notification{
+						Event: model.EventShellTask,
+						Title: fmt.Sprintf("[jms] shell task %s %s", task.Name, state),
+						Text:  fmt.Sprintf("shell task %s(%s) status:%s  %s", task.Name, task.UUID, state, result),
+						Data:  map[string]interface{}{"name": task.Name, "uuid": task.UUID, "status": state, "result": result},
+					})
+					siem.Emit(shellTaskEvent(task, state, result, time.Since(startTime)))
 					wg.Done()
 				}()
 
@@ -84,6 +87,24 @@ func ServerShellRun() error {
 	return nil
 }
 
+func shellTaskEvent(task model.ShellTask, state model.Status, result string, cost time.Duration) model.AuditEvent {
+	eventResult := model.AuditSuccess
+	if state != model.StatusSuccess {
+		eventResult = model.AuditFailure
+	}
+	e := model.NewAuditEvent(model.AuditShellTask, "run", eventResult, task.SubmitUser, "")
+	e.Message = result
+	e.Data = map[string]interface{}{
+		"uuid":     task.UUID,
+		"name":     task.Name,
+		"shell":    task.Shell,
+		"servers":  task.ServerFilter,
+		"status":   state,
+		"duration": cost.Seconds(),
+	}
+	return e
+}
+
 func RunShellTask(task model.ShellTask, servers model.Servers, keys []model.AddKeyRequest) (model.Status, error) {
 
 	wg := sync.WaitGroup{}
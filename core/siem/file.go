@@ -0,0 +1,44 @@
+package siem
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/xops-infra/jms/model"
+)
+
+// 文件输出，每行一个 json，追加写入，方便 filebeat 等采集
+type fileSink struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+func newFileSink(conf model.EventSink) (*fileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(conf.Path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(conf.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file: file}, nil
+}
+
+func (f *fileSink) Write(e model.AuditEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	_, err = f.file.Write(append(data, '\n'))
+	return err
+}
+
+func (f *fileSink) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,297 @@
+package siem
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/model"
+)
+
+const (
+	httpQueueCurrent = "current.ndjson"
+	httpDeadLetter   = "dead-letter.ndjson"
+	httpRetries      = 3
+)
+
+// http 输出，事件先追加到磁盘队列，满一批或者到发送间隔后 POST json 数组
+// 网络错误和 5xx 按指数退避重试，仍然失败的批次留在磁盘等下次发送，进程重启也不会丢
+// 接收端返回 4xx 的批次和无法解析的行(如进程崩溃时写了一半)追加到 dead-letter.ndjson，不阻塞后面的事件
+type httpSink struct {
+	url       string
+	headers   map[string]string
+	client    *http.Client
+	batchSize int
+	dir       string
+	maxBytes  int64
+
+	lock    sync.Mutex
+	current *os.File
+	count   int // current 中的事件数
+
+	flushLock sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func newHTTPSink(conf model.EventSink) (*httpSink, error) {
+	h := &httpSink{
+		url:       conf.URL,
+		headers:   conf.Headers,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		batchSize: conf.GetBatchSize(),
+		dir:       conf.GetQueueDir(),
+		maxBytes:  conf.GetMaxQueueBytes(),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		return nil, err
+	}
+	// 上次没有发送的事件转为批次
+	if info, err := os.Stat(h.currentPath()); err == nil && info.Size() > 0 {
+		h.count = 1
+	}
+	if err := h.rotate(); err != nil {
+		return nil, err
+	}
+	go h.run(conf.GetFlushInterval())
+	return h, nil
+}
+
+func (h *httpSink) currentPath() string {
+	return filepath.Join(h.dir, httpQueueCurrent)
+}
+
+func (h *httpSink) run(interval time.Duration) {
+	defer close(h.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			h.lock.Lock()
+			err := h.rotate()
+			h.lock.Unlock()
+			if err != nil {
+				log.Errorf("rotate event queue error: %s", err)
+			}
+			h.flush()
+		}
+	}
+}
+
+func (h *httpSink) Write(e model.AuditEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if _, err := h.current.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	h.count++
+	if h.count < h.batchSize {
+		return nil
+	}
+	if err := h.rotate(); err != nil {
+		return err
+	}
+	go h.flush()
+	return nil
+}
+
+// rotate 把当前文件转为待发送的批次，需要持有 lock
+func (h *httpSink) rotate() error {
+	if h.current != nil {
+		if h.count == 0 {
+			return nil
+		}
+		if err := h.current.Close(); err != nil {
+			return err
+		}
+		h.current = nil
+	}
+	if h.count > 0 {
+		batch := filepath.Join(h.dir, fmt.Sprintf("batch-%020d.ndjson", time.Now().UnixNano()))
+		if err := os.Rename(h.currentPath(), batch); err != nil {
+			return err
+		}
+		h.count = 0
+		h.trim()
+	}
+	file, err := os.OpenFile(h.currentPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	h.current = file
+	return nil
+}
+
+// 按时间顺序排列的批次文件
+func (h *httpSink) batches() []string {
+	files, _ := filepath.Glob(filepath.Join(h.dir, "batch-*.ndjson"))
+	sort.Strings(files)
+	return files
+}
+
+// 磁盘队列超过上限时丢弃最早的批次
+func (h *httpSink) trim() {
+	files := h.batches()
+	var total int64
+	sizes := make([]int64, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; i < len(files) && total > h.maxBytes; i++ {
+		log.Warnf("event queue exceeds %d bytes, drop %s", h.maxBytes, files[i])
+		os.Remove(files[i])
+		total -= sizes[i]
+	}
+}
+
+// flush 按顺序发送所有批次，可以重试的失败停止，保证事件顺序
+func (h *httpSink) flush() {
+	h.flushLock.Lock()
+	defer h.flushLock.Unlock()
+	for _, file := range h.batches() {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue // 已经被 trim 丢弃
+		}
+		if err != nil {
+			log.Errorf("read event queue %s error: %s", file, err)
+			return
+		}
+		var valid, invalid []string
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			if json.Valid([]byte(line)) {
+				valid = append(valid, line)
+			} else if line != "" {
+				invalid = append(invalid, line)
+			}
+		}
+		if len(invalid) > 0 {
+			log.Warnf("skip %d invalid lines in %s", len(invalid), file)
+			if err := h.deadLetter(invalid); err != nil {
+				log.Errorf("write event dead letter error: %s", err)
+				return
+			}
+		}
+		if len(valid) > 0 {
+			err := h.post([]byte("[" + strings.Join(valid, ",") + "]"))
+			var rejected *rejectedError
+			if errors.As(err, &rejected) {
+				log.Errorf("%d events rejected by %s, move to %s: %s", len(valid), h.url, httpDeadLetter, err)
+				if err := h.deadLetter(valid); err != nil {
+					log.Errorf("write event dead letter error: %s", err)
+					return
+				}
+			} else if err != nil {
+				log.Errorf("post %d events to %s error: %s", len(valid), h.url, err)
+				return
+			}
+		}
+		os.Remove(file)
+	}
+}
+
+// 接收端拒绝(4xx)的请求，重试也不会成功
+type rejectedError struct {
+	status int
+	body   string
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.status, e.body)
+}
+
+// 不能发送的事件追加到死信文件，需要人工处理
+func (h *httpSink) deadLetter(lines []string) error {
+	file, err := os.OpenFile(filepath.Join(h.dir, httpDeadLetter), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(strings.Join(lines, "\n") + "\n")
+	return err
+}
+
+func (h *httpSink) post(body []byte) error {
+	var err error
+	wait := time.Second
+	for i := 0; i < httpRetries; i++ {
+		if i > 0 {
+			select {
+			case <-h.stop:
+				return err
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+		err = h.postOnce(body)
+		var rejected *rejectedError
+		if err == nil || errors.As(err, &rejected) {
+			return err
+		}
+	}
+	return err
+}
+
+func (h *httpSink) postOnce(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(resp.Body)
+		// 408 和 429 是暂时的，和 5xx 一样重试
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return &rejectedError{status: resp.StatusCode, body: string(data)}
+		}
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(data))
+	}
+	return nil
+}
+
+// Close 发送剩余事件，发送失败的留在磁盘队列
+func (h *httpSink) Close() error {
+	close(h.stop)
+	<-h.done
+	h.lock.Lock()
+	err := h.rotate()
+	if h.current != nil {
+		h.current.Close()
+		h.current = nil
+	}
+	h.lock.Unlock()
+	// stop 已关闭，post 不会再等待重试
+	h.flush()
+	return err
+}
@@ -0,0 +1,177 @@
+package siem
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/db"
+	"github.com/xops-infra/jms/model"
+)
+
+// Sink 审计事件的输出
+type Sink interface {
+	Write(e model.AuditEvent) error
+	Close() error
+}
+
+// NewSink 按类型创建输出
+func NewSink(conf model.EventSink) (Sink, error) {
+	switch conf.Type {
+	case model.SinkSyslog:
+		return newSyslogSink(conf)
+	case model.SinkFile:
+		return newFileSink(conf)
+	case model.SinkHTTP:
+		return newHTTPSink(conf)
+	}
+	return nil, fmt.Errorf("event sink type %s not supported", conf.Type)
+}
+
+// Stream 异步把事件写到所有输出，不阻塞登录、上传下载等流程
+type Stream struct {
+	conf   model.WithEventStream
+	sinks  []Sink
+	events chan model.AuditEvent
+	done   chan struct{}
+}
+
+func New(conf model.WithEventStream) (*Stream, error) {
+	s := &Stream{conf: conf, events: make(chan model.AuditEvent, 1024), done: make(chan struct{})}
+	for _, c := range conf.Sinks {
+		sink, err := NewSink(c)
+		if err != nil {
+			s.closeSinks()
+			return nil, err
+		}
+		s.sinks = append(s.sinks, sink)
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *Stream) run() {
+	defer close(s.done)
+	for e := range s.events {
+		for _, sink := range s.sinks {
+			if err := sink.Write(e); err != nil {
+				log.Errorf("write %s event to sink error: %s", e.Type, err)
+			}
+		}
+	}
+}
+
+// Emit 缓冲区满时丢弃事件
+func (s *Stream) Emit(e model.AuditEvent) {
+	if !s.conf.Match(e.Type) {
+		return
+	}
+	select {
+	case s.events <- e:
+	default:
+		log.Warnf("event stream buffer is full, drop %s event %s", e.Type, e.ID)
+	}
+}
+
+// Close 等待缓冲区的事件写完后关闭所有输出
+func (s *Stream) Close() error {
+	close(s.events)
+	<-s.done
+	return s.closeSinks()
+}
+
+func (s *Stream) closeSinks() error {
+	var errs []error
+	for _, sink := range s.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+var defaultStream *Stream
+
+// Init 按 withEventStream 初始化，需要在 WithDB 之后调用，策略变更事件由数据库写入后触发
+// component 为 api,sshd,schedule,apply 等，同一台机器上的多个进程使用各自的 http 磁盘队列
+func Init(component string) {
+	conf := app.App.Config.WithEventStream
+	if !conf.Enabled() {
+		return
+	}
+	conf.Sinks = append([]model.EventSink{}, conf.Sinks...)
+	for i := range conf.Sinks {
+		if conf.Sinks[i].Type == model.SinkHTTP {
+			conf.Sinks[i].QueueDir = filepath.Join(conf.Sinks[i].GetQueueDir(), component)
+		}
+	}
+	stream, err := New(conf)
+	if err != nil {
+		log.Errorf("init event stream error: %s", err)
+		return
+	}
+	defaultStream = stream
+	db.OnPolicyChange = func(policy model.Policy, action model.RevisionAction, author string) {
+		Emit(PolicyChangeEvent(policy, action, author))
+	}
+	log.Infof("event stream enabled, %d sinks", len(conf.Sinks))
+}
+
+// Close 写完缓冲区的事件并发送磁盘队列，jms apply 等命令退出前调用，发送失败的留在磁盘队列
+func Close() {
+	if defaultStream == nil {
+		return
+	}
+	db.OnPolicyChange = nil
+	if err := defaultStream.Close(); err != nil {
+		log.Errorf("close event stream error: %s", err)
+	}
+	defaultStream = nil
+}
+
+// Emit 推送审计事件，没有配置 withEventStream 时忽略
+func Emit(e model.AuditEvent) {
+	if defaultStream == nil {
+		return
+	}
+	defaultStream.Emit(e)
+}
+
+// PolicyChangeEvent 策略变更事件，author 为操作人
+func PolicyChangeEvent(policy model.Policy, action model.RevisionAction, author string) model.AuditEvent {
+	e := model.NewAuditEvent(model.AuditPolicyChange, string(action), model.AuditSuccess, author, "")
+	e.Message = fmt.Sprintf("policy %s %s by %s", policy.Name, action, author)
+	e.Data = map[string]interface{}{
+		"policy_id":   policy.ID,
+		"policy_name": policy.Name,
+		"users":       policy.Users,
+		"groups":      policy.Groups,
+		"server":      policy.ServerFilterV1,
+		"actions":     policy.Actions,
+		"expires_at":  policy.ExpiresAt,
+		"is_enabled":  policy.IsEnabled,
+		"is_deleted":  policy.IsDeleted,
+		"approval_id": policy.ApprovalID,
+	}
+	return e
+}
+
+// ServerEvent 和目标服务器相关的事件，比如登录、上传下载和无权限连接
+func ServerEvent(eventType model.AuditEventType, action, result, user, client string, server model.Server) model.AuditEvent {
+	e := model.NewAuditEvent(eventType, action, result, user, client)
+	e.Server = fmt.Sprintf("%s:%d", server.Host, server.Port)
+	e.InstanceID = server.ID
+	e.Data = map[string]interface{}{"server_name": server.Name}
+	return e
+}
+
+// AuthEvent jms 自身的登录事件，action 为 password,publickey,api，失败记为 denied
+func AuthEvent(action, user, client string, err error) model.AuditEvent {
+	if err == nil {
+		return model.NewAuditEvent(model.AuditLogin, action, model.AuditSuccess, user, client)
+	}
+	e := model.NewAuditEvent(model.AuditDenied, action, model.AuditFailure, user, client)
+	e.Message = err.Error()
+	return e
+}
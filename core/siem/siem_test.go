@@ -0,0 +1,332 @@
+package siem_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/db"
+	"github.com/xops-infra/jms/core/siem"
+	"github.com/xops-infra/jms/model"
+)
+
+func init() {
+	log.Default().WithLevel(log.InfoLevel).WithFilename("/tmp/test.log").Init()
+}
+
+func testEvent(eventType model.AuditEventType, user string) model.AuditEvent {
+	e := model.NewAuditEvent(eventType, "connect", model.AuditSuccess, user, "10.0.0.1:52000")
+	e.Server = "10.9.0.1:22"
+	return e
+}
+
+func TestFormatSyslog(t *testing.T) {
+	e := testEvent(model.AuditDenied, `zhang"san]`)
+	e.Result = model.AuditFailure
+	e.Time = time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	msg := siem.FormatSyslog(e, 13, "jms host", "jms")
+
+	// facility 13 * 8 + warning 4
+	assert.True(t, strings.HasPrefix(msg, "<108>1 2026-10-01T08:00:00.000000Z jmshost jms "), msg)
+	assert.Contains(t, msg, fmt.Sprintf(" %d denied [jms@32473 id=%q", os.Getpid(), e.ID))
+	assert.Contains(t, msg, `user="zhang\"san\]"`)
+	assert.Contains(t, msg, `server="10.9.0.1:22"]`)
+
+	// MSG 为完整的事件 json
+	var got model.AuditEvent
+	assert.NoError(t, json.Unmarshal([]byte(msg[strings.Index(msg, "] {")+2:]), &got))
+	assert.Equal(t, e.ID, got.ID)
+	assert.Equal(t, e.User, got.User)
+
+	e = testEvent(model.AuditLogin, "")
+	assert.True(t, strings.HasPrefix(siem.FormatSyslog(e, 13, "", ""), "<110>1 "))
+	assert.Contains(t, siem.FormatSyslog(e, 13, "", ""), " - - ")
+}
+
+func TestSyslogSink(t *testing.T) {
+	// udp 每条一个报文
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+	sink, err := siem.NewSink(model.EventSink{Type: model.SinkSyslog, Address: conn.LocalAddr().String()})
+	assert.NoError(t, err)
+	e := testEvent(model.AuditLogin, "zhangsan")
+	assert.NoError(t, sink.Write(e))
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, siem.FormatSyslog(e, 13, mustHostname(), "jms"), string(buf[:n]))
+	assert.NoError(t, sink.Close())
+
+	// tcp 使用 octet-counting 分帧
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	frames := make(chan string, 2)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(length))
+			frame := make([]byte, size)
+			if _, err := io.ReadFull(r, frame); err != nil {
+				return
+			}
+			frames <- string(frame)
+		}
+	}()
+	sink, err = siem.NewSink(model.EventSink{Type: model.SinkSyslog, Network: "tcp", Address: ln.Addr().String(), AppName: "bastion"})
+	assert.NoError(t, err)
+	defer sink.Close()
+	e1, e2 := testEvent(model.AuditLogin, "zhangsan"), testEvent(model.AuditLogout, "zhangsan")
+	assert.NoError(t, sink.Write(e1))
+	assert.NoError(t, sink.Write(e2))
+	for _, e := range []model.AuditEvent{e1, e2} {
+		select {
+		case frame := <-frames:
+			assert.Equal(t, siem.FormatSyslog(e, 13, mustHostname(), "bastion"), frame)
+		case <-time.After(3 * time.Second):
+			t.Fatal("tcp frame not received")
+		}
+	}
+}
+
+func mustHostname() string {
+	hostname, _ := os.Hostname()
+	return strings.ReplaceAll(hostname, " ", "")
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events", "audit.ndjson")
+	sink, err := siem.NewSink(model.EventSink{Type: model.SinkFile, Path: path})
+	assert.NoError(t, err)
+	events := []model.AuditEvent{testEvent(model.AuditLogin, "a"), testEvent(model.AuditScp, "b")}
+	for _, e := range events {
+		assert.NoError(t, sink.Write(e))
+	}
+	assert.NoError(t, sink.Close())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+	for i, line := range lines {
+		var got model.AuditEvent
+		assert.NoError(t, json.Unmarshal([]byte(line), &got))
+		assert.Equal(t, events[i].ID, got.ID)
+		assert.Equal(t, events[i].Type, got.Type)
+	}
+}
+
+// 模拟 SIEM 的 http 接收端，fail 次数内返回 500
+type collector struct {
+	lock    sync.Mutex
+	fail    int
+	reject  int // 返回 400 的次数
+	calls   int
+	batches [][]model.AuditEvent
+	header  string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.calls++
+	if c.fail > 0 {
+		c.fail--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if c.reject > 0 {
+		c.reject--
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var batch []model.AuditEvent
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.header = r.Header.Get("Authorization")
+	c.batches = append(c.batches, batch)
+}
+
+func (c *collector) events() []model.AuditEvent {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var events []model.AuditEvent
+	for _, batch := range c.batches {
+		events = append(events, batch...)
+	}
+	return events
+}
+
+func TestHTTPSink(t *testing.T) {
+	c := &collector{fail: 1}
+	server := httptest.NewServer(c)
+	defer server.Close()
+	dir := t.TempDir()
+	sink, err := siem.NewSink(model.EventSink{
+		Type:          model.SinkHTTP,
+		URL:           server.URL,
+		Headers:       map[string]string{"Authorization": "Bearer secret"},
+		BatchSize:     2,
+		FlushInterval: 60,
+		QueueDir:      dir,
+	})
+	assert.NoError(t, err)
+
+	// 满一批立即发送，第一次失败后重试
+	var sent []model.AuditEvent
+	for i := 0; i < 4; i++ {
+		e := testEvent(model.AuditLogin, fmt.Sprintf("user%d", i))
+		sent = append(sent, e)
+		assert.NoError(t, sink.Write(e))
+	}
+	assert.Eventually(t, func() bool { return len(c.events()) == 4 }, 5*time.Second, 50*time.Millisecond)
+
+	// 不满一批的在关闭时发送
+	e := testEvent(model.AuditLogout, "user0")
+	sent = append(sent, e)
+	assert.NoError(t, sink.Write(e))
+	assert.NoError(t, sink.Close())
+
+	got := c.events()
+	assert.Len(t, got, 5)
+	for i := range sent {
+		assert.Equal(t, sent[i].ID, got[i].ID)
+	}
+	assert.Equal(t, "Bearer secret", c.header)
+	assert.Equal(t, 4, c.calls)
+	files, _ := filepath.Glob(filepath.Join(dir, "batch-*"))
+	assert.Empty(t, files)
+}
+
+func TestHTTPSinkQueue(t *testing.T) {
+	c := &collector{fail: 1000}
+	server := httptest.NewServer(c)
+	defer server.Close()
+	dir := t.TempDir()
+	conf := model.EventSink{Type: model.SinkHTTP, URL: server.URL, BatchSize: 100, FlushInterval: 60, QueueDir: dir}
+
+	// 接收端不可用，关闭后事件留在磁盘队列
+	sink, err := siem.NewSink(conf)
+	assert.NoError(t, err)
+	e := testEvent(model.AuditScp, "zhangsan")
+	assert.NoError(t, sink.Write(e))
+	assert.NoError(t, sink.Close())
+	files, _ := filepath.Glob(filepath.Join(dir, "batch-*.ndjson"))
+	assert.Len(t, files, 1)
+
+	// 重启后恢复发送
+	c.lock.Lock()
+	c.fail = 0
+	c.lock.Unlock()
+	sink, err = siem.NewSink(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Close())
+	got := c.events()
+	assert.Len(t, got, 1)
+	assert.Equal(t, e.ID, got[0].ID)
+	files, _ = filepath.Glob(filepath.Join(dir, "batch-*.ndjson"))
+	assert.Empty(t, files)
+}
+
+// 接收端拒绝的批次和写了一半的行进入死信文件，不阻塞后面的事件
+func TestHTTPSinkDeadLetter(t *testing.T) {
+	c := &collector{reject: 1}
+	server := httptest.NewServer(c)
+	defer server.Close()
+	dir := t.TempDir()
+	conf := model.EventSink{Type: model.SinkHTTP, URL: server.URL, BatchSize: 100, FlushInterval: 60, QueueDir: dir}
+
+	// 上次崩溃留下的队列，最后一行只写了一半
+	rejected := testEvent(model.AuditLogin, "zhangsan")
+	data, _ := json.Marshal(rejected)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "batch-00000000000000000001.ndjson"), append(data, '\n'), 0644))
+	ok := testEvent(model.AuditLogin, "lisi")
+	data, _ = json.Marshal(ok)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "current.ndjson"), append(append(data, '\n'), []byte(`{"id":"half`)...), 0644))
+
+	sink, err := siem.NewSink(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Close())
+
+	got := c.events()
+	assert.Len(t, got, 1)
+	assert.Equal(t, ok.ID, got[0].ID)
+	assert.Equal(t, 2, c.calls, "4xx not retried")
+	files, _ := filepath.Glob(filepath.Join(dir, "batch-*.ndjson"))
+	assert.Empty(t, files)
+	dead, err := os.ReadFile(filepath.Join(dir, "dead-letter.ndjson"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(dead), rejected.ID)
+	assert.Contains(t, string(dead), `{"id":"half`)
+}
+
+func TestStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	stream, err := siem.New(model.WithEventStream{
+		Types: []model.AuditEventType{model.AuditDenied},
+		Sinks: []model.EventSink{{Type: model.SinkFile, Path: path}},
+	})
+	assert.NoError(t, err)
+	stream.Emit(testEvent(model.AuditLogin, "zhangsan"))
+	denied := testEvent(model.AuditDenied, "zhangsan")
+	stream.Emit(denied)
+	assert.NoError(t, stream.Close())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], denied.ID)
+
+	_, err = siem.New(model.WithEventStream{Sinks: []model.EventSink{{Type: "kafka"}}})
+	assert.Error(t, err)
+}
+
+// 命令行退出前 Close，策略变更事件写完后才返回
+func TestInitClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	app.App = &app.Application{Config: &model.Config{WithEventStream: model.WithEventStream{
+		Sinks: []model.EventSink{{Type: model.SinkFile, Path: path}},
+	}}}
+	siem.Init("apply")
+	if assert.NotNil(t, db.OnPolicyChange) {
+		db.OnPolicyChange(model.Policy{ID: "p-1", Name: "alice-dev"}, model.RevisionUpdate, "jms-apply")
+	}
+	siem.Close()
+	assert.Nil(t, db.OnPolicyChange)
+	siem.Emit(testEvent(model.AuditLogin, "zhangsan"))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "alice-dev")
+}
@@ -0,0 +1,154 @@
+package siem
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xops-infra/jms/model"
+)
+
+// RFC5424 结构化数据的 SD-ID，32473 为文档保留的企业号
+const syslogSDID = "jms@32473"
+
+const (
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+// syslog 输出，udp 每条事件一个报文，tcp 和 tls 使用 octet-counting 分帧(RFC6587)
+type syslogSink struct {
+	network  string
+	address  string
+	appName  string
+	facility int
+	hostname string
+
+	lock sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogSink(conf model.EventSink) (*syslogSink, error) {
+	s := &syslogSink{
+		network:  conf.Network,
+		address:  conf.Address,
+		appName:  conf.AppName,
+		facility: conf.Facility,
+	}
+	if s.network == "" {
+		s.network = "udp"
+	}
+	if s.appName == "" {
+		s.appName = "jms"
+	}
+	if s.facility <= 0 {
+		s.facility = 13 // log audit
+	}
+	s.hostname, _ = os.Hostname()
+	return s, nil
+}
+
+func (s *syslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if s.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", s.address, &tls.Config{})
+	}
+	return dialer.Dial(s.network, s.address)
+}
+
+func (s *syslogSink) Write(e model.AuditEvent) error {
+	msg := FormatSyslog(e, s.facility, s.hostname, s.appName)
+	if s.network != "udp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// 连接断开后重连一次
+	var err error
+	for i := 0; i < 2; i++ {
+		if s.conn == nil {
+			if s.conn, err = s.dial(); err != nil {
+				return err
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err = s.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *syslogSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// FormatSyslog 按 RFC5424 格式化事件，MSGID 为事件类型，MSG 为事件 json
+func FormatSyslog(e model.AuditEvent, facility int, hostname, appName string) string {
+	severity := severityInfo
+	if e.Type == model.AuditDenied || e.Result == model.AuditFailure {
+		severity = severityWarning
+	}
+	params := []string{"id", e.ID}
+	for _, kv := range [][2]string{
+		{"action", e.Action},
+		{"result", e.Result},
+		{"user", e.User},
+		{"client", e.Client},
+		{"server", e.Server},
+		{"instance_id", e.InstanceID},
+	} {
+		if kv[1] != "" {
+			params = append(params, kv[0], kv[1])
+		}
+	}
+	var sd strings.Builder
+	sd.WriteString("[" + syslogSDID)
+	for i := 0; i < len(params); i += 2 {
+		fmt.Fprintf(&sd, ` %s="%s"`, params[i], escapeSDParam(params[i+1]))
+	}
+	sd.WriteString("]")
+	data, _ := json.Marshal(e)
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		facility*8+severity,
+		e.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeader(hostname),
+		syslogHeader(appName),
+		os.Getpid(),
+		syslogHeader(string(e.Type)),
+		sd.String(),
+		data,
+	)
+}
+
+// 头部字段不能为空且不能有空格
+func syslogHeader(v string) string {
+	v = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, v)
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+func escapeSDParam(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v)
+}
@@ -0,0 +1,57 @@
+package sshd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/app"
+	. "github.com/xops-infra/jms/model"
+)
+
+// 紧急访问会话的录像目录，没有配置审计目录时使用默认目录
+const defaultBreakGlassDir = "/opt/jms/audit"
+
+// 紧急访问的会话不管是否启用审计都全程记录输入和输出，录像文件记录到复盘单
+// 没有有效的紧急访问时原样返回
+func withBreakGlassRecord(user string, server Server, stdin io.Reader, stdout io.Writer) (io.Reader, io.Writer, func()) {
+	noop := func() {}
+	if !app.App.Config.WithDB.Enable || !app.App.Config.WithBreakGlass.Enable {
+		return stdin, stdout, noop
+	}
+	breakGlass, err := app.App.DBIo.QueryActiveBreakGlass(user, server.Host, time.Now())
+	if err != nil {
+		return stdin, stdout, noop
+	}
+	dir := app.App.Config.WithVideo.Dir
+	if dir == "" {
+		dir = defaultBreakGlassDir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Errorf("create break glass record dir error: %s", err)
+		return stdin, stdout, noop
+	}
+	prefix := fmt.Sprintf("%s/breakglass_%s_%s_%s", dir, time.Now().Format("20060102_150405"), server.Host, user)
+	outputFile, err := os.OpenFile(prefix+".log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Errorf("create break glass record error: %s", err)
+		return stdin, stdout, noop
+	}
+	inputFile, err := os.OpenFile(prefix+".input.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Errorf("create break glass record error: %s", err)
+		outputFile.Close()
+		return stdin, stdout, noop
+	}
+	if err := app.App.DBIo.AddBreakGlassRecording(breakGlass.ID, outputFile.Name(), inputFile.Name()); err != nil {
+		log.Errorf("add break glass %s recording error: %s", breakGlass.ID, err)
+	}
+	log.Warnf("break glass %s session of %s on %s is recording", breakGlass.ID, user, server.Host)
+	return io.TeeReader(stdin, inputFile), io.MultiWriter(outputFile, stdout), func() {
+		inputFile.Close()
+		outputFile.Close()
+	}
+}
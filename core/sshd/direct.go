@@ -0,0 +1,69 @@
+package sshd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/elfgzp/ssh"
+	"github.com/xops-infra/multi-cloud-sdk/pkg/model"
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/siem"
+	. "github.com/xops-infra/jms/model"
+)
+
+// DirectLogin 直连登录，ssh jms ssh root@10.9.x.x 跳过菜单直接登录目标机器
+// 和菜单登录一样需要校验策略以及策略允许的登录用户
+func DirectLogin(target string, sess *ssh.Session) error {
+	// 服务器和密钥从数据库加载，未启用数据库时不支持直连
+	if !app.App.Config.WithDB.Enable {
+		return errors.New("direct login need withDB enable, use menu instead")
+	}
+	sshUsername, host, _, err := ParseScpTarget(target)
+	if err != nil {
+		return err
+	}
+	sshUser, server, err := app.App.Sshd.SshdIO.GetSSHUserAndServer(sshUsername, host)
+	if err != nil {
+		return err
+	}
+	if server.Status != model.InstanceStatusRunning {
+		return fmt.Errorf("%s status %s, can not login", server.Host, strings.ToLower(string(server.Status)))
+	}
+	client := (*sess).RemoteAddr().String()
+	explain, _, err := app.App.Sshd.SshdIO.ExplainUserPolicy((*sess).User(), Connect, *server, client)
+	if err != nil {
+		return err
+	}
+	if !explain.Allow {
+		return EmitDenied(sess, *server, fmt.Errorf("no permission for %s: %s", server.Host, explain.Message))
+	}
+	if !explain.AllowLoginUser(sshUser.UserName) {
+		return EmitDenied(sess, *server, fmt.Errorf("no permission for %s as %s", server.Host, sshUser.UserName))
+	}
+	if explain.Notice != "" {
+		Info(explain.Notice, sess)
+	}
+	// 记录登录日志到数据库
+	err = app.App.DBIo.AddServerLoginRecord(&AddSshLoginRequest{
+		TargetServer: tea.String(server.Host),
+		InstanceID:   tea.String(server.ID),
+		User:         tea.String((*sess).User()),
+		Client:       tea.String(client),
+	})
+	if err != nil {
+		log.Errorf("create ssh login record error: %s", err)
+	}
+	return NewTerminal(*server, *sshUser, sess)
+}
+
+// EmitDenied 记录无权限连接的审计事件，返回原错误
+func EmitDenied(sess *ssh.Session, server Server, err error) error {
+	e := siem.ServerEvent(AuditDenied, "connect", AuditFailure, (*sess).User(), (*sess).RemoteAddr().String(), server)
+	e.Message = err.Error()
+	siem.Emit(e)
+	return err
+}
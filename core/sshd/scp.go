@@ -17,6 +17,7 @@ import (
 	gossh "golang.org/x/crypto/ssh"
 
 	"github.com/xops-infra/jms/app"
+	"github.com/xops-infra/jms/core/siem"
 	. "github.com/xops-infra/jms/model"
 	"github.com/xops-infra/jms/utils"
 )
@@ -101,8 +102,9 @@ func ExecuteSCP(args []string, clientSess *ssh.Session) error {
 			log.Debugf("arg: %s", arg)
 			switch arg {
 			case "-t":
-				err := app.App.Sshd.SshdIO.CheckPermission(args[1], user, Upload)
+				err := app.App.Sshd.SshdIO.CheckPermission(args[1], user, Upload, (*clientSess).RemoteAddr().String())
 				if err != nil {
+					siem.Emit(scpEvent(AuditDenied, Upload, AuditFailure, *clientSess, args[1], "", err))
 					replyErr(*clientSess, err)
 					return err
 				}
@@ -114,8 +116,9 @@ func ExecuteSCP(args []string, clientSess *ssh.Session) error {
 				(*clientSess).Close()
 				return nil
 			case "-f":
-				err := app.App.Sshd.SshdIO.CheckPermission(args[1], user, Download)
+				err := app.App.Sshd.SshdIO.CheckPermission(args[1], user, Download, (*clientSess).RemoteAddr().String())
 				if err != nil {
+					siem.Emit(scpEvent(AuditDenied, Download, AuditFailure, *clientSess, args[1], "", err))
 					replyErr(*clientSess, err)
 					return err
 				}
@@ -176,6 +179,7 @@ func copyToServer(args []string, clientSess *ssh.Session) error {
 			}
 		}
 
+		siem.Emit(scpEvent(AuditScp, Upload, AuditSuccess, *clientSess, args[1], filename, nil))
 		log.Infof("user %s upload file %s to %s success", (*clientSess).User(), filename, args[1])
 		return nil
 	case flagEndDirectory:
@@ -295,6 +299,7 @@ func copyFromServer(args []string, sess *ssh.Session) error {
 					log.Errorf("record scp download file to db failed: %v", err)
 				}
 			}
+			siem.Emit(scpEvent(AuditScp, Download, AuditSuccess, *sess, args[1], filename, nil))
 			log.Infof("user %s download file %s from %s success", (*sess).User(), filename, args[1])
 			return
 		case flagEndDirectory:
@@ -597,3 +602,19 @@ func replyErr(w io.Writer, replyErr error) error {
 	}
 	return nil
 }
+
+// 上传下载的审计事件，target 为 root@10.9.x.x:/data/xx.zip
+func scpEvent(eventType AuditEventType, action Action, result string, sess ssh.Session, target, filename string, err error) AuditEvent {
+	e := NewAuditEvent(eventType, string(action), result, sess.User(), sess.RemoteAddr().String())
+	e.Data = map[string]interface{}{"target": target}
+	if _, host, _, parseErr := ParseScpTarget(target); parseErr == nil {
+		e.Server = host
+	}
+	if filename != "" {
+		e.Data["file"] = filename
+	}
+	if err != nil {
+		e.Message = err.Error()
+	}
+	return e
+}
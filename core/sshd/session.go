@@ -0,0 +1,76 @@
+package sshd
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xops-infra/noop/log"
+
+	"github.com/xops-infra/jms/core/siem"
+	. "github.com/xops-infra/jms/model"
+)
+
+// 正在连接中的终端会话，用于按策略变化主动断开
+type ActiveSession struct {
+	ID      string
+	User    string
+	Client  string
+	Server  Server
+	StartAt time.Time
+
+	closeOnce sync.Once
+	close     func(reason string)
+}
+
+// 断开会话，reason 会提示给用户
+func (s *ActiveSession) Close(reason string) {
+	s.closeOnce.Do(func() {
+		log.Warnf("close session %s user: %s server: %s, reason: %s", s.ID, s.User, s.Server.Host, reason)
+		s.close(reason)
+	})
+}
+
+var activeSessions sync.Map // id -> *ActiveSession
+
+func registerSession(user, client string, server Server, close func(reason string)) *ActiveSession {
+	sess := &ActiveSession{
+		ID:      uuid.NewString(),
+		User:    user,
+		Client:  client,
+		Server:  server,
+		StartAt: time.Now(),
+		close:   close,
+	}
+	activeSessions.Store(sess.ID, sess)
+	e := siem.ServerEvent(AuditLogin, "connect", AuditSuccess, user, client, server)
+	e.Data["session_id"] = sess.ID
+	siem.Emit(e)
+	return sess
+}
+
+func unregisterSession(id string) {
+	value, ok := activeSessions.LoadAndDelete(id)
+	if !ok {
+		return
+	}
+	sess := value.(*ActiveSession)
+	e := siem.ServerEvent(AuditLogout, "disconnect", AuditSuccess, sess.User, sess.Client, sess.Server)
+	e.Data["session_id"] = sess.ID
+	e.Data["duration"] = time.Since(sess.StartAt).Seconds()
+	siem.Emit(e)
+}
+
+// 按开始时间排序
+func ListActiveSessions() []*ActiveSession {
+	var sessions []*ActiveSession
+	activeSessions.Range(func(key, value any) bool {
+		sessions = append(sessions, value.(*ActiveSession))
+		return true
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartAt.Before(sessions[j].StartAt)
+	})
+	return sessions
+}
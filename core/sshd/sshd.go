@@ -82,9 +82,12 @@ func NewTerminal(server Server, sshUser SSHUser, sess *ssh.Session) error {
 	// 发送屏幕清理指令
 	// (*sess).Write([]byte("\033c"))
 
+	reader, writer, closeRecord := withBreakGlassRecord((*sess).User(), server, *sess, writer)
+	defer closeRecord()
+
 	// 创建同时写入日志文件和终端的写入器
 	upstreamSess.Stdout = writer
-	upstreamSess.Stdin = *sess
+	upstreamSess.Stdin = reader
 	upstreamSess.Stderr = writer
 
 	pty, winCh, _ := (*sess).Pty()
@@ -107,6 +110,13 @@ func NewTerminal(server Server, sshUser SSHUser, sess *ssh.Session) error {
 	app.App.Sshd.UserCache.Set((*sess).RemoteAddr().String(), true, cache.DefaultExpiration)
 	defer app.App.Sshd.UserCache.Delete((*sess).RemoteAddr().String())
 
+	active := registerSession((*sess).User(), (*sess).RemoteAddr().String(), server, func(reason string) {
+		ErrorInfo(fmt.Errorf("\r\nsession closed by jms: %s", reason), sess)
+		upstreamSess.Close()
+		(*sess).Close()
+	})
+	defer unregisterSession(active.ID)
+
 	if err := upstreamSess.Wait(); err != nil {
 		return err
 	}
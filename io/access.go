@@ -0,0 +1,87 @@
+package io
+
+import (
+	"fmt"
+
+	"github.com/alibabacloud-go/tea/tea"
+
+	"github.com/xops-infra/jms/model"
+)
+
+// 用户能访问的服务器，逐台服务器按系统规则和用户策略判断
+func (p *SshdIO) UserAccessReport(username string) (model.AccessReport, error) {
+	if p.db == nil {
+		return nil, fmt.Errorf("db is not enable")
+	}
+	user, err := p.db.DescribeUser(username)
+	if err != nil {
+		return nil, fmt.Errorf("user %s not found: %s", username, err)
+	}
+	servers, err := p.db.LoadServer()
+	if err != nil {
+		return nil, err
+	}
+	policies, err := p.db.QueryPolicyByUser(username)
+	if err != nil {
+		return nil, err
+	}
+	report := model.AccessReport{}
+	for _, server := range servers {
+		item := p.accessReportItem(user, server, policies)
+		if item.Reachable() {
+			report = append(report, item)
+		}
+	}
+	return report, nil
+}
+
+// 反向查询能访问服务器的用户，server 支持 IP，名称或者 ID
+func (p *SshdIO) ServerAccessReport(serverKey string) (model.AccessReport, error) {
+	if p.db == nil {
+		return nil, fmt.Errorf("db is not enable")
+	}
+	server, err := p.db.FindServer(serverKey)
+	if err != nil {
+		return nil, err
+	}
+	users, err := p.db.QueryAllUser()
+	if err != nil {
+		return nil, err
+	}
+	policies, err := p.db.QueryAllPolicy()
+	if err != nil {
+		return nil, err
+	}
+	report := model.AccessReport{}
+	for _, user := range users {
+		if user.Username == nil || tea.BoolValue(user.IsDeleted) {
+			continue
+		}
+		var userPolicies []model.Policy
+		for _, policy := range policies {
+			if policy.MatchSubject(user) != "" {
+				userPolicies = append(userPolicies, policy)
+			}
+		}
+		item := p.accessReportItem(user, *server, userPolicies)
+		if item.Reachable() {
+			report = append(report, item)
+		}
+	}
+	return report, nil
+}
+
+func (p *SshdIO) accessReportItem(user model.User, server model.Server, policies []model.Policy) model.AccessReportItem {
+	item := model.AccessReportItem{
+		ServerID:   server.ID,
+		ServerName: server.Name,
+		ServerHost: server.Host,
+	}
+	if user.Username != nil {
+		item.User = *user.Username
+	}
+	for _, action := range model.ReportActions {
+		item.Grants = append(item.Grants, model.NewAccessGrant(p.ExplainPolicy(user, action, server, policies, false, "")))
+	}
+	return item
+}
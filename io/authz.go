@@ -0,0 +1,12 @@
+package io
+
+import (
+	"github.com/xops-infra/jms/core/authz"
+	"github.com/xops-infra/jms/model"
+)
+
+// WithAuthzHook 启用连接前的外部授权
+func (p *SshdIO) WithAuthzHook(conf model.WithAuthzHook) *SshdIO {
+	p.authz = authz.New(conf)
+	return p
+}
@@ -12,49 +12,81 @@ import (
 
 // 对用户，策略，服务器，动作做权限判断
 // onlyIp 用来兼容策略对上传下载的判断，因为上传下载信息只会有 IP 信息。
-func (p *SshdIO) MatchPolicy(user model.User, inPutAction model.Action, server model.Server, dbPolicies []model.Policy, onlyIp bool) bool {
+// client 是 jms 客户端地址，用于判断策略的来源地址限制
+func (p *SshdIO) MatchPolicy(user model.User, inPutAction model.Action, server model.Server, dbPolicies []model.Policy, onlyIp bool, client string) bool {
+	explain := p.ExplainPolicy(user, inPutAction, server, dbPolicies, onlyIp, client)
+	if len(explain.DenyPolicies) > 0 {
+		log.Infof("deny policy got! %s", tea.Prettify(explain.DenyPolicies))
+	}
+	return explain.Allow
+}
+
+// MatchLocalPolicy 只用本地策略判断，不调用外部授权，PUI 列出服务器时使用
+// 避免每次打开菜单对每台服务器调用一次授权服务，真正连接时再经过外部授权
+func (p *SshdIO) MatchLocalPolicy(user model.User, inPutAction model.Action, server model.Server, dbPolicies []model.Policy, onlyIp bool, client string) bool {
+	return p.explainLocalPolicy(user, inPutAction, server, dbPolicies, onlyIp, client).Allow
+}
 
+// 权限判断并返回判断依据，系统规则优先，其次是数据库策略，允许后再经过外部授权
+func (p *SshdIO) ExplainPolicy(user model.User, inPutAction model.Action, server model.Server, dbPolicies []model.Policy, onlyIp bool, client string) *model.PolicyExplain {
+	explain := p.explainLocalPolicy(user, inPutAction, server, dbPolicies, onlyIp, client)
+	p.authz.Apply(explain, user, inPutAction, server, client)
+	return explain
+}
+
+func (p *SshdIO) explainLocalPolicy(user model.User, inPutAction model.Action, server model.Server, dbPolicies []model.Policy, onlyIp bool, client string) *model.PolicyExplain {
 	if p.db == nil {
 		// 没有启用数据库策略的直接通过
 		log.Debugf("db is not enable, allow all")
-		return true
+		return &model.PolicyExplain{
+			User:       tea.StringValue(user.Username),
+			Action:     inPutAction,
+			ServerID:   server.ID,
+			ServerName: server.Name,
+			ServerHost: server.Host,
+			Allow:      true,
+			Message:    "db is not enable, allow all",
+		}
 	}
-	if p.SystemPolicyCheck(user, server) {
-		log.Debugf("system policy allow for user: %s", tea.Prettify(user))
-		return true
+	if rule := p.SystemPolicyRule(user, inPutAction, server); rule != "" {
+		log.Debugf("system policy %s allow for user: %s", rule, tea.Prettify(user))
+		explain := model.ExplainPolicies(user, inPutAction, server, nil, onlyIp, client, time.Now())
+		explain.Allow = true
+		explain.SystemRule = rule
+		explain.Message = fmt.Sprintf("allowed by system rule %s", rule)
+		return explain
 	}
+	return model.ExplainPolicies(user, inPutAction, server, dbPolicies, onlyIp, client, time.Now())
+}
 
-	isOK := false
-	for _, dbPolicy := range dbPolicies {
-		if !dbPolicy.IsEnabled {
-			log.Debugf("policy %s is disabled", dbPolicy.Name)
-			continue
-		}
-		// 策略失效也直接 pass
-		if dbPolicy.ExpiresAt.Before(time.Now()) {
-			log.Debugf("policy %s is expired", dbPolicy.Name)
-			continue
-		}
+// 按用户名实时查询用户和策略做判断，连接前使用
+func (p *SshdIO) ExplainUserPolicy(username string, inPutAction model.Action, server model.Server, client string) (*model.PolicyExplain, []model.Policy, error) {
+	explain, user, policies, err := p.explainUserLocalPolicy(username, inPutAction, server, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.authz.Apply(explain, user, inPutAction, server, client)
+	return explain, policies, nil
+}
 
-		// 数据库查 policy的时候已经过滤了非当前用户的情况
-		// if !dbPolicy.Users.Contains(*user.Username) {
-		// 	log.Debugf("policy %s is not for user %s", dbPolicy.Name, *user.Username)
-		// 	continue
-		// }
-		allow := model.PolicyCheck(inPutAction, server, dbPolicy, onlyIp)
+// ExplainUserLocalPolicy 只用本地策略判断，不调用外部授权，会话定时检查和 PUI 菜单使用
+// 避免每分钟对所有会话调用授权服务，以及授权服务故障时断开本地策略仍然允许的会话
+func (p *SshdIO) ExplainUserLocalPolicy(username string, inPutAction model.Action, server model.Server, client string) (*model.PolicyExplain, []model.Policy, error) {
+	explain, _, policies, err := p.explainUserLocalPolicy(username, inPutAction, server, client)
+	return explain, policies, err
+}
 
-		if allow == nil {
-			continue
-		}
-		if !*allow {
-			// 找到拒绝的策略直接拒绝
-			log.Infof("deny policy got! %s '%s', stop check other policy", dbPolicy.ID, dbPolicy.Name)
-			return false
+func (p *SshdIO) explainUserLocalPolicy(username string, inPutAction model.Action, server model.Server, client string) (*model.PolicyExplain, model.User, []model.Policy, error) {
+	user := model.User{Username: &username}
+	if p.db != nil {
+		dbUser, err := p.db.DescribeUser(username)
+		if err != nil {
+			return nil, user, nil, fmt.Errorf("user %s not found: %s", username, err)
 		}
-		// 找到允许的策略继续多策略校验
-		isOK = true
+		user = dbUser
 	}
-	return isOK
+	policies := p.GetUserPolicys(username)
+	return p.explainLocalPolicy(user, inPutAction, server, policies, false, client), user, policies, nil
 }
 
 func (p *SshdIO) GetUserPolicys(username string) []model.Policy {
@@ -67,26 +99,24 @@ func (p *SshdIO) GetUserPolicys(username string) []model.Policy {
 			Users:     model.ArrayString{username},
 		})
 	} else {
-		policies, err := p.db.QueryAllPolicy()
+		policies, err := p.db.QueryPolicyByUser(username)
 		if err != nil {
-			log.Errorf("query all policy error: %s", err)
+			log.Errorf("query user policy error: %s", err)
 			return nil
 		}
 		for _, policy := range policies {
-			if policy.Users.Contains(username) {
-				if policy.IsDeleted || !policy.IsEnabled {
-					continue
-				}
-				// log.Debugf("policy: %s", tea.Prettify(policy))
-				matchPolicies = append(matchPolicies, policy)
+			if policy.IsDeleted || !policy.IsEnabled {
+				continue
 			}
+			// log.Debugf("policy: %s", tea.Prettify(policy))
+			matchPolicies = append(matchPolicies, policy)
 		}
 	}
 	return matchPolicies
 }
 
 // argsWithServer 是 root@10.9.x.x:/data/xx.zip 这一串组合字符，方法内会解析
-func (p *SshdIO) CheckPermission(argsWithServer string, user model.User, inputAction model.Action) error {
+func (p *SshdIO) CheckPermission(argsWithServer string, user model.User, inputAction model.Action, client string) error {
 	serverIP, err := model.ExtractIP(argsWithServer)
 	if err != nil {
 		return err
@@ -99,57 +129,27 @@ func (p *SshdIO) CheckPermission(argsWithServer string, user model.User, inputAc
 	}
 	dbPolicies := p.GetUserPolicys(*user.Username)
 	// 判断是否有权限
-	if !p.MatchPolicy(user, inputAction, *server, dbPolicies, true) {
-		return fmt.Errorf("user: %s has no permission to %s server: %s", *user.Username, inputAction, serverIP)
+	explain := p.ExplainPolicy(user, inputAction, *server, dbPolicies, true, client)
+	if !explain.Allow {
+		return fmt.Errorf("user: %s has no permission to %s server: %s, %s", *user.Username, inputAction, serverIP, explain.Message)
+	}
+	// 判断策略是否允许使用该登录用户
+	if loginUser, _, _, err := model.ParseScpTarget(argsWithServer); err == nil && !explain.AllowLoginUser(loginUser) {
+		return fmt.Errorf("user: %s has no permission to %s server: %s as %s", *user.Username, inputAction, serverIP, loginUser)
 	}
 	return nil
 }
 
 // System level
-func (p *SshdIO) SystemPolicyCheck(user model.User, server model.Server) bool {
-
-	if user.Groups.Contains("admin") {
-		log.Debugf("admin allow")
-		return true
-	}
-	// 用户组一致则有权限
-	if matchUserGroup(user, server) {
-		log.Debugf("team allow")
-		return true
-	}
-	// Owner和用户一样则有权限
-	if matchPolicyOwner(user, server) {
-		log.Debugf("owner allow")
-		return true
-	}
-	return false
-}
-
-// 用户组一致则有权限
-// admin有所有权限
-func matchUserGroup(user model.User, server model.Server) bool {
-	if user.Groups != nil {
-		if user.Groups.Contains("admin") {
-			return true
-		}
-		if server.Tags.GetTeam() != nil {
-			for _, group := range user.Groups {
-				if *server.Tags.GetTeam() == group {
-					return true
-				}
-			}
-		} else {
-			return false
-		}
-
-	}
-	return false
+func (p *SshdIO) SystemPolicyCheck(user model.User, inPutAction model.Action, server model.Server) bool {
+	return p.SystemPolicyRule(user, inPutAction, server) != ""
 }
 
-// Owner和用户一样则有权限
-func matchPolicyOwner(user model.User, server model.Server) bool {
-	if server.Tags.GetOwner() != nil && *server.Tags.GetOwner() == *user.Username {
-		return true
+// 返回命中的系统规则，没有命中返回空，规则见配置 systemPolicy
+func (p *SshdIO) SystemPolicyRule(user model.User, inPutAction model.Action, server model.Server) string {
+	rule := p.systemPolicy.Match(user, inPutAction, server)
+	if rule != "" {
+		log.Debugf("system rule %s allow %s", rule, inPutAction)
 	}
-	return false
+	return rule
 }
@@ -19,7 +19,7 @@ var p *io.SshdIO
 
 func init() {
 	log.Default().WithLevel(log.DebugLevel).WithFilename("/tmp/test.log").Init()
-	p = io.NewSshd(nil, nil)
+	p = io.NewSshd(nil, nil, SystemPolicy{})
 }
 
 func TestMatchServer(t *testing.T) {
@@ -84,7 +84,7 @@ func TestMatchPolicy(t *testing.T) {
 		// 测试 admin 组
 		assert.True(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			policy,
-		}, false))
+		}, false, ""))
 	}
 
 	{
@@ -96,11 +96,11 @@ func TestMatchPolicy(t *testing.T) {
 		server.Host = "127.0.0.1"
 		assert.True(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			policy,
-		}, false))
+		}, false, ""))
 		server.Host = "89.0.142.86"
 		assert.False(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			policy,
-		}, false))
+		}, false, ""))
 	}
 	{
 		// 普通用户，Name匹配
@@ -111,11 +111,11 @@ func TestMatchPolicy(t *testing.T) {
 		server.Name = "test"
 		assert.True(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			policy,
-		}, false))
+		}, false, ""))
 		server.Name = "test2"
 		assert.False(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			policy,
-		}, false))
+		}, false, ""))
 	}
 	{
 		// 普通用户，EnvType匹配
@@ -131,7 +131,7 @@ func TestMatchPolicy(t *testing.T) {
 		}
 		assert.True(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			policy,
-		}, false))
+		}, false, ""))
 		server.Tags = model.Tags{
 			{
 				Key:   "EnvType",
@@ -140,7 +140,7 @@ func TestMatchPolicy(t *testing.T) {
 		}
 		assert.False(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			policy,
-		}, false))
+		}, false, ""))
 	}
 	{
 		// 普通用户，Team匹配
@@ -157,7 +157,7 @@ func TestMatchPolicy(t *testing.T) {
 		}
 		assert.True(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			policy,
-		}, false))
+		}, false, ""))
 		server.Tags = model.Tags{
 			{
 				Key:   "Team",
@@ -166,7 +166,7 @@ func TestMatchPolicy(t *testing.T) {
 		}
 		assert.False(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			policy,
-		}, false))
+		}, false, ""))
 	}
 	{
 		// 普通用户，Owner匹配
@@ -183,7 +183,7 @@ func TestMatchPolicy(t *testing.T) {
 		}
 		assert.True(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			policy,
-		}, false))
+		}, false, ""))
 		server.Tags = model.Tags{
 			{
 				Key:   "Owner",
@@ -192,7 +192,7 @@ func TestMatchPolicy(t *testing.T) {
 		}
 		assert.False(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			policy,
-		}, false))
+		}, false, ""))
 	}
 
 }
@@ -220,7 +220,7 @@ func TestMultipolicy(t *testing.T) {
 		// 测试 deny 匹配
 		assert.True(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			defaultPolicy,
-		}, false))
+		}, false, ""))
 		assert.False(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			defaultPolicy,
 			{
@@ -232,7 +232,7 @@ func TestMultipolicy(t *testing.T) {
 					Name: []string{"*"},
 				},
 			},
-		}, false))
+		}, false, ""))
 
 		// 测试 ! 匹配
 		server.Tags = model.Tags{
@@ -251,7 +251,7 @@ func TestMultipolicy(t *testing.T) {
 					EnvType: []string{"!prod"},
 				},
 			},
-		}, false))
+		}, false, ""))
 		assert.True(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			{
 				IsEnabled: true,
@@ -262,7 +262,7 @@ func TestMultipolicy(t *testing.T) {
 					EnvType: []string{"!dev"},
 				},
 			},
-		}, false))
+		}, false, ""))
 
 		// 测试 * 匹配
 		server.Tags = model.Tags{
@@ -281,7 +281,7 @@ func TestMultipolicy(t *testing.T) {
 					Team: []string{"*"},
 				},
 			},
-		}, false))
+		}, false, ""))
 		assert.False(t, p.MatchPolicy(user, inPutAction, server, []Policy{
 			{
 				IsEnabled: true,
@@ -292,7 +292,7 @@ func TestMultipolicy(t *testing.T) {
 					Team: []string{"data"},
 				},
 			},
-		}, false))
+		}, false, ""))
 	}
 }
 
@@ -311,7 +311,7 @@ func TestCheckPermission(t *testing.T) {
 	user := User{
 		Username: tea.String("zhoushoujian"),
 	}
-	err := p.CheckPermission("root@10.9.0.1:/data/xx.zip", user, Upload)
+	err := p.CheckPermission("root@10.9.0.1:/data/xx.zip", user, Upload, "")
 
 	if err != nil {
 		t.Log("ok", err)
@@ -320,14 +320,14 @@ func TestCheckPermission(t *testing.T) {
 	}
 
 	policy.Actions = DownloadOnly
-	err = p.CheckPermission("root@10.9.0.1:/data/xx.zip", user, Upload)
+	err = p.CheckPermission("root@10.9.0.1:/data/xx.zip", user, Upload, "")
 	if err != nil {
 		t.Log("ok", err)
 	} else {
 		t.Error("shoud be error")
 	}
 
-	err = p.CheckPermission("root@10.9.0.1:/data/xx.zip", user, Download)
+	err = p.CheckPermission("root@10.9.0.1:/data/xx.zip", user, Download, "")
 	if err == nil {
 		t.Log("ok", err)
 	} else {
@@ -335,7 +335,7 @@ func TestCheckPermission(t *testing.T) {
 	}
 
 	policy.Actions = UploadOnly
-	err = p.CheckPermission("root@10.9.0.1:/data/xx.zip", user, Download)
+	err = p.CheckPermission("root@10.9.0.1:/data/xx.zip", user, Download, "")
 	if err != nil {
 		t.Log("ok", err)
 	} else {
@@ -2,9 +2,9 @@ package io
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/alibabacloud-go/tea/tea"
+	"github.com/xops-infra/jms/core/authz"
 	"github.com/xops-infra/jms/core/db"
 	"github.com/xops-infra/jms/model"
 	"github.com/xops-infra/noop/log"
@@ -13,12 +13,15 @@ import (
 type SshdIO struct {
 	db           *db.DBService
 	localServers map[string]model.ServerManual
+	systemPolicy model.SystemPolicy
+	authz        *authz.Hook // 外部授权，见 WithAuthzHook
 }
 
-func NewSshd(db *db.DBService, localServers map[string]model.ServerManual) *SshdIO {
+func NewSshd(db *db.DBService, localServers map[string]model.ServerManual, systemPolicy model.SystemPolicy) *SshdIO {
 	return &SshdIO{
 		localServers: localServers,
 		db:           db,
+		systemPolicy: systemPolicy.WithDefaults(),
 	}
 }
 
@@ -89,46 +92,48 @@ func (i *SshdIO) GetSSHUsersByHost(host string, servers map[string]model.Server,
 
 // 依据 scp的路径获取 sshuser和服务器
 // 返回 sshuser 和 服务器 remotePath
+// 登录用户的策略限制在 CheckPermission 里判断，这里只负责查找认证信息
 func (i *SshdIO) GetSSHUserAndServerByScpPath(scpPath string) (*model.SSHUser, *model.Server, string, error) {
-
-	args := strings.SplitN(scpPath, ":", 2)
-
-	if len(args) < 2 {
-		return nil, nil, "", fmt.Errorf("scp path %s invalid", scpPath)
+	sshUsername, host, remotePath, err := model.ParseScpTarget(scpPath)
+	if err != nil {
+		return nil, nil, "", err
 	}
-
-	inputServer, remotePath := args[0], args[1]
-	serverArgs := strings.SplitN(inputServer, "@", 2)
-	if len(serverArgs) < 2 {
+	if remotePath == "" {
 		return nil, nil, "", fmt.Errorf("scp path %s invalid", scpPath)
 	}
+	sshUser, server, err := i.GetSSHUserAndServer(sshUsername, host)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return sshUser, server, remotePath, nil
+}
 
-	sshUsername, host := serverArgs[0], serverArgs[1]
-
+// 依据登录用户和服务器 IP 查找认证信息，scp 和直连登录共用
+func (i *SshdIO) GetSSHUserAndServer(sshUsername, host string) (*model.SSHUser, *model.Server, error) {
 	servers, err := i.db.LoadServer()
 	if err != nil {
-		return nil, nil, "", fmt.Errorf("load server error: %s", err.Error())
+		return nil, nil, fmt.Errorf("load server error: %s", err.Error())
 	}
 	serversMap := servers.ToMap()
 
 	keys, err := i.db.InternalLoadKey()
 	if err != nil {
-		return nil, nil, "", fmt.Errorf("load key error: %s", err.Error())
+		return nil, nil, fmt.Errorf("load key error: %s", err.Error())
 	}
 
 	if server, ok := serversMap[host]; ok {
 		// 获取机器ssh用户
 		sshusers, err := i.GetSSHUsersByHost(host, serversMap, keys)
 		if err != nil {
-			return nil, nil, "", fmt.Errorf("get sshuser error: %s", err.Error())
+			return nil, nil, fmt.Errorf("get sshuser error: %s", err.Error())
 		}
 		for _, sshuser := range sshusers {
 			if sshuser.UserName == sshUsername {
-				return &sshuser, &server, remotePath, nil
+				return &sshuser, &server, nil
 			}
 		}
-		return nil, nil, "", fmt.Errorf("user %s not found in server %s", sshUsername, host)
+		return nil, nil, fmt.Errorf("user %s not found in server %s", sshUsername, host)
 	} else {
-		return nil, nil, "", fmt.Errorf("server %s not found", host)
+		return nil, nil, fmt.Errorf("server %s not found", host)
 	}
 }
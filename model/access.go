@@ -0,0 +1,98 @@
+package model
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 权限报表里统计的动作
+var ReportActions = []Action{Connect, Download, Upload}
+
+// 某个动作的授权情况
+type AccessGrant struct {
+	Action     Action      `json:"action"`
+	Allow      bool        `json:"allow"`
+	SystemRule string      `json:"system_rule,omitempty"`
+	Policies   []PolicyRef `json:"policies"`             // 允许时是授权的策略，拒绝时是拒绝的策略
+	ExpiresAt  *time.Time  `json:"expires_at,omitempty"` // 授权策略中最晚的过期时间，系统规则授权没有过期时间
+}
+
+func NewAccessGrant(explain *PolicyExplain) AccessGrant {
+	grant := AccessGrant{
+		Action:     explain.Action,
+		Allow:      explain.Allow,
+		SystemRule: explain.SystemRule,
+		Policies:   explain.DenyPolicies,
+	}
+	if !explain.Allow {
+		return grant
+	}
+	grant.Policies = explain.AllowPolicies
+	if explain.SystemRule != "" {
+		return grant
+	}
+	for _, policy := range explain.AllowPolicies {
+		if grant.ExpiresAt == nil || policy.ExpiresAt.After(*grant.ExpiresAt) {
+			expiresAt := policy.ExpiresAt
+			grant.ExpiresAt = &expiresAt
+		}
+	}
+	return grant
+}
+
+type AccessReportItem struct {
+	User       string        `json:"user"`
+	ServerID   string        `json:"server_id"`
+	ServerName string        `json:"server_name"`
+	ServerHost string        `json:"server_host"`
+	Grants     []AccessGrant `json:"grants"`
+}
+
+// 有任意一个动作有权限
+func (a AccessReportItem) Reachable() bool {
+	for _, grant := range a.Grants {
+		if grant.Allow {
+			return true
+		}
+	}
+	return false
+}
+
+type AccessReport []AccessReportItem
+
+// 导出 CSV，每个动作一行
+func (r AccessReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"user", "server_id", "server_name", "server_host", "action", "allow", "granted_by", "expires_at"})
+	if err != nil {
+		return err
+	}
+	for _, item := range r {
+		for _, grant := range item.Grants {
+			var grantedBy []string
+			if grant.SystemRule != "" {
+				grantedBy = append(grantedBy, "system:"+grant.SystemRule)
+			}
+			for _, policy := range grant.Policies {
+				grantedBy = append(grantedBy, "policy:"+policy.ID)
+			}
+			expiresAt := ""
+			if grant.ExpiresAt != nil {
+				expiresAt = grant.ExpiresAt.Format(time.RFC3339)
+			}
+			err := writer.Write([]string{
+				item.User, item.ServerID, item.ServerName, item.ServerHost,
+				string(grant.Action), strconv.FormatBool(grant.Allow),
+				strings.Join(grantedBy, ";"), expiresAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
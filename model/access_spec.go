@@ -0,0 +1,348 @@
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"gopkg.in/yaml.v3"
+)
+
+// 声明式配置的资源类型
+const (
+	SpecKindUser   = "user"
+	SpecKindPolicy = "policy"
+	SpecKindProxy  = "proxy"
+	SpecKindKey    = "key"
+
+	DefaultSpecOwner = "jms-apply"
+)
+
+// AccessSpec jms apply -f access.yaml 的文件格式，字段和对应接口的请求体一致
+// 只比较文件里写了的字段，没写的字段保持数据库现状
+type AccessSpec struct {
+	Owner    string               `json:"owner,omitempty"` // 归属标记，apply 只会修改和清理自己创建的资源
+	Users    []UserRequest        `json:"users,omitempty"`
+	Policies []PolicyRequest      `json:"policies,omitempty"`
+	Proxies  []CreateProxyRequest `json:"proxies,omitempty"`
+	Keys     []AddKeyRequest      `json:"keys,omitempty"` // 只同步元数据，pem_base64 只在新建时使用
+}
+
+// ManagedResource 记录 apply 管理的资源和上次 apply 后的状态摘要，用于判断是否被接口手工修改
+type ManagedResource struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at"`
+	Kind      string    `json:"kind" gorm:"column:kind;type:varchar(32);not null"`
+	Name      string    `json:"name" gorm:"column:name;type:varchar(255);not null"`
+	Owner     string    `json:"owner" gorm:"column:owner;type:varchar(255);not null"`
+	Hash      string    `json:"hash" gorm:"column:hash;type:varchar(64);not null"`
+}
+
+func (ManagedResource) TableName() string {
+	return "jms_go_managed_resource"
+}
+
+// yaml 先转成 json 再解析，复用接口请求体的 json tag
+func ParseAccessSpec(data []byte) (*AccessSpec, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse yaml error: %s", err)
+	}
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse yaml error: %s", err)
+	}
+	var spec AccessSpec
+	if err := json.Unmarshal(jsonData, &spec); err != nil {
+		return nil, fmt.Errorf("parse spec error: %s", err)
+	}
+	if spec.Owner == "" {
+		spec.Owner = DefaultSpecOwner
+	}
+	return &spec, spec.Validate()
+}
+
+func (s *AccessSpec) Validate() error {
+	seen := map[string]bool{}
+	check := func(kind, name string) error {
+		if name == "" {
+			return fmt.Errorf("%s name is empty", kind)
+		}
+		if seen[kind+"/"+name] {
+			return fmt.Errorf("%s %s duplicated", kind, name)
+		}
+		seen[kind+"/"+name] = true
+		return nil
+	}
+	for _, user := range s.Users {
+		if err := check(SpecKindUser, tea.StringValue(user.Username)); err != nil {
+			return err
+		}
+	}
+	for _, policy := range s.Policies {
+		if err := check(SpecKindPolicy, tea.StringValue(policy.Name)); err != nil {
+			return err
+		}
+		if policy.ServerFilterV1 != nil {
+			if err := policy.ServerFilterV1.Validate(); err != nil {
+				return fmt.Errorf("policy %s: %s", *policy.Name, err)
+			}
+		}
+		if policy.Schedule != nil {
+			if err := policy.Schedule.Validate(); err != nil {
+				return fmt.Errorf("policy %s: %s", *policy.Name, err)
+			}
+		}
+		if err := ValidateSourceCIDRs(policy.SourceCIDRs); err != nil {
+			return fmt.Errorf("policy %s: %s", *policy.Name, err)
+		}
+	}
+	for _, proxy := range s.Proxies {
+		if err := check(SpecKindProxy, tea.StringValue(proxy.Name)); err != nil {
+			return err
+		}
+	}
+	for _, key := range s.Keys {
+		if err := check(SpecKindKey, tea.StringValue(key.KeyID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 导出为 yaml，字段名和 apply 的格式一致
+func (s *AccessSpec) ToYAML() ([]byte, error) {
+	jsonData, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	if err := json.Unmarshal(jsonData, &raw); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(dropNull(raw)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), encoder.Close()
+}
+
+func dropNull(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if item == nil {
+				delete(val, k)
+				continue
+			}
+			val[k] = dropNull(item)
+		}
+		return val
+	case []interface{}:
+		for i := range val {
+			val[i] = dropNull(val[i])
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// 数据库里的策略转为声明式格式，时间统一为 UTC 方便对比
+func PolicyToSpec(policy Policy) PolicyRequest {
+	expiresAt := policy.ExpiresAt.UTC()
+	return PolicyRequest{
+		Name:           tea.String(policy.Name),
+		Users:          policy.Users,
+		Groups:         policy.Groups,
+		Actions:        policy.Actions,
+		ServerFilterV1: policy.ServerFilterV1,
+		ExpiresAt:      &expiresAt,
+		IsEnabled:      tea.Bool(policy.IsEnabled),
+		Schedule:       policy.Schedule,
+		SourceCIDRs:    policy.SourceCIDRs,
+		LoginUsers:     policy.LoginUsers,
+	}
+}
+
+// 密码不导出
+func UserToSpec(user User) UserRequest {
+	return UserRequest{
+		Username:       user.Username,
+		Email:          user.Email,
+		Groups:         user.Groups,
+		DingtalkID:     user.DingtalkID,
+		DingtalkDeptID: user.DingtalkDeptID,
+		FeishuID:       user.FeishuID,
+	}
+}
+
+// 密码不导出
+func ProxyToSpec(proxy CreateProxyRequest) CreateProxyRequest {
+	proxy.LoginPasswd = nil
+	return proxy
+}
+
+// 私钥不导出
+func KeyToSpec(key Key) AddKeyRequest {
+	return AddKeyRequest{
+		IdentityFile: tea.String(key.KeyName),
+		UserName:     tea.String(key.UserName),
+		KeyID:        tea.String(key.KeyID),
+		Profile:      tea.String(key.Profile),
+	}
+}
+
+// SpecHash 资源当前状态的摘要，敏感字段不参与计算
+func SpecHash(v interface{}) string {
+	data, _ := json.Marshal(specMap(v))
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func specMap(v interface{}) map[string]interface{} {
+	m := ToRedactedMap(v)
+	for k := range m {
+		if secretFields[strings.ReplaceAll(strings.ToLower(k), "_", "")] {
+			delete(m, k)
+		}
+	}
+	return m
+}
+
+// DiffSpec 只对比期望状态里写了的字段，敏感字段不对比
+func DiffSpec(current, desired interface{}) map[string]ChangeItem {
+	cur, want := specMap(current), specMap(desired)
+	diff := make(map[string]ChangeItem)
+	for k, v := range want {
+		if v == nil {
+			continue
+		}
+		if item := DiffChange(map[string]interface{}{k: cur[k]}, map[string]interface{}{k: v}); len(item) > 0 {
+			diff[k] = item[k]
+		}
+	}
+	return diff
+}
+
+type ApplyOp string
+
+const (
+	ApplyCreate ApplyOp = "create"
+	ApplyUpdate ApplyOp = "update"
+	ApplyDelete ApplyOp = "delete"
+	ApplySkip   ApplyOp = "skip"
+)
+
+type ApplyOptions struct {
+	DryRun bool // 只输出变更计划
+	Prune  bool // 删除归属于 owner 但文件里已经没有的资源
+	Force  bool // 接管未归属或被手工修改过的资源
+}
+
+type ApplyChange struct {
+	Kind    string                `json:"kind"`
+	Name    string                `json:"name"`
+	Op      ApplyOp               `json:"op"`
+	Reason  string                `json:"reason,omitempty"`
+	Changes map[string]ChangeItem `json:"changes,omitempty"`
+}
+
+type ApplyPlan []ApplyChange
+
+var applyOpSymbol = map[ApplyOp]string{
+	ApplyCreate: "+",
+	ApplyUpdate: "~",
+	ApplyDelete: "-",
+	ApplySkip:   "!",
+}
+
+// WriteText 输出类似 diff 的变更计划
+func (p ApplyPlan) WriteText(w io.Writer) {
+	if len(p) == 0 {
+		fmt.Fprintln(w, "no changes")
+		return
+	}
+	for _, change := range p {
+		line := fmt.Sprintf("%s %s %s", applyOpSymbol[change.Op], change.Kind, change.Name)
+		if change.Reason != "" {
+			line += fmt.Sprintf(" (%s)", change.Reason)
+		}
+		fmt.Fprintln(w, line)
+		fields := make([]string, 0, len(change.Changes))
+		for field := range change.Changes {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			item := change.Changes[field]
+			before, _ := json.Marshal(item.Before)
+			after, _ := json.Marshal(item.After)
+			fmt.Fprintf(w, "    %s: %s => %s\n", field, before, after)
+		}
+	}
+}
+
+// SpecResource 同一个资源的期望状态、当前状态和归属记录
+type SpecResource struct {
+	Kind    string
+	Name    string
+	Current interface{} // 数据库当前状态，不存在为 nil
+	Desired interface{} // 文件里的期望状态，文件里没有为 nil
+	Managed *ManagedResource
+}
+
+// Plan 计算单个资源的变更，返回 nil 表示不需要变更
+func (r SpecResource) Plan(owner string, opt ApplyOptions) *ApplyChange {
+	change := &ApplyChange{Kind: r.Kind, Name: r.Name}
+	owned := r.Managed != nil && r.Managed.Owner == owner
+	drifted := owned && r.Current != nil && SpecHash(r.Current) != r.Managed.Hash
+	if r.Desired == nil {
+		// 只清理归属于自己的资源
+		if !opt.Prune || !owned || r.Current == nil {
+			return nil
+		}
+		if drifted && !opt.Force {
+			change.Op = ApplySkip
+			change.Reason = "changed outside apply, use --force to prune"
+			return change
+		}
+		change.Op = ApplyDelete
+		return change
+	}
+	if r.Current == nil {
+		change.Op = ApplyCreate
+		return change
+	}
+	changes := DiffSpec(r.Current, r.Desired)
+	if len(changes) == 0 {
+		return nil
+	}
+	change.Changes = changes
+	switch {
+	case opt.Force:
+		change.Op = ApplyUpdate
+	case r.Managed == nil:
+		change.Op = ApplySkip
+		change.Reason = fmt.Sprintf("exists but not managed by %s, use --force to take over", owner)
+	case !owned:
+		change.Op = ApplySkip
+		change.Reason = fmt.Sprintf("managed by %s", r.Managed.Owner)
+	case drifted:
+		change.Op = ApplySkip
+		change.Reason = "changed outside apply, use --force to overwrite"
+	default:
+		change.Op = ApplyUpdate
+	}
+	return change
+}
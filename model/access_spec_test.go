@@ -0,0 +1,92 @@
+package model_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestParseAccessSpec(t *testing.T) {
+	spec, err := model.ParseAccessSpec([]byte(`
+users:
+  - username: alice
+    groups: [sre]
+policies:
+  - name: sre
+    groups: [sre]
+    actions: [connect]
+    server_filter:
+      ip_addr: ["10.0.0.0/16"]
+    expires_at: 2030-01-01T00:00:00Z
+    is_enabled: true
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, model.DefaultSpecOwner, spec.Owner)
+	assert.Equal(t, model.ArrayString{"sre"}, spec.Users[0].Groups)
+	assert.Equal(t, []string{"10.0.0.0/16"}, spec.Policies[0].ServerFilterV1.IpAddr)
+	assert.True(t, *spec.Policies[0].IsEnabled)
+
+	// 导出后可以再次解析
+	data, err := spec.ToYAML()
+	assert.NoError(t, err)
+	again, err := model.ParseAccessSpec(data)
+	assert.NoError(t, err)
+	assert.Equal(t, spec.Policies[0].ExpiresAt.UTC(), again.Policies[0].ExpiresAt.UTC())
+
+	_, err = model.ParseAccessSpec([]byte("users:\n  - username: a\n  - username: a\n"))
+	assert.Error(t, err)
+	_, err = model.ParseAccessSpec([]byte("policies:\n  - name: p\n    server_filter:\n      name: [\"~(\"]\n"))
+	assert.Error(t, err)
+}
+
+func TestSpecResource_Plan(t *testing.T) {
+	current := model.UserRequest{Username: tea.String("alice"), Groups: model.ArrayString{"sre"}}
+	desired := model.UserRequest{Username: tea.String("alice"), Groups: model.ArrayString{"sre", "ops"}}
+	owned := &model.ManagedResource{Kind: model.SpecKindUser, Name: "alice", Owner: "gitops", Hash: model.SpecHash(current)}
+	opt := model.ApplyOptions{}
+
+	plan := func(r model.SpecResource, opt model.ApplyOptions) model.ApplyOp {
+		r.Kind, r.Name = model.SpecKindUser, "alice"
+		change := r.Plan("gitops", opt)
+		if change == nil {
+			return ""
+		}
+		return change.Op
+	}
+	assert.Equal(t, model.ApplyCreate, plan(model.SpecResource{Desired: desired}, opt))
+	assert.Equal(t, model.ApplyUpdate, plan(model.SpecResource{Current: current, Desired: desired, Managed: owned}, opt))
+	assert.Equal(t, model.ApplyOp(""), plan(model.SpecResource{Current: current, Desired: current, Managed: owned}, opt))
+
+	// 没写的字段和密码不参与对比
+	assert.Equal(t, model.ApplyOp(""), plan(model.SpecResource{Current: current, Desired: model.UserRequest{Username: tea.String("alice"), Passwd: tea.String("x")}, Managed: owned}, opt))
+
+	// 手工创建或者被其他 owner 管理的资源不修改
+	assert.Equal(t, model.ApplySkip, plan(model.SpecResource{Current: current, Desired: desired}, opt))
+	other := *owned
+	other.Owner = "other"
+	assert.Equal(t, model.ApplySkip, plan(model.SpecResource{Current: current, Desired: desired, Managed: &other}, opt))
+	assert.Equal(t, model.ApplyUpdate, plan(model.SpecResource{Current: current, Desired: desired}, model.ApplyOptions{Force: true}))
+
+	// 上次 apply 之后被接口修改过
+	changed := model.UserRequest{Username: tea.String("alice"), Groups: model.ArrayString{"dev"}}
+	assert.Equal(t, model.ApplySkip, plan(model.SpecResource{Current: changed, Desired: desired, Managed: owned}, opt))
+
+	// 清理
+	assert.Equal(t, model.ApplyOp(""), plan(model.SpecResource{Current: current, Managed: owned}, opt))
+	assert.Equal(t, model.ApplyDelete, plan(model.SpecResource{Current: current, Managed: owned}, model.ApplyOptions{Prune: true}))
+	assert.Equal(t, model.ApplySkip, plan(model.SpecResource{Current: changed, Managed: owned}, model.ApplyOptions{Prune: true}))
+	assert.Equal(t, model.ApplyOp(""), plan(model.SpecResource{Current: current, Managed: &other}, model.ApplyOptions{Prune: true}))
+}
+
+func TestApplyPlan_WriteText(t *testing.T) {
+	var buf bytes.Buffer
+	model.ApplyPlan{
+		{Kind: model.SpecKindPolicy, Name: "sre", Op: model.ApplyUpdate, Changes: map[string]model.ChangeItem{"actions": {Before: []string{"connect"}, After: []string{"connect", "download"}}}},
+		{Kind: model.SpecKindUser, Name: "bob", Op: model.ApplySkip, Reason: "managed by other"},
+	}.WriteText(&buf)
+	assert.Equal(t, "~ policy sre\n    actions: [\"connect\"] => [\"connect\",\"download\"]\n! user bob (managed by other)\n", buf.String())
+}
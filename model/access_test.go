@@ -0,0 +1,75 @@
+package model_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xops-infra/jms/model"
+)
+
+func TestNewAccessGrant(t *testing.T) {
+	now := time.Now()
+	{
+		// 多个策略授权取最晚的过期时间
+		grant := model.NewAccessGrant(&model.PolicyExplain{
+			Action: model.Connect,
+			Allow:  true,
+			AllowPolicies: []model.PolicyRef{
+				{ID: "a", ExpiresAt: now.Add(time.Hour)},
+				{ID: "b", ExpiresAt: now.Add(2 * time.Hour)},
+			},
+		})
+		assert.True(t, grant.Allow)
+		assert.Len(t, grant.Policies, 2)
+		assert.Equal(t, now.Add(2*time.Hour), *grant.ExpiresAt)
+	}
+	{
+		grant := model.NewAccessGrant(&model.PolicyExplain{
+			Action:     model.Connect,
+			Allow:      true,
+			SystemRule: model.SystemRuleTeam,
+		})
+		assert.Nil(t, grant.ExpiresAt)
+		assert.Equal(t, model.SystemRuleTeam, grant.SystemRule)
+	}
+	{
+		grant := model.NewAccessGrant(&model.PolicyExplain{
+			Action:        model.Upload,
+			AllowPolicies: []model.PolicyRef{{ID: "a"}},
+			DenyPolicies:  []model.PolicyRef{{ID: "deny"}},
+		})
+		assert.False(t, grant.Allow)
+		assert.Equal(t, "deny", grant.Policies[0].ID)
+		assert.Nil(t, grant.ExpiresAt)
+	}
+}
+
+func TestAccessReport_WriteCSV(t *testing.T) {
+	expiresAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	report := model.AccessReport{
+		{
+			User:       "alice",
+			ServerID:   "i-1",
+			ServerName: "web",
+			ServerHost: "10.0.0.1",
+			Grants: []model.AccessGrant{
+				{Action: model.Connect, Allow: true, Policies: []model.PolicyRef{{ID: "p1"}, {ID: "p2"}}, ExpiresAt: &expiresAt},
+				{Action: model.Download, Allow: true, SystemRule: model.SystemRuleOwner},
+				{Action: model.Upload},
+			},
+		},
+	}
+	assert.True(t, report[0].Reachable())
+
+	var buf bytes.Buffer
+	assert.NoError(t, report.WriteCSV(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "user,server_id,server_name,server_host,action,allow,granted_by,expires_at", lines[0])
+	assert.Equal(t, "alice,i-1,web,10.0.0.1,connect,true,policy:p1;policy:p2,2026-01-02T03:04:05Z", lines[1])
+	assert.Equal(t, "alice,i-1,web,10.0.0.1,download,true,system:owner,", lines[2])
+	assert.Equal(t, "alice,i-1,web,10.0.0.1,upload,false,,", lines[3])
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type ApprovalStatus string
+
+const (
+	ApprovalPending  ApprovalStatus = "pending"
+	ApprovalApproved ApprovalStatus = "approved"
+	ApprovalRejected ApprovalStatus = "rejected"
+	ApprovalCanceled ApprovalStatus = "canceled" // 外部审批被撤销
+)
+
+// 内置审批流程配置，不依赖钉钉
+// 按申请的服务器 Team 标签路由审批人，没有命中路由时使用默认审批人
+type WithApproval struct {
+	TagKey    string          `mapstructure:"tagKey"`    // 路由使用的服务器标签，默认 Team
+	Approvers []string        `mapstructure:"approvers"` // 默认审批人，支持 group:xxx，为空表示任意有 approver 角色的用户
+	Required  int             `mapstructure:"required"`  // 默认需要的审批人数，默认 1
+	Routes    []ApprovalRoute `mapstructure:"routes"`
+}
+
+type ApprovalRoute struct {
+	Team      string   `mapstructure:"team"`
+	Approvers []string `mapstructure:"approvers"`
+	Required  int      `mapstructure:"required"`
+}
+
+// Route 按服务器 team 计算审批人和需要的审批人数，命中多个路由时合并审批人并取最大人数
+func (w WithApproval) Route(teams []string) (ArrayString, int) {
+	approvers := ArrayString{}
+	required := 0
+	for _, route := range w.Routes {
+		if !slices.Contains(teams, route.Team) {
+			continue
+		}
+		for _, approver := range route.Approvers {
+			if !slices.Contains(approvers, approver) {
+				approvers = append(approvers, approver)
+			}
+		}
+		required = max(required, route.Required)
+	}
+	if len(approvers) == 0 {
+		approvers = append(approvers, w.Approvers...)
+		required = max(required, w.Required)
+	}
+	return approvers, max(required, 1)
+}
+
+func (w WithApproval) GetTagKey() string {
+	if w.TagKey == "" {
+		return "Team"
+	}
+	return w.TagKey
+}
+
+type ApprovalDecisionRequest struct {
+	Approve  *bool   `json:"approve" binding:"required"`
+	Comment  *string `json:"comment"`
+	Approver *string `json:"approver"` // 未启用 withApiAuth 时需要指定审批人，启用后使用登录用户
+}
+
+type ApprovalCancelRequest struct {
+	Reason   *string `json:"reason"`
+	Operator *string `json:"operator"` // 未启用 withApiAuth 时需要指定撤销人，启用后使用登录用户
+}
+
+// 钉钉事件订阅回调的请求体，签名参数在 query 中
+type DingtalkCallbackRequest struct {
+	Encrypt string `json:"encrypt" binding:"required"`
+}
+
+// Approval 内置审批单，一个审批单对应一条待启用的策略
+type Approval struct {
+	ID            string             `json:"id" gorm:"column:id;primary_key;not null"`
+	CreatedAt     time.Time          `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" gorm:"column:updated_at"`
+	PolicyID      string             `json:"policy_id" gorm:"column:policy_id;type:varchar(64);index;not null"`
+	Applicant     string             `json:"applicant" gorm:"column:applicant;type:varchar(255);not null"`
+	Justification string             `json:"justification" gorm:"column:justification;type:text"`
+	TicketID      string             `json:"ticket_id" gorm:"column:ticket_id;type:varchar(255)"`
+	Teams         ArrayString        `json:"teams" gorm:"column:teams;type:json"`         // 申请的服务器所属 team
+	Approvers     ArrayString        `json:"approvers" gorm:"column:approvers;type:json"` // 可以审批的用户或者 group:xxx，为空表示任意审批人
+	Required      int                `json:"required" gorm:"column:required;not null;default:1"`
+	Status        ApprovalStatus     `json:"status" gorm:"column:status;type:varchar(32);index;not null"`
+	ClosedAt      *time.Time         `json:"closed_at" gorm:"column:closed_at"`
+	Decisions     []ApprovalDecision `json:"decisions" gorm:"-"`
+}
+
+func (Approval) TableName() string {
+	return "jms_go_approval"
+}
+
+// ApprovalDecision 审批记录，每个审批人只能审批一次
+type ApprovalDecision struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time `json:"created_at" gorm:"column:created_at"`
+	ApprovalID string    `json:"approval_id" gorm:"column:approval_id;type:varchar(64);index;not null"`
+	Approver   string    `json:"approver" gorm:"column:approver;type:varchar(255);not null"`
+	Approve    bool      `json:"approve" gorm:"column:approve;not null"`
+	Comment    string    `json:"comment" gorm:"column:comment;type:text"`
+}
+
+func (ApprovalDecision) TableName() string {
+	return "jms_go_approval_decision"
+}
+
+// CanApprove 审批人不能是申请人，审批人列表为空时任意审批人都可以
+func (a *Approval) CanApprove(user User) error {
+	if user.Username == nil {
+		return fmt.Errorf("approver is empty")
+	}
+	if a.Status != ApprovalPending {
+		return fmt.Errorf("approval %s already %s", a.ID, a.Status)
+	}
+	if *user.Username == a.Applicant {
+		return fmt.Errorf("can not approve your own request")
+	}
+	for _, decision := range a.Decisions {
+		if decision.Approver == *user.Username {
+			return fmt.Errorf("%s already decided", *user.Username)
+		}
+	}
+	if len(a.Approvers) == 0 {
+		return nil
+	}
+	for _, approver := range a.Approvers {
+		if group, ok := strings.CutPrefix(approver, SubjectGroupPrefix); ok {
+			if slices.Contains(user.Groups, group) {
+				return nil
+			}
+			continue
+		}
+		if strings.TrimPrefix(approver, SubjectUserPrefix) == *user.Username {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not approver of %s, approvers: %s", *user.Username, a.ID, strings.Join(a.Approvers, ","))
+}
+
+// Decide 有人拒绝即拒绝，同意人数达到要求即通过
+func (a *Approval) Decide() ApprovalStatus {
+	approved := 0
+	for _, decision := range a.Decisions {
+		if !decision.Approve {
+			return ApprovalRejected
+		}
+		approved++
+	}
+	if approved >= max(a.Required, 1) {
+		return ApprovalApproved
+	}
+	return ApprovalPending
+}
+
+// 通过的审批人，写到策略的 Approver 字段
+func (a *Approval) ApprovedBy() string {
+	var approvers []string
+	for _, decision := range a.Decisions {
+		if decision.Approve {
+			approvers = append(approvers, decision.Approver)
+		}
+	}
+	return strings.Join(approvers, ",")
+}
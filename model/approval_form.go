@@ -0,0 +1,153 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+)
+
+// 外部审批表单可以使用的策略字段，form 映射配置的 key
+const (
+	FormEnvType       = "env_type"
+	FormServerFilter  = "server_filter"
+	FormExpiresAt     = "expires_at"
+	FormActions       = "actions"
+	FormComment       = "comment" // 申请理由和关联工单
+	FormJustification = "justification"
+	FormTicketID      = "ticket_id"
+	FormName          = "name"
+	FormUsers         = "users"
+)
+
+// 没有配置 form 时使用的控件名称，和早期的钉钉审批模板一致
+var DefaultApprovalForm = map[string]string{
+	FormEnvType:      "EnvType",
+	FormServerFilter: "ServerFilter",
+	FormExpiresAt:    "DateExpired",
+	FormActions:      "Actions",
+	FormComment:      "Comment",
+}
+
+var approvalFormValue = map[string]func(req *PolicyRequest, envTypes []string) string{
+	FormEnvType: func(_ *PolicyRequest, envTypes []string) string {
+		return FmtDingtalkApproveFile(envTypes)
+	},
+	FormServerFilter: func(req *PolicyRequest, _ []string) string {
+		if req.ServerFilterV1 == nil {
+			return ""
+		}
+		return tea.Prettify(req.ServerFilterV1)
+	},
+	FormExpiresAt: func(req *PolicyRequest, _ []string) string {
+		if req.ExpiresAt == nil {
+			return ""
+		}
+		return req.ExpiresAt.Format(time.RFC3339)
+	},
+	FormActions: func(req *PolicyRequest, _ []string) string {
+		return tea.Prettify(req.Actions)
+	},
+	FormComment: func(req *PolicyRequest, _ []string) string {
+		return ApplyComment(tea.StringValue(req.Justification), tea.StringValue(req.TicketID))
+	},
+	FormJustification: func(req *PolicyRequest, _ []string) string {
+		return tea.StringValue(req.Justification)
+	},
+	FormTicketID: func(req *PolicyRequest, _ []string) string {
+		return tea.StringValue(req.TicketID)
+	},
+	FormName: func(req *PolicyRequest, _ []string) string {
+		return tea.StringValue(req.Name)
+	},
+	FormUsers: func(req *PolicyRequest, _ []string) string {
+		return strings.Join(req.Users, ",")
+	},
+}
+
+// ValidateApprovalForm 检查 form 映射的策略字段是否支持
+func ValidateApprovalForm(form map[string]string) error {
+	for field, name := range form {
+		if _, ok := approvalFormValue[field]; !ok {
+			return fmt.Errorf("approval form field %s not supported", field)
+		}
+		if name == "" {
+			return fmt.Errorf("approval form field %s component name is empty", field)
+		}
+	}
+	return nil
+}
+
+// 发起外部审批时的表单字段，需要和审批模板的控件名称(飞书为控件自定义 ID)一致
+type ApprovalFormField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ApprovalFormFields 按 form 映射生成表单，form 为空使用默认映射，值为空的字段不传
+// envTypes 为申请的服务器涉及的 EnvType
+func ApprovalFormFields(req *PolicyRequest, form map[string]string, envTypes []string) []ApprovalFormField {
+	if len(form) == 0 {
+		form = DefaultApprovalForm
+	}
+	fields := make([]string, 0, len(form))
+	for field := range form {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	var values []ApprovalFormField
+	for _, field := range fields {
+		value, ok := approvalFormValue[field]
+		if !ok {
+			continue
+		}
+		if v := value(req, envTypes); v != "" {
+			values = append(values, ApprovalFormField{Name: form[field], Value: v})
+		}
+	}
+	return values
+}
+
+// 审批表单的环境只支持 prod,stage,dev,none，涉及多个环境时取最严格的
+func FmtDingtalkApproveFile(envTypes []string) string {
+	for _, env := range []string{"prod", "stage", "dev"} {
+		for _, envType := range envTypes {
+			if strings.EqualFold(envType, env) {
+				return env
+			}
+		}
+	}
+	return "none"
+}
+
+// RequestEnvTypes 申请的服务器范围涉及的 EnvType，包括过滤条件里写的和匹配到的服务器标签
+func RequestEnvTypes(filter *ServerFilterV1, servers []Server) []string {
+	var envTypes []string
+	add := func(envType string) {
+		// 通配、正则和取反的条件不是具体的环境
+		if envType == "" || strings.ContainsAny(envType, "*?[!~") {
+			return
+		}
+		if !slices.Contains(envTypes, envType) {
+			envTypes = append(envTypes, envType)
+		}
+	}
+	if filter == nil {
+		return envTypes
+	}
+	for _, envType := range filter.EnvType {
+		add(envType)
+	}
+	for _, server := range servers {
+		if !MatchServerByFilter(*filter, server, false) {
+			continue
+		}
+		if envType := server.Tags.GetEnvType(); envType != nil {
+			add(*envType)
+		}
+	}
+	return envTypes
+}
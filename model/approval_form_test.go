@@ -0,0 +1,89 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/model"
+	mcsModel "github.com/xops-infra/multi-cloud-sdk/pkg/model"
+)
+
+func TestFmtDingtalkApproveFile(t *testing.T) {
+	assert.Equal(t, "none", model.FmtDingtalkApproveFile(nil))
+	assert.Equal(t, "none", model.FmtDingtalkApproveFile([]string{"test"}))
+	assert.Equal(t, "dev", model.FmtDingtalkApproveFile([]string{"dev"}))
+	assert.Equal(t, "stage", model.FmtDingtalkApproveFile([]string{"dev", "Stage"}))
+	assert.Equal(t, "prod", model.FmtDingtalkApproveFile([]string{"dev", "PROD"}))
+}
+
+func TestRequestEnvTypes(t *testing.T) {
+	servers := []model.Server{
+		{Name: "web-1", Host: "10.0.0.1", Tags: mcsModel.Tags{{Key: "EnvType", Value: "prod"}}},
+		{Name: "web-2", Host: "10.0.0.2", Tags: mcsModel.Tags{{Key: "EnvType", Value: "dev"}}},
+		{Name: "db-1", Host: "10.0.0.3"},
+	}
+	assert.Empty(t, model.RequestEnvTypes(nil, servers))
+	assert.Equal(t, []string{"prod", "dev"}, model.RequestEnvTypes(&model.ServerFilterV1{Name: []string{"web*"}}, servers))
+	assert.Equal(t, []string{"dev"}, model.RequestEnvTypes(&model.ServerFilterV1{IpAddr: []string{"10.0.0.2"}}, servers))
+	assert.Empty(t, model.RequestEnvTypes(&model.ServerFilterV1{Name: []string{"db-1"}}, servers))
+	// 过滤条件写的环境也算，通配不算
+	assert.Equal(t, []string{"stage"}, model.RequestEnvTypes(&model.ServerFilterV1{EnvType: []string{"stage"}, Name: []string{"none"}}, servers))
+	assert.Equal(t, []string{"prod", "dev"}, model.RequestEnvTypes(&model.ServerFilterV1{EnvType: []string{"*"}}, servers))
+}
+
+func TestApprovalFormFields(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 26, 0, 0, 0, 0, time.UTC)
+	req := &model.PolicyRequest{
+		Name:           tea.String("alice-1"),
+		Users:          model.ArrayString{"alice", "bob"},
+		Actions:        model.ConnectOnly,
+		ServerFilterV1: &model.ServerFilterV1{Name: []string{"web-1"}},
+		ExpiresAt:      &expiresAt,
+		Justification:  tea.String("排查问题"),
+	}
+	fields := map[string]string{}
+	for _, field := range model.ApprovalFormFields(req, nil, []string{"prod"}) {
+		fields[field.Name] = field.Value
+	}
+	assert.Len(t, fields, 5)
+	assert.Equal(t, "prod", fields["EnvType"])
+	assert.Equal(t, "2026-10-26T00:00:00Z", fields["DateExpired"])
+	assert.Contains(t, fields["Comment"], "排查问题")
+
+	// 自定义映射，值为空的字段不传
+	fields = map[string]string{}
+	for _, field := range model.ApprovalFormFields(req, map[string]string{
+		model.FormUsers:    "申请人",
+		model.FormName:     "策略名称",
+		model.FormTicketID: "工单",
+	}, nil) {
+		fields[field.Name] = field.Value
+	}
+	assert.Equal(t, map[string]string{"申请人": "alice,bob", "策略名称": "alice-1"}, fields)
+}
+
+func TestWithDingtalk_Process(t *testing.T) {
+	conf := model.WithDingtalk{
+		ProcessCode: "PROC-DEFAULT",
+		Form:        map[string]string{model.FormComment: "备注"},
+		Processes: []model.DingtalkProcess{
+			{EnvTypes: []string{"prod"}, ProcessCode: "PROC-PROD", Form: map[string]string{model.FormEnvType: "环境"}},
+			{EnvTypes: []string{"dev", "stage"}, ProcessCode: "PROC-DEV"},
+		},
+	}
+	assert.NoError(t, conf.Validate())
+	assert.Equal(t, "PROC-PROD", conf.GetProcess([]string{"dev", "Prod"}).ProcessCode)
+	assert.Equal(t, map[string]string{model.FormEnvType: "环境"}, conf.GetProcess([]string{"prod"}).Form)
+	// 没有配置 form 的流程使用默认流程的映射
+	assert.Equal(t, model.DingtalkProcess{EnvTypes: []string{"dev", "stage"}, ProcessCode: "PROC-DEV", Form: conf.Form}, conf.GetProcess([]string{"stage"}))
+	assert.Equal(t, model.DingtalkProcess{ProcessCode: "PROC-DEFAULT", Form: conf.Form}, conf.GetProcess([]string{"test"}))
+
+	conf.Form = map[string]string{"EnvType": "环境"}
+	assert.Error(t, conf.Validate(), "unknown field")
+	conf.Form = nil
+	conf.Processes = append(conf.Processes, model.DingtalkProcess{ProcessCode: "PROC-X"})
+	assert.Error(t, conf.Validate(), "envTypes required")
+}
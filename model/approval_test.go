@@ -0,0 +1,90 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestWithApproval_Route(t *testing.T) {
+	conf := model.WithApproval{
+		Approvers: []string{"group:admin"},
+		Routes: []model.ApprovalRoute{
+			{Team: "ops", Approvers: []string{"alice", "group:ops-lead"}, Required: 2},
+			{Team: "dev", Approvers: []string{"bob", "alice"}},
+		},
+	}
+	approvers, required := conf.Route([]string{"ops", "dev"})
+	assert.Equal(t, model.ArrayString{"alice", "group:ops-lead", "bob"}, approvers)
+	assert.Equal(t, 2, required)
+
+	approvers, required = conf.Route(nil)
+	assert.Equal(t, model.ArrayString{"group:admin"}, approvers)
+	assert.Equal(t, 1, required)
+	assert.Equal(t, "Team", conf.GetTagKey())
+}
+
+func TestApproval_Decide(t *testing.T) {
+	approval := model.Approval{
+		ID:        "a-1",
+		Applicant: "carol",
+		Approvers: model.ArrayString{"alice", "group:ops-lead"},
+		Required:  2,
+		Status:    model.ApprovalPending,
+	}
+	alice := model.User{Username: tea.String("alice")}
+	lead := model.User{Username: tea.String("dave"), Groups: model.ArrayString{"ops-lead"}}
+	carol := model.User{Username: tea.String("carol"), Groups: model.ArrayString{"ops-lead"}}
+	bob := model.User{Username: tea.String("bob")}
+
+	assert.NoError(t, approval.CanApprove(alice))
+	assert.NoError(t, approval.CanApprove(lead))
+	assert.Error(t, approval.CanApprove(carol), "applicant can not approve")
+	assert.Error(t, approval.CanApprove(bob))
+
+	approval.Decisions = append(approval.Decisions, model.ApprovalDecision{Approver: "alice", Approve: true})
+	assert.Equal(t, model.ApprovalPending, approval.Decide())
+	assert.Error(t, approval.CanApprove(alice), "approve twice")
+
+	approval.Decisions = append(approval.Decisions, model.ApprovalDecision{Approver: "dave", Approve: true})
+	assert.Equal(t, model.ApprovalApproved, approval.Decide())
+	assert.Equal(t, "alice,dave", approval.ApprovedBy())
+
+	approval.Decisions[1].Approve = false
+	assert.Equal(t, model.ApprovalRejected, approval.Decide())
+
+	approval.Status = model.ApprovalRejected
+	assert.Error(t, approval.CanApprove(lead))
+
+	// 没有配置审批人时任意审批人都可以
+	approval = model.Approval{Applicant: "carol", Status: model.ApprovalPending}
+	assert.NoError(t, approval.CanApprove(bob))
+	approval.Decisions = []model.ApprovalDecision{{Approver: "bob", Approve: true}}
+	assert.Equal(t, model.ApprovalApproved, approval.Decide())
+}
+
+func TestApprovalMut_ToPolicyMut(t *testing.T) {
+	mut := model.ApprovalMut{
+		Users:         model.ArrayString{"carol"},
+		Applicant:     tea.String("carol"),
+		ServerFilter:  &model.ServerFilterV1{Name: []string{"web-1"}},
+		Justification: tea.String("排查线上问题"),
+		TicketID:      tea.String("OPS-123"),
+	}
+	req := mut.ToPolicyMut()
+	assert.NotNil(t, req.Name)
+	assert.Equal(t, "排查线上问题", tea.StringValue(req.Justification))
+	assert.Equal(t, "OPS-123", tea.StringValue(req.TicketID))
+
+	mut.Name = tea.String("carol-web")
+	assert.Equal(t, "carol-web", tea.StringValue(mut.ToPolicyMut().Name))
+}
+
+func TestApplyComment(t *testing.T) {
+	assert.Equal(t, "申请理由: 排查线上问题", model.ApplyComment("排查线上问题", ""))
+	policy := model.Policy{Justification: "排查线上问题", TicketID: "OPS-123"}
+	assert.Equal(t, "申请理由: 排查线上问题\n关联工单: OPS-123", policy.ApplyComment())
+}
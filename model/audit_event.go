@@ -0,0 +1,146 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 推送给 SIEM 的审计事件类型
+type AuditEventType string
+
+const (
+	AuditLogin        AuditEventType = "login"         // 登录 jms 或者目标服务器
+	AuditLogout       AuditEventType = "logout"        // 目标服务器会话结束
+	AuditScp          AuditEventType = "scp"           // 上传下载文件
+	AuditDenied       AuditEventType = "denied"        // 登录失败、无权限连接或者上传下载、接口无权限
+	AuditPolicyChange AuditEventType = "policy_change" // 策略变更，包括接口修改、审批、过期等
+	AuditShellTask    AuditEventType = "shell_task"    // 批量脚本执行
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEvent 一条审计事件，序列化为一行 json
+type AuditEvent struct {
+	ID         string                 `json:"id"`
+	Time       time.Time              `json:"time"`
+	Type       AuditEventType         `json:"type"`
+	Action     string                 `json:"action,omitempty"` // connect,upload,download,password,publickey,api 或者策略变更动作
+	Result     string                 `json:"result,omitempty"` // success,failure
+	User       string                 `json:"user,omitempty"`
+	Client     string                 `json:"client,omitempty"`      // 客户端地址
+	Server     string                 `json:"server,omitempty"`      // 目标服务器地址
+	InstanceID string                 `json:"instance_id,omitempty"` // 目标服务器实例 ID
+	Message    string                 `json:"message,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// NewAuditEvent 补全 ID 和时间
+func NewAuditEvent(eventType AuditEventType, action, result, user, client string) AuditEvent {
+	return AuditEvent{
+		ID:     uuid.NewString(),
+		Time:   time.Now().UTC(),
+		Type:   eventType,
+		Action: action,
+		Result: result,
+		User:   user,
+		Client: client,
+	}
+}
+
+// 事件推送的输出
+const (
+	SinkSyslog = "syslog" // RFC5424
+	SinkFile   = "file"   // 每行一个 json
+	SinkHTTP   = "http"   // 批量 POST json 数组，失败重试，待发送的事件保存在磁盘队列
+)
+
+// 审计事件推送，可以配置多个输出
+type WithEventStream struct {
+	Types []AuditEventType `mapstructure:"types"` // 推送的事件类型，为空表示所有
+	Sinks []EventSink      `mapstructure:"sinks"`
+}
+
+type EventSink struct {
+	Type string `mapstructure:"type"` // syslog,file,http
+	// syslog
+	Network  string `mapstructure:"network"`  // udp,tcp,tls，默认 udp
+	Address  string `mapstructure:"address"`  // host:port
+	AppName  string `mapstructure:"appName"`  // 默认 jms
+	Facility int    `mapstructure:"facility"` // 默认 13(log audit)
+	// file
+	Path string `mapstructure:"path"`
+	// http
+	URL           string            `mapstructure:"url"`
+	Headers       map[string]string `mapstructure:"headers"`
+	BatchSize     int               `mapstructure:"batchSize"`     // 每批最多事件数，默认 100
+	FlushInterval int               `mapstructure:"flushInterval"` // 发送间隔(秒)，默认 5
+	QueueDir      string            `mapstructure:"queueDir"`      // 磁盘队列目录，默认 /opt/jms/event-queue
+	MaxQueueMB    int               `mapstructure:"maxQueueMB"`    // 磁盘队列上限，超过后丢弃最早的批次，默认 100
+}
+
+func (w WithEventStream) Enabled() bool {
+	return len(w.Sinks) > 0
+}
+
+func (w WithEventStream) Match(eventType AuditEventType) bool {
+	return len(w.Types) == 0 || slices.Contains(w.Types, eventType)
+}
+
+func (w WithEventStream) Validate() error {
+	for i, sink := range w.Sinks {
+		switch sink.Type {
+		case SinkSyslog:
+			if sink.Address == "" {
+				return fmt.Errorf("withEventStream.sinks[%d] syslog address is required", i)
+			}
+			if !slices.Contains([]string{"", "udp", "tcp", "tls"}, sink.Network) {
+				return fmt.Errorf("withEventStream.sinks[%d] syslog network %s not supported", i, sink.Network)
+			}
+		case SinkFile:
+			if sink.Path == "" {
+				return fmt.Errorf("withEventStream.sinks[%d] file path is required", i)
+			}
+		case SinkHTTP:
+			if sink.URL == "" {
+				return fmt.Errorf("withEventStream.sinks[%d] http url is required", i)
+			}
+		default:
+			return fmt.Errorf("withEventStream.sinks[%d] type %s not supported", i, sink.Type)
+		}
+	}
+	return nil
+}
+
+func (s EventSink) GetBatchSize() int {
+	if s.BatchSize <= 0 {
+		return 100
+	}
+	return s.BatchSize
+}
+
+func (s EventSink) GetFlushInterval() time.Duration {
+	if s.FlushInterval <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(s.FlushInterval) * time.Second
+}
+
+func (s EventSink) GetQueueDir() string {
+	if s.QueueDir == "" {
+		return "/opt/jms/event-queue"
+	}
+	return s.QueueDir
+}
+
+func (s EventSink) GetMaxQueueBytes() int64 {
+	if s.MaxQueueMB <= 0 {
+		return 100 << 20
+	}
+	return int64(s.MaxQueueMB) << 20
+}
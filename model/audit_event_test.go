@@ -0,0 +1,49 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestWithEventStream(t *testing.T) {
+	assert.False(t, model.WithEventStream{}.Enabled())
+	assert.True(t, model.WithEventStream{}.Match(model.AuditScp))
+	conf := model.WithEventStream{
+		Types: []model.AuditEventType{model.AuditLogin, model.AuditDenied},
+		Sinks: []model.EventSink{
+			{Type: model.SinkSyslog, Network: "tls", Address: "siem.example.com:6514"},
+			{Type: model.SinkFile, Path: "/opt/jms/logs/audit.ndjson"},
+			{Type: model.SinkHTTP, URL: "https://siem.example.com/ingest"},
+		},
+	}
+	assert.True(t, conf.Enabled())
+	assert.True(t, conf.Match(model.AuditDenied))
+	assert.False(t, conf.Match(model.AuditScp))
+	assert.NoError(t, conf.Validate())
+
+	for _, sink := range []model.EventSink{
+		{Type: model.SinkSyslog},
+		{Type: model.SinkSyslog, Network: "relp", Address: "127.0.0.1:514"},
+		{Type: model.SinkFile},
+		{Type: model.SinkHTTP},
+		{Type: "kafka"},
+	} {
+		assert.Error(t, model.WithEventStream{Sinks: []model.EventSink{sink}}.Validate(), sink.Type)
+	}
+
+	sink := model.EventSink{}
+	assert.Equal(t, 100, sink.GetBatchSize())
+	assert.Equal(t, int64(100<<20), sink.GetMaxQueueBytes())
+	assert.Equal(t, "/opt/jms/event-queue", sink.GetQueueDir())
+}
+
+func TestNewAuditEvent(t *testing.T) {
+	e := model.NewAuditEvent(model.AuditLogin, "password", model.AuditSuccess, "alice", "1.2.3.4:5678")
+	assert.NotEmpty(t, e.ID)
+	assert.False(t, e.Time.IsZero())
+	assert.Equal(t, "alice", e.User)
+	assert.NotEqual(t, e.ID, model.NewAuditEvent(model.AuditLogin, "", "", "", "").ID)
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+)
+
+// 连接前调用的外部授权服务，比如检查是否有处理中的故障工单
+// 本地策略允许后才会调用，外部服务只能拒绝或者附加提示信息，不能放开本地策略拒绝的访问
+type WithAuthzHook struct {
+	Enable   bool              `mapstructure:"enable"`
+	URL      string            `mapstructure:"url"`
+	Headers  map[string]string `mapstructure:"headers"`
+	Actions  []Action          `mapstructure:"actions"`  // 需要外部授权的动作，为空表示所有
+	Timeout  int               `mapstructure:"timeout"`  // 超时(秒)，默认 3
+	FailOpen bool              `mapstructure:"failOpen"` // 授权服务超时或者出错时放行，默认拒绝
+	CacheTTL int               `mapstructure:"cacheTTL"` // 决策缓存时间(秒)，默认 60，小于 0 不缓存
+}
+
+func (w WithAuthzHook) Match(action Action) bool {
+	return len(w.Actions) == 0 || slices.Contains(w.Actions, action)
+}
+
+func (w WithAuthzHook) GetTimeout() time.Duration {
+	if w.Timeout <= 0 {
+		return 3 * time.Second
+	}
+	return time.Duration(w.Timeout) * time.Second
+}
+
+func (w WithAuthzHook) GetCacheTTL() time.Duration {
+	if w.CacheTTL < 0 {
+		return 0
+	}
+	if w.CacheTTL == 0 {
+		return time.Minute
+	}
+	return time.Duration(w.CacheTTL) * time.Second
+}
+
+func (w WithAuthzHook) Validate() error {
+	if w.Enable && w.URL == "" {
+		return fmt.Errorf("withAuthzHook.url is required")
+	}
+	return nil
+}
+
+// AuthzRequest POST 给外部授权服务的请求
+type AuthzRequest struct {
+	User       string            `json:"user"`
+	Groups     []string          `json:"groups"`
+	Action     Action            `json:"action"`
+	ServerID   string            `json:"server_id"`
+	ServerName string            `json:"server_name"`
+	ServerHost string            `json:"server_host"`
+	ServerTags map[string]string `json:"server_tags"`
+	ClientIP   string            `json:"client_ip"`
+}
+
+// AuthzDecision 外部授权服务的响应，message 会显示在终端，拒绝时作为拒绝原因
+type AuthzDecision struct {
+	Allow   bool   `json:"allow"`
+	Message string `json:"message"`
+}
+
+// NewAuthzRequest client 为 ip:port 时只取 ip
+func NewAuthzRequest(user User, action Action, server Server, client string) AuthzRequest {
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+	tags := map[string]string{}
+	for _, tag := range server.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	return AuthzRequest{
+		User:       tea.StringValue(user.Username),
+		Groups:     user.Groups,
+		Action:     action,
+		ServerID:   server.ID,
+		ServerName: server.Name,
+		ServerHost: server.Host,
+		ServerTags: tags,
+		ClientIP:   client,
+	}
+}
+
+// CacheKey 同一用户、动作、服务器和来源 IP 的决策可以复用
+func (r AuthzRequest) CacheKey() string {
+	return strings.Join([]string{r.User, string(r.Action), r.ServerID, r.ServerHost, r.ClientIP}, "|")
+}
@@ -0,0 +1,36 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	mcsModel "github.com/xops-infra/multi-cloud-sdk/pkg/model"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestWithAuthzHook(t *testing.T) {
+	conf := model.WithAuthzHook{}
+	assert.NoError(t, conf.Validate())
+	assert.True(t, conf.Match(model.Download))
+	assert.Equal(t, 3*time.Second, conf.GetTimeout())
+	assert.Equal(t, time.Minute, conf.GetCacheTTL())
+
+	conf = model.WithAuthzHook{Enable: true, Actions: []model.Action{model.Connect}, Timeout: 5, CacheTTL: -1}
+	assert.Error(t, conf.Validate())
+	assert.False(t, conf.Match(model.Download))
+	assert.Equal(t, 5*time.Second, conf.GetTimeout())
+	assert.Equal(t, time.Duration(0), conf.GetCacheTTL())
+}
+
+func TestNewAuthzRequest(t *testing.T) {
+	user := model.User{Username: tea.String("alice"), Groups: model.ArrayString{"sre"}}
+	server := model.Server{ID: "i-1", Name: "web", Host: "10.9.0.1", Tags: mcsModel.Tags{{Key: "Team", Value: "ops"}}}
+	req := model.NewAuthzRequest(user, model.Connect, server, "1.2.3.4:5678")
+	assert.Equal(t, "1.2.3.4", req.ClientIP)
+	assert.Equal(t, map[string]string{"Team": "ops"}, req.ServerTags)
+	assert.Equal(t, "alice|connect|i-1|10.9.0.1|1.2.3.4", req.CacheKey())
+	assert.Equal(t, "1.2.3.4", model.NewAuthzRequest(user, model.Connect, server, "1.2.3.4").ClientIP)
+}
@@ -0,0 +1,121 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+)
+
+// 紧急访问的策略审批人标记
+const BreakGlassApprover = "break-glass"
+
+type BreakGlassStatus string
+
+const (
+	BreakGlassOpen   BreakGlassStatus = "open"   // 等待事后复盘
+	BreakGlassClosed BreakGlassStatus = "closed" // 管理员已复盘关闭
+)
+
+// 紧急访问(break-glass)配置，没人审批时允许指定组的用户填写理由后自助开通限时权限
+type WithBreakGlass struct {
+	Enable     bool        `mapstructure:"enable"`
+	Groups     ArrayString `mapstructure:"groups"`     // 允许使用紧急访问的用户组
+	Duration   int         `mapstructure:"duration"`   // 权限有效时长，单位小时，默认 2
+	Actions    ArrayString `mapstructure:"actions"`    // 授予的动作，默认只有 connect
+	RobotToken string      `mapstructure:"robotToken"` // 钉钉机器人 token，开通时立即告警
+}
+
+func (w WithBreakGlass) Allow(user User) bool {
+	if !w.Enable {
+		return false
+	}
+	for _, group := range w.Groups {
+		if slices.Contains(user.Groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w WithBreakGlass) GetDuration() time.Duration {
+	if w.Duration <= 0 {
+		return 2 * time.Hour
+	}
+	return time.Duration(w.Duration) * time.Hour
+}
+
+func (w WithBreakGlass) GetActions() ArrayString {
+	if len(w.Actions) == 0 {
+		return ConnectOnly
+	}
+	return w.Actions
+}
+
+// 开通后立即生效的策略，只授予该用户这一台服务器
+func (w WithBreakGlass) PolicyRequest(username, reason string, server Server, now time.Time) *PolicyRequest {
+	expiresAt := now.Add(w.GetDuration())
+	return &PolicyRequest{
+		Name:    tea.String(fmt.Sprintf("%s-%s-%s", BreakGlassApprover, username, now.Format("20060102_150405"))),
+		Users:   ArrayString{username},
+		Actions: w.GetActions(),
+		ServerFilterV1: &ServerFilterV1{
+			IpAddr: []string{server.Host},
+			Name:   []string{server.Name},
+		},
+		ExpiresAt:     &expiresAt,
+		Justification: tea.String(reason),
+	}
+}
+
+type BreakGlassReviewRequest struct {
+	Comment  *string `json:"comment" binding:"required"` // 复盘结论
+	Reviewer *string `json:"reviewer"`                   // 未启用 withApiAuth 时需要指定复盘人，启用后使用登录用户
+}
+
+// BreakGlass 紧急访问记录，也是必须由管理员关闭的事后复盘项
+type BreakGlass struct {
+	ID            string           `json:"id" gorm:"column:id;primary_key;not null"`
+	CreatedAt     time.Time        `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt     time.Time        `json:"updated_at" gorm:"column:updated_at"`
+	User          string           `json:"user" gorm:"column:username;type:varchar(255);index;not null"`
+	Reason        string           `json:"reason" gorm:"column:reason;type:text;not null"`
+	ServerHost    string           `json:"server_host" gorm:"column:server_host;type:varchar(255);not null"`
+	ServerName    string           `json:"server_name" gorm:"column:server_name;type:varchar(255)"`
+	PolicyID      string           `json:"policy_id" gorm:"column:policy_id;type:varchar(64)"`
+	ExpiresAt     time.Time        `json:"expires_at" gorm:"column:expires_at;not null"`
+	Recordings    ArrayString      `json:"recordings" gorm:"column:recordings;type:json"` // 会话的输入输出录像文件
+	Status        BreakGlassStatus `json:"status" gorm:"column:status;type:varchar(32);index;not null"`
+	ReviewedBy    string           `json:"reviewed_by" gorm:"column:reviewed_by;type:varchar(255)"`
+	ReviewComment string           `json:"review_comment" gorm:"column:review_comment;type:text"`
+	ReviewedAt    *time.Time       `json:"reviewed_at" gorm:"column:reviewed_at"`
+}
+
+func (BreakGlass) TableName() string {
+	return "jms_go_break_glass"
+}
+
+// 复盘需要其他管理员完成，不能自己关闭
+func (b *BreakGlass) CanReview(reviewer string) error {
+	if b.Status != BreakGlassOpen {
+		return fmt.Errorf("break glass %s is %s", b.ID, b.Status)
+	}
+	if reviewer == "" {
+		return fmt.Errorf("reviewer is empty")
+	}
+	if reviewer == b.User {
+		return fmt.Errorf("%s can not review own break glass access", reviewer)
+	}
+	return nil
+}
+
+func (b *BreakGlass) Active(now time.Time) bool {
+	return now.Before(b.ExpiresAt)
+}
+
+// 开通时的告警内容
+func (b *BreakGlass) AlertMessage() string {
+	return fmt.Sprintf("（紧急）用户开通了紧急访问权限，会话全程录像，事后需要管理员复盘\n用户：%s\n机器名称：%s\n机器IP：%s\n理由：%s\n到期时间：%s\n复盘单：%s",
+		b.User, b.ServerName, b.ServerHost, b.Reason, b.ExpiresAt.Local().Format(time.DateTime), b.ID)
+}
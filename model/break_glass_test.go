@@ -0,0 +1,62 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestWithBreakGlass_Allow(t *testing.T) {
+	conf := model.WithBreakGlass{Enable: true, Groups: model.ArrayString{"oncall"}}
+	oncall := model.User{Username: tea.String("alice"), Groups: model.ArrayString{"dev", "oncall"}}
+	dev := model.User{Username: tea.String("bob"), Groups: model.ArrayString{"dev"}}
+	assert.True(t, conf.Allow(oncall))
+	assert.False(t, conf.Allow(dev))
+
+	conf.Enable = false
+	assert.False(t, conf.Allow(oncall))
+
+	assert.Equal(t, 2*time.Hour, conf.GetDuration())
+	assert.Equal(t, model.ConnectOnly, conf.GetActions())
+}
+
+func TestWithBreakGlass_PolicyRequest(t *testing.T) {
+	now := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	conf := model.WithBreakGlass{Enable: true, Duration: 4}
+	server := model.Server{Name: "web-1", Host: "10.9.0.1"}
+	req := conf.PolicyRequest("alice", "线上故障", server, now)
+	assert.Equal(t, model.ArrayString{"alice"}, req.Users)
+	assert.Equal(t, now.Add(4*time.Hour), *req.ExpiresAt)
+	assert.Equal(t, "线上故障", tea.StringValue(req.Justification))
+	assert.NoError(t, req.ServerFilterV1.Validate())
+
+	allow := model.PolicyCheck(model.Connect, server, model.Policy{
+		Users:          req.Users,
+		Actions:        req.Actions,
+		ServerFilterV1: req.ServerFilterV1,
+	}, false)
+	if assert.NotNil(t, allow) {
+		assert.True(t, *allow)
+	}
+	other := model.Server{Name: "web-2", Host: "10.9.0.2"}
+	allow = model.PolicyCheck(model.Connect, other, model.Policy{
+		Users:          req.Users,
+		Actions:        req.Actions,
+		ServerFilterV1: req.ServerFilterV1,
+	}, false)
+	assert.True(t, allow == nil || !*allow)
+}
+
+func TestBreakGlass_CanReview(t *testing.T) {
+	breakGlass := model.BreakGlass{ID: "bg-1", User: "alice", Status: model.BreakGlassOpen}
+	assert.NoError(t, breakGlass.CanReview("bob"))
+	assert.Error(t, breakGlass.CanReview("alice"))
+	assert.Error(t, breakGlass.CanReview(""))
+
+	breakGlass.Status = model.BreakGlassClosed
+	assert.Error(t, breakGlass.CanReview("bob"))
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/patrickmn/go-cache"
@@ -16,13 +17,22 @@ type Config struct {
 	// Profiles     []CreateProfileRequest `mapstructure:"profiles"` // 云账号配置，用来自动同步云服务器信息
 	// Proxys       []CreateProxyRequest `mapstructure:"proxies"` // ssh代理
 	// Keys         Keys         `mapstructure:"keys"`
-	LocalServers LocalServers `mapstructure:"localServers"` // 支持人工加入的服务器
-	WithVideo    WithVideo    `mapstructure:"withVideo"`    // 视频存储
-	WithLdap     WithLdap     `mapstructure:"withLdap"`     // 配置ldap
-	WithSSHCheck WithSSHCheck `mapstructure:"withSSHCheck"` // 配置服务器SSH可连接性告警
-	WithDB       WithPolicy   `mapstructure:"withDB"`       // 需要进行权限管理则启用该配置，启用后会使用数据库进行权限管理
-	WithDingtalk WithDingtalk `mapstructure:"withDingtalk"` // 配置钉钉审批流程
-	Broadcast    string       `mapstructure:"broadcast"`    // 配置广播消息
+	LocalServers     LocalServers     `mapstructure:"localServers"`     // 支持人工加入的服务器
+	WithVideo        WithVideo        `mapstructure:"withVideo"`        // 视频存储
+	WithLdap         WithLdap         `mapstructure:"withLdap"`         // 配置ldap
+	WithSSHCheck     WithSSHCheck     `mapstructure:"withSSHCheck"`     // 配置服务器SSH可连接性告警
+	WithDB           WithPolicy       `mapstructure:"withDB"`           // 需要进行权限管理则启用该配置，启用后会使用数据库进行权限管理
+	WithDingtalk     WithDingtalk     `mapstructure:"withDingtalk"`     // 配置钉钉审批流程
+	WithFeishu       WithFeishu       `mapstructure:"withFeishu"`       // 配置飞书审批流程
+	WithApproval     WithApproval     `mapstructure:"withApproval"`     // 内置审批流程，审批人路由和需要的审批人数
+	WithPolicyExpiry WithPolicyExpiry `mapstructure:"withPolicyExpiry"` // 临时策略到期提醒
+	WithBreakGlass   WithBreakGlass   `mapstructure:"withBreakGlass"`   // 紧急访问，自助开通限时权限
+	WithApiAuth      WithApiAuth      `mapstructure:"withApiAuth"`      // 管理接口认证和角色权限
+	WithNotify       WithNotify       `mapstructure:"withNotify"`       // 通知渠道和事件路由
+	WithEventStream  WithEventStream  `mapstructure:"withEventStream"`  // 审计事件实时推送到 SIEM
+	WithAuthzHook    WithAuthzHook    `mapstructure:"withAuthzHook"`    // 连接前调用外部授权服务
+	SystemPolicy     SystemPolicy     `mapstructure:"systemPolicy"`     // 系统规则，比较的标签 key、超级用户组、授予的动作
+	Broadcast        string           `mapstructure:"broadcast"`        // 配置广播消息
 }
 
 type LocalServers []ServerManual
@@ -75,7 +85,71 @@ type WithDingtalk struct {
 	Enable      bool   `mapstructure:"enable"`
 	AppKey      string `mapstructure:"appKey"`
 	AppSecret   string `mapstructure:"appSecret"`
-	ProcessCode string `mapstructure:"processCode"` // 审批流程编码
+	ProcessCode string `mapstructure:"processCode"` // 默认审批流程编码
+	Endpoint    string `mapstructure:"endpoint"`    // 开放平台地址，默认 https://api.dingtalk.com
+	// 默认流程的表单映射，key 为策略字段(model.Form*)，value 为控件名称，为空使用 model.DefaultApprovalForm
+	Form map[string]string `mapstructure:"form"`
+	// 按申请服务器的 EnvType 选择审批流程，按顺序命中第一个，都没有命中使用默认流程
+	Processes []DingtalkProcess `mapstructure:"processes"`
+	// 事件订阅回调，配置后审批结果实时推送到 /api/v1/approval/callback/dingtalk，轮询只作为兜底
+	CallbackToken  string `mapstructure:"callbackToken"`  // 签名 token
+	CallbackAESKey string `mapstructure:"callbackAesKey"` // 加密 aes_key，43 位
+}
+
+func (w WithDingtalk) CallbackEnabled() bool {
+	return w.CallbackToken != "" && w.CallbackAESKey != ""
+}
+
+type DingtalkProcess struct {
+	EnvTypes    []string          `mapstructure:"envTypes"`
+	ProcessCode string            `mapstructure:"processCode"`
+	Form        map[string]string `mapstructure:"form"` // 为空使用默认流程的表单映射
+}
+
+// GetProcess 按申请的 EnvType 选择审批流程，涉及多个环境时按配置顺序取第一个命中的
+func (w WithDingtalk) GetProcess(envTypes []string) DingtalkProcess {
+	for _, process := range w.Processes {
+		for _, envType := range envTypes {
+			if slices.ContainsFunc(process.EnvTypes, func(s string) bool { return strings.EqualFold(s, envType) }) {
+				if len(process.Form) == 0 {
+					process.Form = w.Form
+				}
+				return process
+			}
+		}
+	}
+	return DingtalkProcess{ProcessCode: w.ProcessCode, Form: w.Form}
+}
+
+func (w WithDingtalk) Validate() error {
+	if err := ValidateApprovalForm(w.Form); err != nil {
+		return fmt.Errorf("withDingtalk.form: %s", err)
+	}
+	for i, process := range w.Processes {
+		if process.ProcessCode == "" || len(process.EnvTypes) == 0 {
+			return fmt.Errorf("withDingtalk.processes[%d]: processCode and envTypes are required", i)
+		}
+		if err := ValidateApprovalForm(process.Form); err != nil {
+			return fmt.Errorf("withDingtalk.processes[%d].form: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// 飞书审批，用户需要配置 feishu_id(飞书 user_id)
+type WithFeishu struct {
+	Enable       bool   `mapstructure:"enable"`
+	AppID        string `mapstructure:"appId"`
+	AppSecret    string `mapstructure:"appSecret"`
+	ApprovalCode string `mapstructure:"approvalCode"` // 审批定义编码
+	Endpoint     string `mapstructure:"endpoint"`     // 开放平台地址，默认 https://open.feishu.cn
+}
+
+// 启用后管理接口需要先 /api/v1/login 换取 token，并按角色校验权限
+type WithApiAuth struct {
+	Enable  bool   `mapstructure:"enable"`
+	Secret  string `mapstructure:"secret"`  // jwt 签名密钥
+	Expires int    `mapstructure:"expires"` // token 有效时长，单位小时，默认 24
 }
 
 type WithPolicy struct {
@@ -161,6 +235,27 @@ func configCheck(conf *Config) {
 			panic(err)
 		}
 	}
+	if conf.WithApiAuth.Enable && conf.WithApiAuth.Secret == "" {
+		panic(fmt.Errorf("withApiAuth enabled but secret is empty"))
+	}
+	if err := conf.SystemPolicy.Validate(); err != nil {
+		panic(err)
+	}
+	if conf.WithDingtalk.Enable {
+		if err := conf.WithDingtalk.Validate(); err != nil {
+			panic(err)
+		}
+	}
+	if err := conf.WithNotify.Validate(); err != nil {
+		panic(err)
+	}
+	if err := conf.WithEventStream.Validate(); err != nil {
+		panic(err)
+	}
+	if err := conf.WithAuthzHook.Validate(); err != nil {
+		panic(err)
+	}
+	conf.SystemPolicy = conf.SystemPolicy.WithDefaults()
 }
 
 // type User struct {
@@ -0,0 +1,201 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+)
+
+// 通知事件类型
+type NotifyEvent string
+
+const (
+	EventLiveness     NotifyEvent = "liveness"      // 服务器 ssh 连接失败或恢复
+	EventShellTask    NotifyEvent = "shell_task"    // 批量脚本执行完成
+	EventApproval     NotifyEvent = "approval"      // 权限申请提交和审批结果
+	EventAuthFailure  NotifyEvent = "auth_failure"  // sshd 和管理接口登录失败
+	EventPolicyExpire NotifyEvent = "policy_expire" // 临时策略即将到期
+	EventBreakGlass   NotifyEvent = "break_glass"   // 紧急访问开通
+)
+
+// 通知渠道类型
+const (
+	ChannelWebhook  = "webhook"  // 通用 json webhook
+	ChannelWecom    = "wecom"    // 企业微信群机器人
+	ChannelSlack    = "slack"    // slack incoming webhook
+	ChannelEmail    = "email"    // smtp 邮件
+	ChannelDingtalk = "dingtalk" // 钉钉群机器人
+)
+
+// Notification 一条通知，Text 为默认内容，路由配置了模板时使用模板渲染
+type Notification struct {
+	Event NotifyEvent            `json:"event"`
+	Title string                 `json:"title"`
+	Text  string                 `json:"text"`
+	Data  map[string]interface{} `json:"data,omitempty"` // 模板中通过 .Data.xxx 使用
+	Time  time.Time              `json:"time"`
+	To    []NotifyRecipient      `json:"to,omitempty"` // 指定的接收人，邮件发给接收人的邮箱，钉钉机器人 @ 接收人
+}
+
+// NotifyRecipient 通知接收人，数据库里没有的用户(如 ldap 用户)只有用户名
+type NotifyRecipient struct {
+	Username   string `json:"username"`
+	Email      string `json:"email,omitempty"`
+	DingtalkID string `json:"dingtalk_id,omitempty"`
+	FeishuID   string `json:"feishu_id,omitempty"`
+}
+
+func NewNotifyRecipient(user User) NotifyRecipient {
+	return NotifyRecipient{
+		Username:   tea.StringValue(user.Username),
+		Email:      tea.StringValue(user.Email),
+		DingtalkID: tea.StringValue(user.DingtalkID),
+		FeishuID:   tea.StringValue(user.FeishuID),
+	}
+}
+
+// 通知配置，channels 定义渠道，routes 决定哪些事件发到哪些渠道
+// 早期配置的钉钉机器人 token(withSSHCheck.alert,withPolicyExpiry,withBreakGlass)等同于对应事件发到该机器人的路由
+type WithNotify struct {
+	Channels []NotifyChannel `mapstructure:"channels"`
+	Routes   []NotifyRoute   `mapstructure:"routes"`
+}
+
+type NotifyChannel struct {
+	Name    string            `mapstructure:"name"`
+	Type    string            `mapstructure:"type"`    // webhook,wecom,slack,email,dingtalk
+	URL     string            `mapstructure:"url"`     // webhook 地址，钉钉可以只配置 token
+	Token   string            `mapstructure:"token"`   // 钉钉机器人 token
+	Headers map[string]string `mapstructure:"headers"` // 通用 webhook 的请求头
+	SMTP    SMTPConfig        `mapstructure:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"` // 默认 25，465 使用 tls 直连
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"` // 固定收件人，为空时只发给通知指定的接收人
+}
+
+type NotifyRoute struct {
+	Events   []NotifyEvent `mapstructure:"events"`   // 为空或者包含 * 表示所有事件
+	Channels []string      `mapstructure:"channels"` // 渠道名称
+	Title    string        `mapstructure:"title"`    // 标题模板，为空使用默认标题，邮件主题和 slack 等会用到
+	Template string        `mapstructure:"template"` // 内容模板(text/template)，为空使用默认内容
+}
+
+func (r NotifyRoute) Match(event NotifyEvent) bool {
+	return len(r.Events) == 0 || slices.Contains(r.Events, "*") || slices.Contains(r.Events, event)
+}
+
+// Render 使用路由模板渲染标题和内容
+func (r NotifyRoute) Render(n Notification) (string, string, error) {
+	title, err := renderNotify(r.Title, n.Title, n)
+	if err != nil {
+		return "", "", fmt.Errorf("render title error: %s", err)
+	}
+	text, err := renderNotify(r.Template, n.Text, n)
+	if err != nil {
+		return "", "", fmt.Errorf("render template error: %s", err)
+	}
+	return title, text, nil
+}
+
+func renderNotify(tmpl, defaultValue string, n Notification) (string, error) {
+	if tmpl == "" {
+		return defaultValue, nil
+	}
+	t, err := template.New(string(n.Event)).Option("missingkey=zero").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, n); err != nil {
+		return "", err
+	}
+	// Data 中不存在的 key 渲染为空
+	return strings.ReplaceAll(buf.String(), "<no value>", ""), nil
+}
+
+func (w WithNotify) Validate() error {
+	names := map[string]bool{}
+	for _, channel := range w.Channels {
+		if channel.Name == "" || names[channel.Name] {
+			return fmt.Errorf("withNotify channel name %q is empty or duplicated", channel.Name)
+		}
+		names[channel.Name] = true
+		switch channel.Type {
+		case ChannelWebhook, ChannelWecom, ChannelSlack:
+			if channel.URL == "" {
+				return fmt.Errorf("withNotify channel %s url is required", channel.Name)
+			}
+		case ChannelDingtalk:
+			if channel.URL == "" && channel.Token == "" {
+				return fmt.Errorf("withNotify channel %s url or token is required", channel.Name)
+			}
+		case ChannelEmail:
+			// to 可以为空，只发给通知指定的接收人
+			if channel.SMTP.Host == "" || channel.SMTP.From == "" {
+				return fmt.Errorf("withNotify channel %s smtp host and from are required", channel.Name)
+			}
+		default:
+			return fmt.Errorf("withNotify channel %s type %s not supported", channel.Name, channel.Type)
+		}
+	}
+	for i, route := range w.Routes {
+		for _, name := range route.Channels {
+			if !names[name] {
+				return fmt.Errorf("withNotify routes[%d] channel %s not found", i, name)
+			}
+		}
+		n := Notification{Event: EventLiveness}
+		if _, _, err := route.Render(n); err != nil {
+			return fmt.Errorf("withNotify routes[%d]: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// ApprovalNotification 权限申请提交(pending)和审批结束的通知
+func ApprovalNotification(id, applicant, comment string, status ApprovalStatus, approver string) Notification {
+	n := Notification{
+		Event: EventApproval,
+		Data: map[string]interface{}{
+			"id":        id,
+			"applicant": applicant,
+			"comment":   comment,
+			"status":    status,
+			"approver":  approver,
+		},
+	}
+	if status == ApprovalPending {
+		n.Title = fmt.Sprintf("[jms] %s 的权限申请等待审批", applicant)
+		n.Text = fmt.Sprintf("权限申请 %s 等待审批\n申请人：%s\n%s", id, applicant, comment)
+		return n
+	}
+	n.Title = fmt.Sprintf("[jms] %s 的权限申请 %s", applicant, status)
+	n.Text = fmt.Sprintf("权限申请 %s 已结束，结果：%s\n申请人：%s\n处理人：%s\n%s", id, status, applicant, approver, comment)
+	return n
+}
+
+// AuthFailureNotification 登录失败通知，source 为 sshd 或 api
+func AuthFailureNotification(source, user, client string, err error) Notification {
+	return Notification{
+		Event: EventAuthFailure,
+		Title: fmt.Sprintf("[jms] %s 登录失败 %s", source, user),
+		Text:  fmt.Sprintf("%s 登录失败\n用户：%s\n来源：%s\n原因：%s", source, user, client, err),
+		Data: map[string]interface{}{
+			"source": source,
+			"user":   user,
+			"client": client,
+			"error":  fmt.Sprint(err),
+		},
+	}
+}
@@ -0,0 +1,70 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestNotifyRoute(t *testing.T) {
+	assert.True(t, model.NotifyRoute{}.Match(model.EventApproval))
+	assert.True(t, model.NotifyRoute{Events: []model.NotifyEvent{"*"}}.Match(model.EventApproval))
+	assert.True(t, model.NotifyRoute{Events: []model.NotifyEvent{model.EventLiveness, model.EventApproval}}.Match(model.EventApproval))
+	assert.False(t, model.NotifyRoute{Events: []model.NotifyEvent{model.EventLiveness}}.Match(model.EventApproval))
+
+	n := model.AuthFailureNotification("sshd", "alice", "1.2.3.4:5678", errors.New("password not match"))
+	title, text, err := model.NotifyRoute{}.Render(n)
+	assert.NoError(t, err)
+	assert.Equal(t, n.Title, title)
+	assert.Equal(t, n.Text, text)
+
+	title, text, err = model.NotifyRoute{
+		Title:    "{{.Event}}: {{.Data.user}}",
+		Template: "{{.Data.user}} from {{.Data.client}}: {{.Data.error}}{{.Data.missing}}",
+	}.Render(n)
+	assert.NoError(t, err)
+	assert.Equal(t, "auth_failure: alice", title)
+	assert.Equal(t, "alice from 1.2.3.4:5678: password not match", text)
+
+	_, _, err = model.NotifyRoute{Template: "{{.Data.user"}.Render(n)
+	assert.Error(t, err)
+}
+
+func TestWithNotify_Validate(t *testing.T) {
+	conf := model.WithNotify{
+		Channels: []model.NotifyChannel{
+			{Name: "hook", Type: model.ChannelWebhook, URL: "http://127.0.0.1/hook"},
+			{Name: "ding", Type: model.ChannelDingtalk, Token: "xxx"},
+			{Name: "mail", Type: model.ChannelEmail, SMTP: model.SMTPConfig{Host: "smtp", From: "a@b.c", To: []string{"d@b.c"}}},
+		},
+		Routes: []model.NotifyRoute{{Events: []model.NotifyEvent{model.EventLiveness}, Channels: []string{"hook", "ding", "mail"}}},
+	}
+	assert.NoError(t, conf.Validate())
+	assert.NoError(t, model.WithNotify{}.Validate())
+
+	cases := map[string]model.WithNotify{
+		"unknown type":     {Channels: []model.NotifyChannel{{Name: "x", Type: "sms"}}},
+		"duplicated name":  {Channels: []model.NotifyChannel{conf.Channels[0], conf.Channels[0]}},
+		"missing url":      {Channels: []model.NotifyChannel{{Name: "x", Type: model.ChannelSlack}}},
+		"missing smtp":     {Channels: []model.NotifyChannel{{Name: "x", Type: model.ChannelEmail}}},
+		"unknown channel":  {Routes: []model.NotifyRoute{{Channels: []string{"x"}}}},
+		"bad template":     {Routes: []model.NotifyRoute{{Template: "{{.Data"}}},
+		"unknown field":    {Routes: []model.NotifyRoute{{Template: "{{.Server}}"}}},
+		"missing dingtalk": {Channels: []model.NotifyChannel{{Name: "x", Type: model.ChannelDingtalk}}},
+	}
+	for name, c := range cases {
+		assert.Error(t, c.Validate(), name)
+	}
+}
+
+func TestApprovalNotification(t *testing.T) {
+	n := model.ApprovalNotification("a1", "alice", "申请理由: test", model.ApprovalPending, "")
+	assert.Equal(t, model.EventApproval, n.Event)
+	assert.Contains(t, n.Text, "等待审批")
+	n = model.ApprovalNotification("a1", "alice", "申请理由: test", model.ApprovalRejected, "bob")
+	assert.Contains(t, n.Text, "rejected")
+	assert.Equal(t, "bob", n.Data["approver"])
+}
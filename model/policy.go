@@ -85,13 +85,15 @@ type PolicyQueryRequest struct {
 }
 
 type ApprovalMut struct {
-	Users ArrayString `json:"users" binding:"required"`
-	// Groups       ArrayString     `json:"groups"`
-	Applicant    *string         `json:"applicant" binding:"required"` // 申请人AD名,或者email
-	Name         *string         `json:"name"`
-	Period       *Period         `json:"period"`  // 审批周期，默认一周
-	Actions      []Action        `json:"actions"` // 申请动作，默认只有connect
-	ServerFilter *ServerFilterV1 `json:"server_filter" binding:"required"`
+	Users         ArrayString     `json:"users" binding:"required"`
+	Groups        ArrayString     `json:"groups"`
+	Applicant     *string         `json:"applicant" binding:"required"` // 申请人AD名,或者email
+	Name          *string         `json:"name"`
+	Period        *Period         `json:"period"`  // 审批周期，默认一周
+	Actions       []Action        `json:"actions"` // 申请动作，默认只有connect
+	ServerFilter  *ServerFilterV1 `json:"server_filter" binding:"required"`
+	Justification *string         `json:"justification"` // 申请理由，内置审批必填
+	TicketID      *string         `json:"ticket_id"`     // 关联的工单号，可选
 }
 
 func (a *ApprovalMut) ToPolicyMut() *PolicyRequest {
@@ -99,13 +101,16 @@ func (a *ApprovalMut) ToPolicyMut() *PolicyRequest {
 	req := &PolicyRequest{
 		Name:           tea.String(fmt.Sprintf("%s-%s", *a.Applicant, time.Now().Format("20060102150405"))),
 		Users:          a.Users,
+		Groups:         a.Groups,
 		ServerFilterV1: a.ServerFilter,
 		ExpiresAt:      &defalutPeriod,
 		Actions: ArrayString{
 			string(Connect),
 		},
+		Justification: a.Justification,
+		TicketID:      a.TicketID,
 	}
-	if a.Name == nil {
+	if a.Name != nil {
 		req.Name = a.Name
 	}
 	if a.Period != nil {
@@ -195,91 +200,69 @@ func MatchServerByFilter(filter ServerFilterV1, server Server, onlyIp bool) bool
 	log.Debugf("filter:%s", tea.Prettify(filter))
 	log.Debugf("server:%s", tea.Prettify(server))
 
-	if filter.EnvType == nil && filter.Team == nil &&
-		filter.Name == nil && filter.IpAddr == nil && filter.KV == nil {
+	if filter.IsEmpty() {
 		log.Errorf("filter is empty, return false")
 		return false
 	}
 
-	IsMatchName := false
-	if filter.Name != nil {
-		for _, name := range filter.Name {
-			if stringMatch(server.Name, name) {
-				IsMatchName = true
-				break
-			}
-		}
-	} else {
-		IsMatchName = true
+	IsMatchIP := true
+	if filter.IpAddr != nil {
+		IsMatchIP = matchAny(filter.IpAddr, server.Host, ipMatch)
 	}
 
-	IsMatchIP := false
-	if filter.IpAddr != nil {
-		for _, ip := range filter.IpAddr {
-			if stringMatch(server.Host, ip) {
-				IsMatchIP = true
-				break
-			}
-		}
-	} else {
-		IsMatchIP = true
+	if onlyIp {
+		return IsMatchIP && matchGroups(filter, server, onlyIp)
 	}
 
-	IsMatchEnvType := false
+	IsMatchName := true
+	if filter.Name != nil {
+		IsMatchName = matchAny(filter.Name, server.Name, nameMatch)
+	}
+
+	IsMatchEnvType := true
 	if filter.EnvType != nil {
-		if server.Tags.GetEnvType() != nil {
-			for _, envType := range filter.EnvType {
-				if stringMatch(*server.Tags.GetEnvType(), envType) {
-					IsMatchEnvType = true
-					break
-				}
-			}
-		}
-	} else {
-		IsMatchEnvType = true
+		IsMatchEnvType = server.Tags.GetEnvType() != nil && matchAny(filter.EnvType, *server.Tags.GetEnvType(), stringMatch)
 	}
 
-	IsMatchTeam := false
+	IsMatchTeam := true
 	if filter.Team != nil {
-		if server.Tags.GetTeam() != nil {
-			for _, team := range filter.Team {
-				if stringMatch(*server.Tags.GetTeam(), team) {
-					IsMatchTeam = true
-					break
-				}
-			}
-		}
-	} else {
-		IsMatchTeam = true
+		IsMatchTeam = server.Tags.GetTeam() != nil && matchAny(filter.Team, *server.Tags.GetTeam(), stringMatch)
 	}
 
 	// 判断自定义 KV 匹配
-	IsMatchKV := false
+	IsMatchKV := true
 	if filter.KV != nil {
-		for _, tag := range server.Tags {
-			if tag.Key == filter.KV.Key && tag.Value == filter.KV.Value {
-				IsMatchKV = true
-				break
-			}
+		IsMatchKV = TagCondition{Key: filter.KV.Key, Operator: TagEqual, Value: filter.KV.Value}.Match(server)
+	}
+
+	IsMatchTags := true
+	for _, cond := range filter.Tags {
+		if !cond.Match(server) {
+			IsMatchTags = false
+			break
 		}
-	} else {
-		IsMatchKV = true
 	}
 
-	if onlyIp {
-		if IsMatchIP {
-			return true
-		} else {
+	return IsMatchName && IsMatchIP && IsMatchEnvType && IsMatchTeam && IsMatchKV && IsMatchTags &&
+		matchGroups(filter, server, onlyIp)
+}
+
+// All 子条件全部满足，Any 子条件满足任意一个
+func matchGroups(filter ServerFilterV1, server Server, onlyIp bool) bool {
+	for _, sub := range filter.All {
+		if !MatchServerByFilter(sub, server, onlyIp) {
 			return false
 		}
-	} else {
-		if IsMatchName && IsMatchIP && IsMatchEnvType && IsMatchTeam && IsMatchKV {
+	}
+	if len(filter.Any) == 0 {
+		return true
+	}
+	for _, sub := range filter.Any {
+		if MatchServerByFilter(sub, server, onlyIp) {
 			return true
 		}
-
-		return false
 	}
-
+	return false
 }
 
 // Admin level check, only find ok, default deny
@@ -308,10 +291,14 @@ func PolicyCheck(inPutAction Action, server Server, policy Policy, onlyIp bool)
 	return nil
 }
 
-// 审批表单目前只支持prod,dev,stage,none
-// todo:判断策略属于审批的那个单子
-func FmtDingtalkApproveFile(envType []string) string {
-	return "prod"
+// 解析 root@10.9.x.x:/data/xx.zip 或者 root@10.9.x.x，返回登录用户、服务器和路径
+func ParseScpTarget(target string) (string, string, string, error) {
+	inputServer, remotePath, _ := strings.Cut(target, ":")
+	sshUsername, host, found := strings.Cut(inputServer, "@")
+	if !found || sshUsername == "" || host == "" {
+		return "", "", "", fmt.Errorf("target %s invalid, must be user@host", target)
+	}
+	return sshUsername, host, remotePath, nil
 }
 
 func ExtractIP(input string) (string, error) {
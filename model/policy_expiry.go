@@ -0,0 +1,101 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+)
+
+// 过期超过这个时间的策略不再提示续期，需要重新申请
+const RenewGracePeriod = 7 * 24 * time.Hour
+
+// 临时策略到期前提醒用户和审批人
+type WithPolicyExpiry struct {
+	NotifyBefore int    `mapstructure:"notifyBefore"` // 到期前多少小时提醒，默认 24
+	RobotToken   string `mapstructure:"robotToken"`   // 早期配置，等同于 withNotify 中 policy_expire 发到该钉钉机器人的路由
+}
+
+func (w WithPolicyExpiry) GetNotifyBefore() time.Duration {
+	if w.NotifyBefore <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(w.NotifyBefore) * time.Hour
+}
+
+// 启用的策略在提醒窗口内即将过期，并且还没有提醒过
+func (p *Policy) NeedExpireNotify(now time.Time, notifyBefore time.Duration) bool {
+	if p.IsDeleted || !p.IsEnabled || p.Expired || p.ExpireNotifiedAt != nil {
+		return false
+	}
+	return p.ExpiresAt.After(now) && !p.ExpiresAt.After(now.Add(notifyBefore))
+}
+
+// 已经过期但还没有标记
+func (p *Policy) NeedMarkExpired(now time.Time) bool {
+	return !p.IsDeleted && !p.Expired && !p.ExpiresAt.After(now)
+}
+
+// 授予该用户的启用策略即将过期或者刚过期，可以续期
+func (p *Policy) CanRenew(username string, now time.Time, notifyBefore time.Duration) bool {
+	if p.IsDeleted || !p.IsEnabled || p.ServerFilterV1 == nil || !p.Users.Contains(username) {
+		return false
+	}
+	return p.ExpiresAt.After(now.Add(-RenewGracePeriod)) && !p.ExpiresAt.After(now.Add(notifyBefore))
+}
+
+// 续期申请沿用原策略的服务器范围和动作等限制，作为新策略重新走审批
+func (p *Policy) RenewRequest(username string, expiresAt time.Time) *PolicyRequest {
+	return &PolicyRequest{
+		Name:           tea.String(fmt.Sprintf("%s-%s", username, time.Now().Format("20060102_1504"))),
+		Users:          ArrayString{username},
+		Actions:        p.Actions,
+		ServerFilterV1: p.ServerFilterV1,
+		ExpiresAt:      &expiresAt,
+		Schedule:       p.Schedule,
+		SourceCIDRs:    p.SourceCIDRs,
+		LoginUsers:     p.LoginUsers,
+		RenewFrom:      tea.String(p.ID),
+	}
+}
+
+// 到期提醒内容
+func (p *Policy) ExpireNotifyMessage() string {
+	users := append(ArrayString{}, p.Users...)
+	for _, group := range p.Groups {
+		users = append(users, GroupSubject(group))
+	}
+	return fmt.Sprintf("策略即将过期\n策略名称：%s\n过期时间：%s\n授权用户：%s\n审批人：%s\n如需继续使用请登录 jms 在菜单中申请续期",
+		p.Name, p.ExpiresAt.Local().Format(time.DateTime), strings.Join(users, ","), p.Approver)
+}
+
+// 到期提醒的接收人：授权的用户和审批人，用户组的成员不单独通知
+func (p *Policy) ExpireNotifyUsers() []string {
+	var users []string
+	for _, name := range append(append([]string{}, p.Users...), strings.Split(p.Approver, ",")...) {
+		if name != "" && !slices.Contains(users, name) {
+			users = append(users, name)
+		}
+	}
+	return users
+}
+
+// 找到会话依赖的过期策略：会话建立之后才过期，并且允许连接该服务器
+func ExpiredSessionPolicy(explain *PolicyExplain, policies []Policy, server Server, startAt time.Time) *Policy {
+	for _, ref := range explain.SkippedPolicies {
+		if ref.Reason != SkipExpired || !ref.ExpiresAt.After(startAt) {
+			continue
+		}
+		for _, policy := range policies {
+			if policy.ID != ref.ID {
+				continue
+			}
+			if allow := PolicyCheck(Connect, server, policy, false); allow != nil && *allow {
+				return &policy
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestPolicy_NeedExpireNotify(t *testing.T) {
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	policy := model.Policy{IsEnabled: true, ExpiresAt: now.Add(2 * time.Hour)}
+	assert.True(t, policy.NeedExpireNotify(now, 24*time.Hour))
+	assert.False(t, policy.NeedExpireNotify(now, time.Hour))
+
+	notified := now
+	policy.ExpireNotifiedAt = &notified
+	assert.False(t, policy.NeedExpireNotify(now, 24*time.Hour))
+
+	policy = model.Policy{IsEnabled: false, ExpiresAt: now.Add(2 * time.Hour)}
+	assert.False(t, policy.NeedExpireNotify(now, 24*time.Hour))
+
+	policy = model.Policy{IsEnabled: true, ExpiresAt: now.Add(-time.Hour)}
+	assert.False(t, policy.NeedExpireNotify(now, 24*time.Hour))
+	assert.True(t, policy.NeedMarkExpired(now))
+	policy.Expired = true
+	assert.False(t, policy.NeedMarkExpired(now))
+}
+
+func TestPolicy_Renew(t *testing.T) {
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	policy := model.Policy{
+		ID:             "p-1",
+		Users:          model.ArrayString{"alice", "bob"},
+		Actions:        model.ConnectOnly,
+		ServerFilterV1: &model.ServerFilterV1{Name: []string{"web-1"}},
+		LoginUsers:     model.ArrayString{"ec2-user"},
+		IsEnabled:      true,
+		ExpiresAt:      now.Add(time.Hour),
+	}
+	assert.True(t, policy.CanRenew("alice", now, 24*time.Hour))
+	assert.False(t, policy.CanRenew("carol", now, 24*time.Hour))
+	assert.False(t, policy.CanRenew("alice", now, 30*time.Minute))
+
+	policy.ExpiresAt = now.Add(-24 * time.Hour)
+	assert.True(t, policy.CanRenew("alice", now, time.Hour), "recently expired")
+	policy.ExpiresAt = now.Add(-model.RenewGracePeriod - time.Hour)
+	assert.False(t, policy.CanRenew("alice", now, time.Hour))
+
+	expiresAt := now.Add(7 * 24 * time.Hour)
+	req := policy.RenewRequest("alice", expiresAt)
+	assert.Equal(t, model.ArrayString{"alice"}, req.Users)
+	assert.Equal(t, policy.Actions, req.Actions)
+	assert.Equal(t, policy.ServerFilterV1, req.ServerFilterV1)
+	assert.Equal(t, policy.LoginUsers, req.LoginUsers)
+	assert.Equal(t, expiresAt, *req.ExpiresAt)
+	assert.Equal(t, "p-1", tea.StringValue(req.RenewFrom))
+}
+
+func TestExpiredSessionPolicy(t *testing.T) {
+	now := time.Now()
+	server := model.Server{Name: "web-1", Host: "10.9.0.1"}
+	user := model.User{Username: tea.String("alice")}
+	policies := []model.Policy{
+		{
+			ID:             "p-1",
+			Name:           "alice-web",
+			Users:          model.ArrayString{"alice"},
+			Actions:        model.ConnectOnly,
+			ServerFilterV1: &model.ServerFilterV1{Name: []string{"web-1"}},
+			IsEnabled:      true,
+			ExpiresAt:      now.Add(-time.Minute),
+		},
+		{
+			ID:             "p-2",
+			Name:           "alice-db",
+			Users:          model.ArrayString{"alice"},
+			Actions:        model.ConnectOnly,
+			ServerFilterV1: &model.ServerFilterV1{Name: []string{"db-1"}},
+			IsEnabled:      true,
+			ExpiresAt:      now.Add(-time.Minute),
+		},
+	}
+	explain := model.ExplainPolicies(user, model.Connect, server, policies, false, "", now)
+	assert.False(t, explain.Allow)
+
+	policy := model.ExpiredSessionPolicy(explain, policies, server, now.Add(-time.Hour))
+	if assert.NotNil(t, policy) {
+		assert.Equal(t, "p-1", policy.ID)
+	}
+	// 会话在策略过期之后建立的，不是依赖该策略
+	assert.Nil(t, model.ExpiredSessionPolicy(explain, policies, server, now))
+}
+
+func TestPolicy_ExpireNotifyMessage(t *testing.T) {
+	policy := model.Policy{
+		Name:      "alice-web",
+		Users:     model.ArrayString{"alice"},
+		Groups:    model.ArrayString{"ops"},
+		Approver:  "bob",
+		ExpiresAt: time.Now(),
+	}
+	msg := policy.ExpireNotifyMessage()
+	assert.Contains(t, msg, "alice-web")
+	assert.Contains(t, msg, "alice,group:ops")
+	assert.Contains(t, msg, "审批人：bob")
+
+	policy.Users = model.ArrayString{"alice", "bob"}
+	policy.Approver = "bob,carol"
+	assert.Equal(t, []string{"alice", "bob", "carol"}, policy.ExpireNotifyUsers())
+}
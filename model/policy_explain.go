@@ -0,0 +1,134 @@
+package model
+
+import (
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+)
+
+const (
+	SystemRuleAdmin = "admin" // 超级用户组，默认 admin
+	SystemRuleTeam  = "team"  // 用户组和服务器 Team 标签一致，标签 key 可配置
+	SystemRuleOwner = "owner" // 服务器 Owner 标签是用户本人，标签 key 可配置
+
+	SkipDisabled      = "disabled"
+	SkipExpired       = "expired"
+	SkipOutOfSchedule = "out_of_schedule" // 不在生效时间窗口内
+	SkipSourceDenied  = "source_denied"   // 客户端地址不在策略允许的来源网段内
+)
+
+// 权限校验请求，server 支持 IP，名称或者 ID
+type PolicyCheckRequest struct {
+	UserName *string `json:"username" binding:"required"`
+	Action   *Action `json:"action" binding:"required"`
+	Server   *string `json:"server" binding:"required"`
+	Client   *string `json:"client"` // 模拟的客户端地址，为空时不判断策略来源地址限制
+}
+
+type PolicyRef struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Subject string `json:"subject,omitempty"` // 策略通过用户还是用户组授予
+
+	ExpiresAt  time.Time   `json:"expires_at"`
+	LoginUsers ArrayString `json:"login_users,omitempty"` // 策略允许的登录用户，为空不限制
+	Reason     string      `json:"reason,omitempty"`
+}
+
+// 权限判断结果以及判断依据
+type PolicyExplain struct {
+	User            string      `json:"user"`
+	Action          Action      `json:"action"`
+	ServerID        string      `json:"server_id"`
+	ServerName      string      `json:"server_name"`
+	ServerHost      string      `json:"server_host"`
+	Allow           bool        `json:"allow"`
+	SystemRule      string      `json:"system_rule,omitempty"` // 命中的系统规则 admin,team,owner
+	AllowPolicies   []PolicyRef `json:"allow_policies"`
+	DenyPolicies    []PolicyRef `json:"deny_policies"`
+	SkippedPolicies []PolicyRef `json:"skipped_policies"` // 失效或者未启用的策略
+	Message         string      `json:"message"`
+	Notice          string      `json:"notice,omitempty"` // 外部授权服务允许时附加的提示，连接时显示在终端
+}
+
+// 按策略逐条判断，有一条拒绝就拒绝，至少有一条允许才允许
+// 和 MatchPolicy 不同的是拒绝后也会继续判断，方便展示所有命中的策略
+// client 为空时不判断来源地址限制，用于报表这类没有客户端的场景
+func ExplainPolicies(user User, inPutAction Action, server Server, policies []Policy, onlyIp bool, client string, now time.Time) *PolicyExplain {
+	explain := &PolicyExplain{
+		User:            tea.StringValue(user.Username),
+		Action:          inPutAction,
+		ServerID:        server.ID,
+		ServerName:      server.Name,
+		ServerHost:      server.Host,
+		AllowPolicies:   []PolicyRef{},
+		DenyPolicies:    []PolicyRef{},
+		SkippedPolicies: []PolicyRef{},
+	}
+	for _, policy := range policies {
+		ref := PolicyRef{
+			ID:         policy.ID,
+			Name:       policy.Name,
+			Subject:    policy.MatchSubject(user),
+			ExpiresAt:  policy.ExpiresAt,
+			LoginUsers: policy.LoginUsers,
+		}
+		if !policy.IsEnabled {
+			ref.Reason = SkipDisabled
+			explain.SkippedPolicies = append(explain.SkippedPolicies, ref)
+			continue
+		}
+		if policy.ExpiresAt.Before(now) {
+			ref.Reason = SkipExpired
+			explain.SkippedPolicies = append(explain.SkippedPolicies, ref)
+			continue
+		}
+		if policy.Schedule != nil && !policy.Schedule.Active(now) {
+			ref.Reason = SkipOutOfSchedule
+			explain.SkippedPolicies = append(explain.SkippedPolicies, ref)
+			continue
+		}
+		if client != "" && !policy.MatchSource(client) {
+			ref.Reason = SkipSourceDenied
+			explain.SkippedPolicies = append(explain.SkippedPolicies, ref)
+			continue
+		}
+		allow := PolicyCheck(inPutAction, server, policy, onlyIp)
+		if allow == nil {
+			continue
+		}
+		if *allow {
+			explain.AllowPolicies = append(explain.AllowPolicies, ref)
+		} else {
+			explain.DenyPolicies = append(explain.DenyPolicies, ref)
+		}
+	}
+
+	switch {
+	case len(explain.DenyPolicies) > 0:
+		explain.Message = "denied by policy"
+	case len(explain.AllowPolicies) > 0:
+		explain.Allow = true
+		explain.Message = "allowed by policy"
+	default:
+		explain.Message = "no policy matched"
+	}
+	return explain
+}
+
+// 判断是否允许使用该用户登录服务器
+// 系统规则或者未启用数据库时不限制登录用户，多个允许的策略任意一个允许即可
+func (e *PolicyExplain) AllowLoginUser(loginUser string) bool {
+	if !e.Allow {
+		return false
+	}
+	if e.SystemRule != "" || len(e.AllowPolicies) == 0 {
+		return true
+	}
+	for _, ref := range e.AllowPolicies {
+		if len(ref.LoginUsers) == 0 || ref.LoginUsers.Contains(loginUser) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	"github.com/xops-infra/jms/model"
+	"github.com/xops-infra/noop/log"
+)
+
+func init() {
+	log.Default().WithLevel(log.InfoLevel).WithFilename("/tmp/test.log").Init()
+}
+
+func TestExplainPolicies(t *testing.T) {
+	now := time.Now()
+	user := model.User{Username: tea.String("alice"), Groups: model.ArrayString{"sre"}}
+	server := model.Server{ID: "i-1", Name: "test-server", Host: "127.0.0.1"}
+	allow := model.Policy{
+		ID:             "allow",
+		Users:          model.ArrayString{"alice"},
+		IsEnabled:      true,
+		Actions:        model.ConnectOnly,
+		ExpiresAt:      now.Add(time.Hour),
+		ServerFilterV1: &model.ServerFilterV1{IpAddr: []string{"127.0.0.1"}},
+	}
+	deny := model.Policy{
+		ID:             "deny",
+		Groups:         model.ArrayString{"sre"},
+		IsEnabled:      true,
+		Actions:        model.ArrayString{string(model.DenyConnect)},
+		ExpiresAt:      now.Add(time.Hour),
+		ServerFilterV1: &model.ServerFilterV1{Name: []string{"test*"}},
+	}
+	disabled := allow
+	disabled.ID = "disabled"
+	disabled.IsEnabled = false
+	expired := allow
+	expired.ID = "expired"
+	expired.ExpiresAt = now.Add(-time.Hour)
+	other := allow
+	other.ID = "other"
+	other.ServerFilterV1 = &model.ServerFilterV1{IpAddr: []string{"10.0.0.1"}}
+
+	{
+		explain := model.ExplainPolicies(user, model.Connect, server, []model.Policy{allow, other}, false, "", now)
+		assert.True(t, explain.Allow)
+		assert.Equal(t, []string{"allow"}, refIDs(explain.AllowPolicies))
+		assert.Empty(t, explain.DenyPolicies)
+	}
+	{
+		// 有拒绝的策略就拒绝，同时也展示允许的策略
+		explain := model.ExplainPolicies(user, model.Connect, server, []model.Policy{allow, deny}, false, "", now)
+		assert.False(t, explain.Allow)
+		assert.Equal(t, []string{"allow"}, refIDs(explain.AllowPolicies))
+		assert.Equal(t, []string{"deny"}, refIDs(explain.DenyPolicies))
+		assert.Equal(t, "user:alice", explain.AllowPolicies[0].Subject)
+		assert.Equal(t, "group:sre", explain.DenyPolicies[0].Subject)
+	}
+	{
+		explain := model.ExplainPolicies(user, model.Connect, server, []model.Policy{disabled, expired}, false, "", now)
+		assert.False(t, explain.Allow)
+		assert.Equal(t, "no policy matched", explain.Message)
+		assert.Equal(t, []string{"disabled", "expired"}, refIDs(explain.SkippedPolicies))
+		assert.Equal(t, model.SkipDisabled, explain.SkippedPolicies[0].Reason)
+		assert.Equal(t, model.SkipExpired, explain.SkippedPolicies[1].Reason)
+	}
+	{
+		// 来源地址不在允许网段内跳过策略，client 为空不判断
+		office := allow
+		office.ID = "office"
+		office.SourceCIDRs = model.ArrayString{"10.0.0.0/8"}
+		explain := model.ExplainPolicies(user, model.Connect, server, []model.Policy{office}, false, "10.1.1.1:50000", now)
+		assert.True(t, explain.Allow)
+		explain = model.ExplainPolicies(user, model.Connect, server, []model.Policy{office}, false, "1.1.1.1:50000", now)
+		assert.False(t, explain.Allow)
+		assert.Equal(t, model.SkipSourceDenied, explain.SkippedPolicies[0].Reason)
+		explain = model.ExplainPolicies(user, model.Connect, server, []model.Policy{office}, false, "", now)
+		assert.True(t, explain.Allow)
+	}
+	{
+		// 动作不匹配
+		explain := model.ExplainPolicies(user, model.Upload, server, []model.Policy{allow}, false, "", now)
+		assert.False(t, explain.Allow)
+		assert.Empty(t, explain.AllowPolicies)
+	}
+}
+
+func refIDs(refs []model.PolicyRef) []string {
+	ids := []string{}
+	for _, ref := range refs {
+		ids = append(ids, ref.ID)
+	}
+	return ids
+}
+
+func TestPolicyExplain_AllowLoginUser(t *testing.T) {
+	now := time.Now()
+	user := model.User{Username: tea.String("alice")}
+	server := model.Server{ID: "i-1", Name: "test-server", Host: "127.0.0.1"}
+	limited := model.Policy{
+		ID:             "limited",
+		Users:          model.ArrayString{"alice"},
+		IsEnabled:      true,
+		Actions:        model.ConnectOnly,
+		ExpiresAt:      now.Add(time.Hour),
+		ServerFilterV1: &model.ServerFilterV1{IpAddr: []string{"127.0.0.1"}},
+		LoginUsers:     model.ArrayString{"ec2-user"},
+	}
+	{
+		explain := model.ExplainPolicies(user, model.Connect, server, []model.Policy{limited}, false, "", now)
+		assert.True(t, explain.AllowLoginUser("ec2-user"))
+		assert.False(t, explain.AllowLoginUser("root"))
+	}
+	{
+		// 多条策略取并集，没有限制的策略允许所有登录用户
+		open := limited
+		open.ID = "open"
+		open.LoginUsers = nil
+		explain := model.ExplainPolicies(user, model.Connect, server, []model.Policy{limited, open}, false, "", now)
+		assert.True(t, explain.AllowLoginUser("root"))
+	}
+	{
+		notRoot := limited
+		notRoot.LoginUsers = model.ArrayString{"!root"}
+		explain := model.ExplainPolicies(user, model.Connect, server, []model.Policy{notRoot}, false, "", now)
+		assert.True(t, explain.AllowLoginUser("ubuntu"))
+		assert.False(t, explain.AllowLoginUser("root"))
+	}
+	{
+		// 没有权限时任何登录用户都不允许
+		explain := model.ExplainPolicies(user, model.Connect, server, nil, false, "", now)
+		assert.False(t, explain.AllowLoginUser("ec2-user"))
+	}
+}
+
+func TestParseScpTarget(t *testing.T) {
+	user, host, path, err := model.ParseScpTarget("root@10.9.0.1:/data/xx.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"root", "10.9.0.1", "/data/xx.zip"}, []string{user, host, path})
+
+	user, host, path, err = model.ParseScpTarget("ec2-user@10.9.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ec2-user", "10.9.0.1", ""}, []string{user, host, path})
+
+	_, _, _, err = model.ParseScpTarget("10.9.0.1:/data")
+	assert.Error(t, err)
+}
@@ -0,0 +1,168 @@
+package model
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/xops-infra/noop/log"
+)
+
+const regexPrefix = "~"
+
+var regexCache sync.Map // string -> *regexp.Regexp
+
+func (a ServerFilterV1) IsEmpty() bool {
+	return a.EnvType == nil && a.Team == nil && a.Name == nil && a.IpAddr == nil && a.KV == nil &&
+		len(a.Tags) == 0 && len(a.All) == 0 && len(a.Any) == 0
+}
+
+// 校验正则、CIDR 和标签条件是否合法，入库前调用
+func (a ServerFilterV1) Validate() error {
+	for _, name := range a.Name {
+		expr, ok := cutRegex(name)
+		if !ok {
+			continue
+		}
+		if _, err := compileAnchored(expr); err != nil {
+			return fmt.Errorf("invalid name regex %s: %s", name, err)
+		}
+	}
+	for _, ip := range a.IpAddr {
+		cidr := strings.TrimPrefix(ip, "!")
+		if !strings.Contains(cidr, "/") {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid ip cidr %s: %s", ip, err)
+		}
+	}
+	for _, cond := range a.Tags {
+		if err := cond.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, sub := range append(a.All, a.Any...) {
+		if err := sub.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t TagCondition) Validate() error {
+	if t.Key == "" {
+		return fmt.Errorf("tag condition key is empty")
+	}
+	switch t.Operator {
+	case TagEqual, TagNotEqual, TagExists, TagNotExists:
+		return nil
+	case TagIn:
+		if len(t.Values) == 0 {
+			return fmt.Errorf("tag condition %s in need values", t.Key)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid tag operator %s, must be one of =, !=, in, exists, not exists", t.Operator)
+	}
+}
+
+// 标签不存在时 != 和 not exists 视为满足
+func (t TagCondition) Match(server Server) bool {
+	var value *string
+	for _, tag := range server.Tags {
+		if tag.Key == t.Key {
+			v := tag.Value
+			value = &v
+			break
+		}
+	}
+	switch t.Operator {
+	case TagEqual:
+		return value != nil && *value == t.Value
+	case TagNotEqual:
+		return value == nil || *value != t.Value
+	case TagIn:
+		if value == nil {
+			return false
+		}
+		for _, v := range t.Values {
+			if *value == v {
+				return true
+			}
+		}
+		return false
+	case TagExists:
+		return value != nil
+	case TagNotExists:
+		return value == nil
+	default:
+		log.Errorf("invalid tag operator %s", t.Operator)
+		return false
+	}
+}
+
+// 多个值满足任意一个
+func matchAny(judges []string, std string, match func(std, judge string) bool) bool {
+	for _, judge := range judges {
+		if match(std, judge) {
+			return true
+		}
+	}
+	return false
+}
+
+// 支持 CIDR，同样支持 ! 取反
+func ipMatch(std, judge string) bool {
+	cidr := strings.TrimPrefix(judge, "!")
+	if !strings.Contains(cidr, "/") {
+		return stringMatch(std, judge)
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		log.Errorf("invalid cidr %s: %s", judge, err)
+		return false
+	}
+	ip := net.ParseIP(std)
+	if ip == nil {
+		return false
+	}
+	return ipNet.Contains(ip) != strings.HasPrefix(judge, "!")
+}
+
+// ~ 开头为正则，!~ 为正则取反
+func nameMatch(std, judge string) bool {
+	expr, ok := cutRegex(judge)
+	if !ok {
+		return stringMatch(std, judge)
+	}
+	re, err := compileAnchored(expr)
+	if err != nil {
+		log.Errorf("invalid regex %s: %s", judge, err)
+		return false
+	}
+	return re.MatchString(std) != strings.HasPrefix(judge, "!")
+}
+
+func cutRegex(judge string) (string, bool) {
+	judge = strings.TrimPrefix(judge, "!")
+	if !strings.HasPrefix(judge, regexPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(judge, regexPrefix), true
+}
+
+// 正则首尾锚定，避免 web 匹配到 web-admin 这类意外情况
+func compileAnchored(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(expr, re)
+	return re, nil
+}
@@ -0,0 +1,133 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mcsModel "github.com/xops-infra/multi-cloud-sdk/pkg/model"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestMatchServerByFilter(t *testing.T) {
+	server := model.Server{
+		Name: "web-01",
+		Host: "10.9.1.20",
+		Tags: mcsModel.Tags{
+			{Key: "EnvType", Value: "prod"},
+			{Key: "Team", Value: "ops"},
+			{Key: "Owner", Value: "alice"},
+			{Key: "App", Value: "nginx"},
+		},
+	}
+
+	cases := []struct {
+		name   string
+		filter model.ServerFilterV1
+		onlyIp bool
+		want   bool
+	}{
+		{"empty filter", model.ServerFilterV1{}, false, false},
+		{"empty tags and groups", model.ServerFilterV1{Tags: []model.TagCondition{}, Any: []model.ServerFilterV1{}}, false, false},
+
+		// 兼容原有写法
+		{"name exact", model.ServerFilterV1{Name: []string{"web-01"}}, false, true},
+		{"name prefix", model.ServerFilterV1{Name: []string{"web*"}}, false, true},
+		{"name negate", model.ServerFilterV1{Name: []string{"!web*"}}, false, false},
+		{"name any of list", model.ServerFilterV1{Name: []string{"db-01", "web-01"}}, false, true},
+		{"ip exact", model.ServerFilterV1{IpAddr: []string{"10.9.1.20"}}, false, true},
+		{"ip prefix", model.ServerFilterV1{IpAddr: []string{"10.9.*"}}, false, true},
+		{"ip negate", model.ServerFilterV1{IpAddr: []string{"!10.9.*"}}, false, false},
+		{"env type", model.ServerFilterV1{EnvType: []string{"prod"}}, false, true},
+		{"env type mismatch", model.ServerFilterV1{EnvType: []string{"dev"}}, false, false},
+		{"team star", model.ServerFilterV1{Team: []string{"*"}}, false, true},
+		{"kv", model.ServerFilterV1{KV: &model.KV{Key: "App", Value: "nginx"}}, false, true},
+		{"kv mismatch", model.ServerFilterV1{KV: &model.KV{Key: "App", Value: "redis"}}, false, false},
+		{"and of dimensions", model.ServerFilterV1{Name: []string{"web*"}, EnvType: []string{"dev"}}, false, false},
+
+		// CIDR
+		{"cidr match", model.ServerFilterV1{IpAddr: []string{"10.9.0.0/16"}}, false, true},
+		{"cidr mismatch", model.ServerFilterV1{IpAddr: []string{"10.8.0.0/16"}}, false, false},
+		{"cidr negate", model.ServerFilterV1{IpAddr: []string{"!10.9.1.0/24"}}, false, false},
+		{"cidr negate mismatch", model.ServerFilterV1{IpAddr: []string{"!10.8.0.0/16"}}, false, true},
+		{"cidr invalid", model.ServerFilterV1{IpAddr: []string{"10.9.0.0/99"}}, false, false},
+		{"cidr only ip", model.ServerFilterV1{IpAddr: []string{"10.9.1.0/24"}, Name: []string{"db*"}}, true, true},
+
+		// 正则
+		{"regex match", model.ServerFilterV1{Name: []string{`~web-\d+`}}, false, true},
+		{"regex anchored", model.ServerFilterV1{Name: []string{`~web`}}, false, false},
+		{"regex negate", model.ServerFilterV1{Name: []string{`!~web-\d+`}}, false, false},
+		{"regex negate mismatch", model.ServerFilterV1{Name: []string{`!~db-\d+`}}, false, true},
+		{"regex invalid", model.ServerFilterV1{Name: []string{`~web-(`}}, false, false},
+
+		// 标签条件
+		{"tag equal", model.ServerFilterV1{Tags: []model.TagCondition{{Key: "App", Operator: model.TagEqual, Value: "nginx"}}}, false, true},
+		{"tag not equal", model.ServerFilterV1{Tags: []model.TagCondition{{Key: "App", Operator: model.TagNotEqual, Value: "nginx"}}}, false, false},
+		{"tag not equal missing key", model.ServerFilterV1{Tags: []model.TagCondition{{Key: "Db", Operator: model.TagNotEqual, Value: "x"}}}, false, true},
+		{"tag in", model.ServerFilterV1{Tags: []model.TagCondition{{Key: "App", Operator: model.TagIn, Values: []string{"redis", "nginx"}}}}, false, true},
+		{"tag in mismatch", model.ServerFilterV1{Tags: []model.TagCondition{{Key: "App", Operator: model.TagIn, Values: []string{"redis"}}}}, false, false},
+		{"tag exists", model.ServerFilterV1{Tags: []model.TagCondition{{Key: "Owner", Operator: model.TagExists}}}, false, true},
+		{"tag exists missing", model.ServerFilterV1{Tags: []model.TagCondition{{Key: "Db", Operator: model.TagExists}}}, false, false},
+		{"tag not exists", model.ServerFilterV1{Tags: []model.TagCondition{{Key: "Db", Operator: model.TagNotExists}}}, false, true},
+		{"tag not exists present", model.ServerFilterV1{Tags: []model.TagCondition{{Key: "Owner", Operator: model.TagNotExists}}}, false, false},
+		{"tags all required", model.ServerFilterV1{Tags: []model.TagCondition{
+			{Key: "App", Operator: model.TagEqual, Value: "nginx"},
+			{Key: "EnvType", Operator: model.TagEqual, Value: "dev"},
+		}}, false, false},
+		{"tag invalid operator", model.ServerFilterV1{Tags: []model.TagCondition{{Key: "App", Operator: "like", Value: "nginx"}}}, false, false},
+
+		// 分组
+		{"any one match", model.ServerFilterV1{Any: []model.ServerFilterV1{
+			{EnvType: []string{"dev"}},
+			{Team: []string{"ops"}},
+		}}, false, true},
+		{"any none match", model.ServerFilterV1{Any: []model.ServerFilterV1{
+			{EnvType: []string{"dev"}},
+			{Team: []string{"data"}},
+		}}, false, false},
+		{"all match", model.ServerFilterV1{All: []model.ServerFilterV1{
+			{EnvType: []string{"prod"}},
+			{IpAddr: []string{"10.9.0.0/16"}},
+		}}, false, true},
+		{"all one mismatch", model.ServerFilterV1{All: []model.ServerFilterV1{
+			{EnvType: []string{"prod"}},
+			{IpAddr: []string{"10.8.0.0/16"}},
+		}}, false, false},
+		{"top level and any", model.ServerFilterV1{
+			Name: []string{"web*"},
+			Any: []model.ServerFilterV1{
+				{Team: []string{"data"}},
+				{Tags: []model.TagCondition{{Key: "Owner", Operator: model.TagEqual, Value: "alice"}}},
+			},
+		}, false, true},
+		{"top level mismatch with any", model.ServerFilterV1{
+			Name: []string{"db*"},
+			Any:  []model.ServerFilterV1{{Team: []string{"ops"}}},
+		}, false, false},
+		{"nested groups", model.ServerFilterV1{Any: []model.ServerFilterV1{
+			{All: []model.ServerFilterV1{{EnvType: []string{"dev"}}, {Team: []string{"ops"}}}},
+			{All: []model.ServerFilterV1{{EnvType: []string{"prod"}}, {Team: []string{"ops"}}}},
+		}}, false, true},
+		{"empty sub filter", model.ServerFilterV1{Any: []model.ServerFilterV1{{}}}, false, false},
+		{"only ip with groups", model.ServerFilterV1{Any: []model.ServerFilterV1{
+			{IpAddr: []string{"10.8.0.0/16"}},
+			{IpAddr: []string{"10.9.0.0/16"}},
+		}}, true, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, model.MatchServerByFilter(c.filter, server, c.onlyIp))
+		})
+	}
+}
+
+func TestServerFilterV1_Validate(t *testing.T) {
+	assert.NoError(t, model.ServerFilterV1{Name: []string{`~web-\d+`, "db*"}, IpAddr: []string{"10.0.0.0/8", "!10.1.0.0/16", "*"}}.Validate())
+	assert.Error(t, model.ServerFilterV1{Name: []string{`~web-(`}}.Validate())
+	assert.Error(t, model.ServerFilterV1{IpAddr: []string{"!10.0.0.0/33"}}.Validate())
+	assert.Error(t, model.ServerFilterV1{Tags: []model.TagCondition{{Key: "App", Operator: "like"}}}.Validate())
+	assert.Error(t, model.ServerFilterV1{Tags: []model.TagCondition{{Key: "App", Operator: model.TagIn}}}.Validate())
+	assert.Error(t, model.ServerFilterV1{Tags: []model.TagCondition{{Operator: model.TagExists}}}.Validate())
+	assert.Error(t, model.ServerFilterV1{Any: []model.ServerFilterV1{{Name: []string{`~(`}}}}.Validate())
+}
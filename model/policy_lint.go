@@ -0,0 +1,192 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type LintLevel string
+
+const (
+	LintError   LintLevel = "error"
+	LintWarning LintLevel = "warning"
+)
+
+// 策略检查规则
+const (
+	LintEmptyFilter    = "empty_filter"       // 过滤条件为空，MatchServerByFilter 视为不匹配任何服务器
+	LintNoServer       = "no_server"          // 过滤条件匹配不到任何服务器
+	LintExpiredEnabled = "expired_enabled"    // 已经过期但仍然启用
+	LintDenyShadow     = "deny_shadows_allow" // 拒绝策略覆盖了允许策略
+	LintDuplicate      = "duplicate_grant"    // 授权已经被其他策略完全包含
+)
+
+type LintIssue struct {
+	Rule       string    `json:"rule"`
+	Level      LintLevel `json:"level"`
+	PolicyID   string    `json:"policy_id"`
+	PolicyName string    `json:"policy_name"`
+	Related    []string  `json:"related,omitempty"` // 相关的策略 ID
+	Message    string    `json:"message"`
+}
+
+type LintReport struct {
+	Policies int         `json:"policies"`
+	Servers  int         `json:"servers"`
+	Issues   []LintIssue `json:"issues"`
+}
+
+func (r LintReport) HasError() bool {
+	for _, issue := range r.Issues {
+		if issue.Level == LintError {
+			return true
+		}
+	}
+	return false
+}
+
+// 策略在当前用户和服务器下的实际授权范围
+type lintScope struct {
+	policy   Policy
+	subjects map[string]bool // 命中的用户名
+	servers  map[string]bool // 命中的服务器 host
+	allows   map[string]bool
+	denies   map[string]bool // 存的是被拒绝的动作，比如 deny_connect 存 connect
+}
+
+func (s lintScope) active(now time.Time) bool {
+	return s.policy.IsEnabled && !s.policy.ExpiresAt.Before(now)
+}
+
+// 有额外限制的策略不能视为和其他策略重复
+func (s lintScope) restricted() bool {
+	return s.policy.Schedule != nil || len(s.policy.SourceCIDRs) > 0 || len(s.policy.LoginUsers) > 0
+}
+
+// LintPolicies 检查策略问题，用户用于展开用户组计算策略之间的重叠
+func LintPolicies(policies []Policy, servers []Server, users []User, now time.Time) LintReport {
+	report := LintReport{Policies: len(policies), Servers: len(servers), Issues: []LintIssue{}}
+	issue := func(rule string, level LintLevel, policy Policy, related []string, format string, args ...interface{}) {
+		report.Issues = append(report.Issues, LintIssue{
+			Rule:       rule,
+			Level:      level,
+			PolicyID:   policy.ID,
+			PolicyName: policy.Name,
+			Related:    related,
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	var scopes []lintScope
+	for _, policy := range policies {
+		if policy.IsDeleted {
+			continue
+		}
+		if policy.IsEnabled && policy.ExpiresAt.Before(now) {
+			issue(LintExpiredEnabled, LintWarning, policy, nil, "policy expired at %s but still enabled", policy.ExpiresAt.Format(time.RFC3339))
+		}
+		if policy.ServerFilterV1 == nil || policy.ServerFilterV1.IsEmpty() {
+			issue(LintEmptyFilter, LintError, policy, nil, "server filter is empty, policy matches no server")
+			continue
+		}
+		scope := lintScope{
+			policy:   policy,
+			subjects: map[string]bool{},
+			servers:  map[string]bool{},
+			allows:   map[string]bool{},
+			denies:   map[string]bool{},
+		}
+		for _, server := range servers {
+			if MatchServerByFilter(*policy.ServerFilterV1, server, false) {
+				scope.servers[server.Host] = true
+			}
+		}
+		if len(scope.servers) == 0 {
+			issue(LintNoServer, LintWarning, policy, nil, "server filter matches none of %d servers", len(servers))
+			continue
+		}
+		for _, user := range users {
+			if user.Username != nil && policy.MatchSubject(user) != "" {
+				scope.subjects[*user.Username] = true
+			}
+		}
+		for _, action := range policy.Actions {
+			if strings.HasPrefix(action, "deny_") {
+				scope.denies[string(ReverseAction(Action(action)))] = true
+			} else {
+				scope.allows[action] = true
+			}
+		}
+		scopes = append(scopes, scope)
+	}
+
+	for i, allow := range scopes {
+		if !allow.active(now) || len(allow.allows) == 0 {
+			continue
+		}
+		for _, deny := range scopes {
+			if !deny.active(now) || deny.policy.ID == allow.policy.ID {
+				continue
+			}
+			actions := intersect(allow.allows, deny.denies)
+			users := intersect(allow.subjects, deny.subjects)
+			hosts := intersect(allow.servers, deny.servers)
+			if len(actions) == 0 || len(users) == 0 || len(hosts) == 0 {
+				continue
+			}
+			coverage := "partially"
+			if len(hosts) == len(allow.servers) && len(users) == len(allow.subjects) {
+				coverage = "fully"
+			}
+			issue(LintDenyShadow, LintWarning, allow.policy, []string{deny.policy.ID},
+				"%s %s shadowed by deny policy %s for %d users on %d servers",
+				strings.Join(actions, ","), coverage, deny.policy.Name, len(users), len(hosts))
+		}
+		for j, other := range scopes {
+			if i == j || !other.active(now) || other.restricted() || allow.restricted() {
+				continue
+			}
+			if !covers(other, allow) || other.policy.ExpiresAt.Before(allow.policy.ExpiresAt) {
+				continue
+			}
+			// 完全相同的两条只报一次
+			if covers(allow, other) && allow.policy.ExpiresAt.Equal(other.policy.ExpiresAt) && j > i {
+				continue
+			}
+			issue(LintDuplicate, LintWarning, allow.policy, []string{other.policy.ID},
+				"grant is already covered by policy %s", other.policy.Name)
+			break
+		}
+	}
+	return report
+}
+
+// outer 的用户、服务器和允许的动作都包含 inner
+func covers(outer, inner lintScope) bool {
+	if len(inner.subjects) == 0 {
+		return false
+	}
+	return subset(inner.subjects, outer.subjects) && subset(inner.servers, outer.servers) && subset(inner.allows, outer.allows)
+}
+
+func subset(a, b map[string]bool) bool {
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func intersect(a, b map[string]bool) []string {
+	var res []string
+	for k := range a {
+		if b[k] {
+			res = append(res, k)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
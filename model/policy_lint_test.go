@@ -0,0 +1,75 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestLintPolicies(t *testing.T) {
+	now := time.Now()
+	servers := []model.Server{
+		{ID: "i-1", Name: "web-1", Host: "10.0.0.1"},
+		{ID: "i-2", Name: "web-2", Host: "10.0.0.2"},
+		{ID: "i-3", Name: "db-1", Host: "10.0.1.1"},
+	}
+	users := []model.User{
+		{Username: tea.String("alice"), Groups: model.ArrayString{"sre"}},
+		{Username: tea.String("bob"), Groups: model.ArrayString{"dev"}},
+	}
+	policy := func(id string, filter *model.ServerFilterV1, actions model.ArrayString) model.Policy {
+		return model.Policy{
+			ID:             id,
+			Name:           id,
+			Users:          model.ArrayString{"alice"},
+			IsEnabled:      true,
+			Actions:        actions,
+			ExpiresAt:      now.Add(time.Hour),
+			ServerFilterV1: filter,
+		}
+	}
+	web := &model.ServerFilterV1{Name: []string{"web-*"}}
+	all := &model.ServerFilterV1{IpAddr: []string{"10.0.0.0/16"}}
+
+	empty := policy("empty", &model.ServerFilterV1{}, model.ConnectOnly)
+	none := policy("none", &model.ServerFilterV1{IpAddr: []string{"192.168.0.1"}}, model.ConnectOnly)
+	expired := policy("expired", web, model.DownloadOnly)
+	expired.ExpiresAt = now.Add(-time.Hour)
+	allow := policy("allow", web, model.ConnectOnly)
+	wide := policy("wide", all, model.ConnectAndDownload)
+	deny := policy("deny", &model.ServerFilterV1{Name: []string{"web-1"}}, model.ArrayString{string(model.DenyConnect)})
+	deny.Users = nil
+	deny.Groups = model.ArrayString{"sre"}
+	// 只对 bob 生效，不影响 alice
+	other := policy("other", all, model.ArrayString{string(model.DenyDownload)})
+	other.Users = model.ArrayString{"bob"}
+
+	report := model.LintPolicies([]model.Policy{empty, none, expired, allow, wide, deny, other}, servers, users, now)
+	got := map[string][]string{}
+	for _, issue := range report.Issues {
+		got[issue.Rule] = append(got[issue.Rule], issue.PolicyID)
+	}
+	assert.Equal(t, []string{"empty"}, got[model.LintEmptyFilter])
+	assert.Equal(t, []string{"none"}, got[model.LintNoServer])
+	assert.Equal(t, []string{"expired"}, got[model.LintExpiredEnabled])
+	assert.Equal(t, []string{"allow", "wide"}, got[model.LintDenyShadow])
+	// allow 被 wide 完全包含
+	assert.Equal(t, []string{"allow"}, got[model.LintDuplicate])
+	assert.True(t, report.HasError())
+
+	// 完全相同的策略只报一次，有时间窗口等额外限制的不算重复
+	copied := wide
+	copied.ID = "copied"
+	report = model.LintPolicies([]model.Policy{wide, copied}, servers, users, now)
+	assert.Len(t, report.Issues, 1)
+	assert.Equal(t, "copied", report.Issues[0].PolicyID)
+	assert.False(t, report.HasError())
+
+	copied.SourceCIDRs = model.ArrayString{"10.8.0.0/16"}
+	report = model.LintPolicies([]model.Policy{wide, copied}, servers, users, now)
+	assert.Empty(t, report.Issues)
+}
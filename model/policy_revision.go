@@ -0,0 +1,89 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type RevisionAction string
+
+const (
+	RevisionBaseline RevisionAction = "baseline" // 开启版本记录前已经存在的策略，第一次变更前补一份快照
+	RevisionCreate   RevisionAction = "create"
+	RevisionUpdate   RevisionAction = "update"
+	RevisionDelete   RevisionAction = "delete"
+	RevisionApprove  RevisionAction = "approve"
+	RevisionRestore  RevisionAction = "restore"
+	RevisionExpire   RevisionAction = "expire" // 定时任务标记策略过期
+
+	RevisionAuthorSystem = "system" // 没有操作人的变更，比如定时任务和钉钉审批回调
+)
+
+// PolicyRevision 策略的不可变版本记录，每次变更后保存完整快照
+type PolicyRevision struct {
+	ID          uint           `json:"id" gorm:"primary_key"`
+	CreatedAt   time.Time      `json:"created_at" gorm:"column:created_at"`
+	PolicyID    string         `json:"policy_id" gorm:"column:policy_id;type:varchar(64);index;not null"`
+	Revision    int            `json:"revision" gorm:"column:revision;not null"`
+	Action      RevisionAction `json:"action" gorm:"column:action;type:varchar(32);not null"`
+	Author      string         `json:"author" gorm:"column:author;type:varchar(255);not null"`
+	RestoreFrom int            `json:"restore_from,omitempty" gorm:"column:restore_from"` // 恢复自哪个版本
+	Snapshot    string         `json:"snapshot" gorm:"column:snapshot;type:text;not null"`
+}
+
+func (PolicyRevision) TableName() string {
+	return "jms_go_policy_revision"
+}
+
+func NewPolicyRevision(policy Policy, revision int, action RevisionAction, author string, restoreFrom int) (*PolicyRevision, error) {
+	snapshot, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+	if author == "" {
+		author = RevisionAuthorSystem
+	}
+	return &PolicyRevision{
+		PolicyID:    policy.ID,
+		Revision:    revision,
+		Action:      action,
+		Author:      author,
+		RestoreFrom: restoreFrom,
+		Snapshot:    string(snapshot),
+	}, nil
+}
+
+func (r PolicyRevision) Policy() (*Policy, error) {
+	var policy Policy
+	if err := json.Unmarshal([]byte(r.Snapshot), &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// PolicyRevisionDiff 两个版本之间有变化的字段
+type PolicyRevisionDiff struct {
+	PolicyID string                `json:"policy_id"`
+	From     int                   `json:"from"`
+	To       int                   `json:"to"`
+	Changes  map[string]ChangeItem `json:"changes"`
+}
+
+// 更新时间每个版本都不同，不参与对比
+func DiffPolicyRevision(from, to PolicyRevision) (*PolicyRevisionDiff, error) {
+	var before, after map[string]interface{}
+	if err := json.Unmarshal([]byte(from.Snapshot), &before); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(to.Snapshot), &after); err != nil {
+		return nil, err
+	}
+	delete(before, "updated_at")
+	delete(after, "updated_at")
+	return &PolicyRevisionDiff{
+		PolicyID: to.PolicyID,
+		From:     from.Revision,
+		To:       to.Revision,
+		Changes:  DiffChange(before, after),
+	}, nil
+}
@@ -0,0 +1,40 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestDiffPolicyRevision(t *testing.T) {
+	policy := model.Policy{
+		ID:        "p-1",
+		Name:      "test",
+		Users:     model.ArrayString{"alice"},
+		Actions:   model.ConnectOnly,
+		UpdatedAt: time.Now(),
+	}
+	from, err := model.NewPolicyRevision(policy, 1, model.RevisionCreate, "", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RevisionAuthorSystem, from.Author)
+
+	policy.Users = model.ArrayString{"alice", "bob"}
+	policy.UpdatedAt = policy.UpdatedAt.Add(time.Minute)
+	to, err := model.NewPolicyRevision(policy, 2, model.RevisionUpdate, "admin", 0)
+	assert.NoError(t, err)
+
+	diff, err := model.DiffPolicyRevision(*from, *to)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, diff.From)
+	assert.Equal(t, 2, diff.To)
+	// updated_at 不参与对比
+	assert.Len(t, diff.Changes, 1)
+	assert.Equal(t, []interface{}{"alice", "bob"}, diff.Changes["users"].After)
+
+	restored, err := from.Policy()
+	assert.NoError(t, err)
+	assert.Equal(t, model.ArrayString{"alice"}, restored.Users)
+}
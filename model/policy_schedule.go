@@ -0,0 +1,147 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// 策略生效时间窗口，start/end 和 cron 同时配置时需要同时满足
+type PolicySchedule struct {
+	Timezone         string `json:"timezone"`           // 时区，默认服务器本地时区，如 Asia/Shanghai
+	Weekdays         []int  `json:"weekdays"`           // 0-6 表示周日到周六，为空表示每天
+	Start            string `json:"start"`              // 开始时间，如 09:00
+	End              string `json:"end"`                // 结束时间，如 19:00，小于开始时间表示跨天
+	Cron             string `json:"cron"`               // cron 范围(分 时 日 月 周)，命中的分钟都在窗口内，如 "* 2-4 * * 6"
+	TerminateOnClose bool   `json:"terminate_on_close"` // 窗口关闭时断开还在连接的会话
+}
+
+func (s PolicySchedule) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *PolicySchedule) Scan(value interface{}) error {
+	bytesValue, _ := value.([]byte)
+	return json.Unmarshal(bytesValue, s)
+}
+
+func (s PolicySchedule) Validate() error {
+	if s.Start == "" && s.End == "" && s.Cron == "" {
+		return fmt.Errorf("schedule need start/end or cron")
+	}
+	if _, err := s.location(); err != nil {
+		return fmt.Errorf("invalid schedule timezone %s: %s", s.Timezone, err)
+	}
+	for _, day := range s.Weekdays {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("invalid schedule weekday %d, must be 0-6", day)
+		}
+	}
+	if s.Start != "" || s.End != "" {
+		if _, err := parseClock(s.Start); err != nil {
+			return fmt.Errorf("invalid schedule start %s: %s", s.Start, err)
+		}
+		if _, err := parseClock(s.End); err != nil {
+			return fmt.Errorf("invalid schedule end %s: %s", s.End, err)
+		}
+	}
+	if s.Cron != "" {
+		if _, err := cron.ParseStandard(s.Cron); err != nil {
+			return fmt.Errorf("invalid schedule cron %s: %s", s.Cron, err)
+		}
+	}
+	return nil
+}
+
+// 判断时间是否在窗口内，配置错误视为不在窗口内
+func (s PolicySchedule) Active(now time.Time) bool {
+	loc, err := s.location()
+	if err != nil {
+		return false
+	}
+	now = now.In(loc)
+	if s.Start != "" || s.End != "" {
+		if !s.inClockWindow(now) {
+			return false
+		}
+	} else if len(s.Weekdays) > 0 && !slices.Contains(s.Weekdays, int(now.Weekday())) {
+		return false
+	}
+	if s.Cron != "" {
+		sched, err := cron.ParseStandard(s.Cron)
+		if err != nil {
+			return false
+		}
+		// 当前分钟命中 cron 即在窗口内
+		minute := now.Truncate(time.Minute)
+		if !sched.Next(minute.Add(-time.Second)).Equal(minute) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s PolicySchedule) inClockWindow(now time.Time) bool {
+	start, err := parseClock(s.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(s.End)
+	if err != nil {
+		return false
+	}
+	current := now.Hour()*60 + now.Minute()
+	day := now.Weekday()
+	if start <= end {
+		if current < start || current >= end {
+			return false
+		}
+	} else {
+		// 跨天窗口，凌晨的部分算前一天的窗口
+		if current >= end && current < start {
+			return false
+		}
+		if current < end {
+			day = (day + 6) % 7
+		}
+	}
+	return len(s.Weekdays) == 0 || slices.Contains(s.Weekdays, int(day))
+}
+
+func (s PolicySchedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(s.Timezone)
+}
+
+// 解析 HH:MM，返回当天的分钟数
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// 找到会话依赖的时间窗口关闭的策略：因为不在窗口内被跳过，要求断开会话，并且允许连接该服务器
+func ClosedSchedulePolicy(explain *PolicyExplain, policies []Policy, server Server) *Policy {
+	for _, ref := range explain.SkippedPolicies {
+		if ref.Reason != SkipOutOfSchedule {
+			continue
+		}
+		for _, policy := range policies {
+			if policy.ID != ref.ID || policy.Schedule == nil || !policy.Schedule.TerminateOnClose {
+				continue
+			}
+			if allow := PolicyCheck(Connect, server, policy, false); allow != nil && *allow {
+				return &policy
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xops-infra/jms/model"
+)
+
+func TestPolicySchedule_Active(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	// 2026-10-19 是周一
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, shanghai)
+	}
+
+	workHours := model.PolicySchedule{
+		Timezone: "Asia/Shanghai",
+		Weekdays: []int{1, 2, 3, 4, 5},
+		Start:    "09:00",
+		End:      "19:00",
+	}
+	nightly := model.PolicySchedule{
+		Timezone: "Asia/Shanghai",
+		Weekdays: []int{5},
+		Start:    "22:00",
+		End:      "02:00",
+	}
+	maintenance := model.PolicySchedule{
+		Timezone: "Asia/Shanghai",
+		Cron:     "* 2-3 * * 6",
+	}
+
+	cases := []struct {
+		name     string
+		schedule model.PolicySchedule
+		now      time.Time
+		want     bool
+	}{
+		{"work hours monday", workHours, at(19, 10, 0), true},
+		{"work hours start inclusive", workHours, at(19, 9, 0), true},
+		{"work hours end exclusive", workHours, at(19, 19, 0), false},
+		{"work hours early", workHours, at(19, 8, 59), false},
+		{"work hours sunday", workHours, at(25, 10, 0), false},
+		{"work hours other timezone", workHours, time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC), true},
+		{"nightly friday night", nightly, at(23, 23, 0), true},
+		{"nightly saturday morning", nightly, at(24, 1, 30), true},
+		{"nightly saturday night", nightly, at(24, 23, 0), false},
+		{"nightly friday morning", nightly, at(23, 1, 0), false},
+		{"maintenance saturday", maintenance, at(24, 2, 30), true},
+		{"maintenance saturday end", maintenance, at(24, 3, 59), true},
+		{"maintenance saturday after", maintenance, at(24, 4, 0), false},
+		{"maintenance sunday", maintenance, at(25, 2, 30), false},
+		{"cron and window", model.PolicySchedule{Start: "00:00", End: "23:59", Cron: "* * * * 1"}, at(19, 12, 0), true},
+		{"invalid timezone", model.PolicySchedule{Timezone: "Mars/Base", Start: "00:00", End: "23:59"}, at(19, 12, 0), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, c.schedule.Active(c.now))
+		})
+	}
+}
+
+func TestPolicySchedule_Validate(t *testing.T) {
+	assert.NoError(t, model.PolicySchedule{Start: "09:00", End: "19:00", Weekdays: []int{1, 5}}.Validate())
+	assert.NoError(t, model.PolicySchedule{Cron: "* 2-4 * * 6", Timezone: "Asia/Shanghai"}.Validate())
+	assert.Error(t, model.PolicySchedule{}.Validate())
+	assert.Error(t, model.PolicySchedule{Start: "9am", End: "19:00"}.Validate())
+	assert.Error(t, model.PolicySchedule{Start: "09:00"}.Validate())
+	assert.Error(t, model.PolicySchedule{Start: "09:00", End: "19:00", Weekdays: []int{7}}.Validate())
+	assert.Error(t, model.PolicySchedule{Cron: "* * *"}.Validate())
+	assert.Error(t, model.PolicySchedule{Cron: "* * * * *", Timezone: "Mars/Base"}.Validate())
+}
+
+func TestExplainPolicies_Schedule(t *testing.T) {
+	now := time.Now()
+	policy := model.Policy{
+		ID:             "night",
+		IsEnabled:      true,
+		Actions:        model.ConnectOnly,
+		ExpiresAt:      now.Add(time.Hour),
+		ServerFilterV1: &model.ServerFilterV1{IpAddr: []string{"*"}},
+		Schedule:       &model.PolicySchedule{Cron: "* * 1 1 *"},
+	}
+	server := model.Server{Host: "127.0.0.1"}
+	// 1 月 1 日才生效
+	inWindow := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	outWindow := time.Date(2026, 1, 2, 12, 0, 0, 0, time.Local)
+
+	explain := model.ExplainPolicies(model.User{}, model.Connect, server, []model.Policy{policy}, false, "", inWindow)
+	assert.True(t, explain.Allow)
+
+	policy.ExpiresAt = outWindow.Add(time.Hour)
+	explain = model.ExplainPolicies(model.User{}, model.Connect, server, []model.Policy{policy}, false, "", outWindow)
+	assert.False(t, explain.Allow)
+	assert.Equal(t, model.SkipOutOfSchedule, explain.SkippedPolicies[0].Reason)
+}
+
+// 只有允许连接会话服务器的策略窗口关闭才断开会话
+func TestClosedSchedulePolicy(t *testing.T) {
+	outWindow := time.Date(2026, 1, 2, 12, 0, 0, 0, time.Local)
+	schedule := &model.PolicySchedule{Cron: "* * 1 1 *", TerminateOnClose: true}
+	policies := []model.Policy{
+		{
+			ID:             "db-night",
+			IsEnabled:      true,
+			Actions:        model.ConnectOnly,
+			ExpiresAt:      outWindow.Add(time.Hour),
+			ServerFilterV1: &model.ServerFilterV1{Name: []string{"db-1"}},
+			Schedule:       schedule,
+		},
+		{
+			ID:             "web-night",
+			IsEnabled:      true,
+			Actions:        model.ConnectOnly,
+			ExpiresAt:      outWindow.Add(time.Hour),
+			ServerFilterV1: &model.ServerFilterV1{Name: []string{"web-1"}},
+			Schedule:       schedule,
+		},
+	}
+	web := model.Server{Name: "web-1", Host: "10.9.0.1"}
+	explain := model.ExplainPolicies(model.User{}, model.Connect, web, policies, false, "", outWindow)
+	assert.False(t, explain.Allow)
+	if policy := model.ClosedSchedulePolicy(explain, policies, web); assert.NotNil(t, policy) {
+		assert.Equal(t, "web-night", policy.ID)
+	}
+
+	other := model.Server{Name: "app-1", Host: "10.9.0.2"}
+	explain = model.ExplainPolicies(model.User{}, model.Connect, other, policies, false, "", outWindow)
+	assert.Nil(t, model.ClosedSchedulePolicy(explain, policies, other))
+}
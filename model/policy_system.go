@@ -0,0 +1,96 @@
+package model
+
+import "fmt"
+
+// 系统规则，不需要数据库策略也能生效的权限
+// 默认 admin 组拥有所有权限，服务器 Team 标签和用户组一致、Owner 标签是用户本人则拥有所有权限
+type SystemPolicy struct {
+	Admin SystemPolicyRule `mapstructure:"admin"` // 超级用户组
+	Team  SystemPolicyRule `mapstructure:"team"`  // 服务器标签值等于用户所在组
+	Owner SystemPolicyRule `mapstructure:"owner"` // 服务器标签值等于用户名
+}
+
+type SystemPolicyRule struct {
+	Disable bool        `mapstructure:"disable"`
+	Groups  ArrayString `mapstructure:"groups"`  // 只对 admin 生效，超级用户组，默认 admin
+	TagKeys ArrayString `mapstructure:"tagKeys"` // 只对 team/owner 生效，比较的服务器标签 key，任一匹配即可
+	Actions ArrayString `mapstructure:"actions"` // 授予的动作，如 connect,download，为空表示所有动作
+}
+
+// 授予的动作，deny 类动作不会被系统规则授予
+func (r SystemPolicyRule) Grant(action Action) bool {
+	if r.Disable {
+		return false
+	}
+	if len(r.Actions) == 0 {
+		return true
+	}
+	return r.Actions.Contains(string(action))
+}
+
+// 服务器任一标签 key 的值满足 match 即可
+func (r SystemPolicyRule) matchTag(server Server, match func(value string) bool) bool {
+	for _, key := range r.TagKeys {
+		for _, tag := range server.Tags {
+			if tag.Key == key && tag.Value != "" && match(tag.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 未配置的字段使用默认值，和之前写死的规则保持一致
+func (s SystemPolicy) WithDefaults() SystemPolicy {
+	if len(s.Admin.Groups) == 0 {
+		s.Admin.Groups = ArrayString{"admin"}
+	}
+	if len(s.Team.TagKeys) == 0 {
+		s.Team.TagKeys = ArrayString{"Team"}
+	}
+	if len(s.Owner.TagKeys) == 0 {
+		s.Owner.TagKeys = ArrayString{"Owner"}
+	}
+	return s
+}
+
+func (s SystemPolicy) Validate() error {
+	rules := map[string]SystemPolicyRule{SystemRuleAdmin: s.Admin, SystemRuleTeam: s.Team, SystemRuleOwner: s.Owner}
+	for name, rule := range rules {
+		for _, action := range rule.Actions {
+			switch Action(action) {
+			case Connect, Download, Upload:
+			default:
+				return fmt.Errorf("system policy %s action %s invalid, must be one of connect, download, upload", name, action)
+			}
+		}
+	}
+	return nil
+}
+
+// 返回命中的系统规则，没有命中返回空
+func (s SystemPolicy) Match(user User, action Action, server Server) string {
+	if s.Admin.Grant(action) {
+		for _, group := range s.Admin.Groups {
+			if user.Groups.Contains(group) {
+				return SystemRuleAdmin
+			}
+		}
+	}
+	if s.Team.Grant(action) && len(user.Groups) > 0 && s.Team.matchTag(server, func(value string) bool {
+		for _, group := range user.Groups {
+			if group == value {
+				return true
+			}
+		}
+		return false
+	}) {
+		return SystemRuleTeam
+	}
+	if s.Owner.Grant(action) && user.Username != nil && s.Owner.matchTag(server, func(value string) bool {
+		return value == *user.Username
+	}) {
+		return SystemRuleOwner
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	mcsModel "github.com/xops-infra/multi-cloud-sdk/pkg/model"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestSystemPolicy_Match(t *testing.T) {
+	server := model.Server{
+		Host: "127.0.0.1",
+		Tags: mcsModel.Tags{
+			{Key: "team", Value: "ops"},
+			{Key: "Owner", Value: "alice"},
+		},
+	}
+	admin := model.User{Username: tea.String("root"), Groups: model.ArrayString{"admin"}}
+	ops := model.User{Username: tea.String("bob"), Groups: model.ArrayString{"ops"}}
+	alice := model.User{Username: tea.String("alice")}
+
+	// 默认规则和之前写死的逻辑一致，Team 标签 key 区分大小写
+	sp := model.SystemPolicy{}.WithDefaults()
+	assert.Equal(t, model.SystemRuleAdmin, sp.Match(admin, model.Upload, server))
+	assert.Equal(t, "", sp.Match(ops, model.Connect, server))
+	assert.Equal(t, model.SystemRuleOwner, sp.Match(alice, model.Connect, server))
+
+	// 自定义标签 key 和授予的动作
+	sp = model.SystemPolicy{
+		Team: model.SystemPolicyRule{TagKeys: model.ArrayString{"Team", "team"}, Actions: model.ConnectOnly},
+	}.WithDefaults()
+	assert.Equal(t, model.SystemRuleTeam, sp.Match(ops, model.Connect, server))
+	assert.Equal(t, "", sp.Match(ops, model.Download, server))
+
+	// 单独禁用规则
+	sp = model.SystemPolicy{
+		Admin: model.SystemPolicyRule{Disable: true},
+		Owner: model.SystemPolicyRule{Disable: true},
+	}.WithDefaults()
+	assert.Equal(t, "", sp.Match(admin, model.Connect, server))
+	assert.Equal(t, "", sp.Match(alice, model.Connect, server))
+
+	// 自定义超级用户组
+	sp = model.SystemPolicy{Admin: model.SystemPolicyRule{Groups: model.ArrayString{"sre"}}}.WithDefaults()
+	assert.Equal(t, "", sp.Match(admin, model.Connect, server))
+	assert.Equal(t, model.SystemRuleAdmin, sp.Match(model.User{Username: tea.String("carol"), Groups: model.ArrayString{"sre"}}, model.Connect, server))
+}
+
+func TestSystemPolicy_Validate(t *testing.T) {
+	assert.NoError(t, model.SystemPolicy{Team: model.SystemPolicyRule{Actions: model.ConnectAndDownload}}.Validate())
+	assert.Error(t, model.SystemPolicy{Owner: model.SystemPolicyRule{Actions: model.ArrayString{"deny_connect"}}}.Validate())
+}
@@ -4,50 +4,172 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"net"
+	"slices"
+	"strings"
 	"time"
 )
 
 type PolicyRequest struct {
-	Name           *string         `json:"name" binding:"required"`
-	Users          ArrayString     `json:"users"`
-	Actions        ArrayString     `json:"actions"`
-	ServerFilterV1 *ServerFilterV1 `json:"server_filter" binding:"required"`
-	ExpiresAt      *time.Time      `json:"expires_at"` // time.Time
-	IsEnabled      *bool           `json:"is_enabled"`
-	ApprovalID     *string         `json:"approval_id"`
+	Name             *string         `json:"name" binding:"required"`
+	Users            ArrayString     `json:"users"`
+	Groups           ArrayString     `json:"groups"` // 用户组，users 里 group:xxx 的写法也会转到这里
+	Actions          ArrayString     `json:"actions"`
+	ServerFilterV1   *ServerFilterV1 `json:"server_filter" binding:"required"`
+	ExpiresAt        *time.Time      `json:"expires_at"` // time.Time
+	IsEnabled        *bool           `json:"is_enabled"`
+	ApprovalID       *string         `json:"approval_id"`
+	ApprovalProvider *string         `json:"approval_provider"` // 外部审批系统，dingtalk 或者 feishu
+	ApprovalStatus   *ApprovalStatus `json:"approval_status"`   // 外部审批状态
+	Schedule         *PolicySchedule `json:"schedule"`          // 生效时间窗口，为空表示一直生效
+	SourceCIDRs      ArrayString     `json:"source_cidrs"`      // 限制 jms 客户端来源地址，如办公网或 VPN 网段
+	LoginUsers       ArrayString     `json:"login_users"`       // 允许的服务器登录用户，如 ec2-user 或者 !root，为空不限制
+	Justification    *string         `json:"justification"`     // 申请理由
+	TicketID         *string         `json:"ticket_id"`         // 关联的工单号，可选
+	RenewFrom        *string         `json:"renew_from"`        // 续期的原策略 ID
 }
 
 type Policy struct {
-	ID             string          `json:"id" gorm:"column:id;primary_key;not null"`
-	CreatedAt      time.Time       `json:"created_at" gorm:"column:created_at"`
-	UpdatedAt      time.Time       `json:"updated_at" gorm:"column:updated_at"`
-	IsDeleted      bool            `json:"is_deleted" gorm:"column:is_deleted;default:false;not null"`
-	Name           string          `json:"name" gorm:"column:name;not null"`
-	Users          ArrayString     `json:"users" gorm:"column:users;type:json;not null"`
-	ServerFilterV1 *ServerFilterV1 `json:"server_filter_v1" gorm:"column:server_filter_v1;type:json;"`
-	ServerFilter   *ServerFilter   `json:"server_filter" gorm:"column:server_filter;type:json;"`
-	Actions        ArrayString     `json:"actions" gorm:"column:actions;type:json;not null"`
-	ExpiresAt      time.Time       `json:"expires_at" gorm:"column:expires_at;not null"`
-	Approver       string          `json:"approver" gorm:"column:approver"`       // 审批人
-	ApprovalID     string          `json:"approval_id" gorm:"column:approval_id"` // 审批ID
-	IsEnabled      bool            `json:"is_enabled" gorm:"column:is_enabled;default:false;not null"`
+	ID               string          `json:"id" gorm:"column:id;primary_key;not null"`
+	CreatedAt        time.Time       `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt        time.Time       `json:"updated_at" gorm:"column:updated_at"`
+	IsDeleted        bool            `json:"is_deleted" gorm:"column:is_deleted;default:false;not null"`
+	Name             string          `json:"name" gorm:"column:name;not null"`
+	Users            ArrayString     `json:"users" gorm:"column:users;type:json;not null"`
+	Groups           ArrayString     `json:"groups" gorm:"column:groups;type:json"` // 用户组，用户的 Groups 包含即生效
+	ServerFilterV1   *ServerFilterV1 `json:"server_filter_v1" gorm:"column:server_filter_v1;type:json;"`
+	ServerFilter     *ServerFilter   `json:"server_filter" gorm:"column:server_filter;type:json;"`
+	Actions          ArrayString     `json:"actions" gorm:"column:actions;type:json;not null"`
+	ExpiresAt        time.Time       `json:"expires_at" gorm:"column:expires_at;not null"`
+	Approver         string          `json:"approver" gorm:"column:approver"`                                    // 审批人
+	ApprovalID       string          `json:"approval_id" gorm:"column:approval_id"`                              // 审批ID
+	ApprovalProvider string          `json:"approval_provider" gorm:"column:approval_provider;type:varchar(32)"` // 外部审批系统，为空是早期的钉钉审批
+	ApprovalStatus   ApprovalStatus  `json:"approval_status" gorm:"column:approval_status;type:varchar(32)"`     // 外部审批状态
+	IsEnabled        bool            `json:"is_enabled" gorm:"column:is_enabled;default:false;not null"`
+	Schedule         *PolicySchedule `json:"schedule" gorm:"column:schedule;type:json"`            // 生效时间窗口，为空表示一直生效
+	SourceCIDRs      ArrayString     `json:"source_cidrs" gorm:"column:source_cidrs;type:json"`    // 限制 jms 客户端来源地址，为空不限制
+	LoginUsers       ArrayString     `json:"login_users" gorm:"column:login_users;type:json"`      // 允许的服务器登录用户，支持 * 和 !，为空不限制
+	Justification    string          `json:"justification" gorm:"column:justification;type:text"`  // 申请理由
+	TicketID         string          `json:"ticket_id" gorm:"column:ticket_id;type:varchar(255)"`  // 关联的工单号
+	RenewFrom        string          `json:"renew_from" gorm:"column:renew_from;type:varchar(64)"` // 续期的原策略 ID
+	Expired          bool            `json:"expired" gorm:"column:expired;default:false;not null"` // 到期后由定时任务标记
+	ExpireNotifiedAt *time.Time      `json:"expire_notified_at" gorm:"column:expire_notified_at"`  // 到期提醒发送时间
+}
+
+// 给审批人看的申请说明，包括理由和工单号
+func (p *Policy) ApplyComment() string {
+	return ApplyComment(p.Justification, p.TicketID)
+}
+
+func ApplyComment(justification, ticketID string) string {
+	comment := fmt.Sprintf("申请理由: %s", justification)
+	if ticketID != "" {
+		comment += fmt.Sprintf("\n关联工单: %s", ticketID)
+	}
+	return comment
 }
 
 func (p *Policy) IsExpired() bool {
 	return time.Since(p.ExpiresAt) > 0
 }
 
+// 策略授予用户的依据，返回 user:xxx 或者 group:xxx，不适用返回空
+func (p *Policy) MatchSubject(user User) string {
+	if user.Username != nil && p.Users.Contains(*user.Username) {
+		return UserSubject(*user.Username)
+	}
+	for _, group := range p.Groups {
+		if slices.Contains(user.Groups, group) {
+			return GroupSubject(group)
+		}
+	}
+	return ""
+}
+
+// users 中 group:xxx 的写法转到 groups 里，方便按组授权
+func (r *PolicyRequest) NormalizeSubjects() {
+	if r.Users == nil {
+		return
+	}
+	users := ArrayString{}
+	for _, user := range r.Users {
+		if strings.HasPrefix(user, SubjectGroupPrefix) {
+			group := strings.TrimPrefix(user, SubjectGroupPrefix)
+			if !slices.Contains(r.Groups, group) {
+				r.Groups = append(r.Groups, group)
+			}
+			continue
+		}
+		users = append(users, strings.TrimPrefix(user, SubjectUserPrefix))
+	}
+	r.Users = users
+}
+
+// 判断客户端地址是否在策略允许的来源网段内，支持 ip:port 格式
+func (p *Policy) MatchSource(client string) bool {
+	if len(p.SourceCIDRs) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientHost(client))
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range p.SourceCIDRs {
+		if ipNet, err := parseCIDR(cidr); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidateSourceCIDRs(cidrs []string) error {
+	for _, cidr := range cidrs {
+		if _, err := parseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid source cidr %s: %s", cidr, err)
+		}
+	}
+	return nil
+}
+
+// 单个 IP 视为 /32 或者 /128
+func parseCIDR(cidr string) (*net.IPNet, error) {
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip")
+		}
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	return ipNet, err
+}
+
+func clientHost(client string) string {
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		return host
+	}
+	return client
+}
+
 func (Policy) TableName() string {
 	return "jms_go_policy"
 }
 
 // 可以预定义一些资产用来快速分配给其他策略c
+// 各个条件之间是 AND 关系，同一个条件的多个值之间是 OR 关系
 type ServerFilterV1 struct {
-	Name    []string `json:"name"`     // 名字完全匹配，支持*
-	IpAddr  []string `json:"ip_addr"`  // IP 地址完全匹配，支持* 匹配所有
-	EnvType []string `json:"env_type"` // 机器 Tags 中的 EnvType，支持* 匹配所有
-	Team    []string `json:"team"`     // 机器 Tags 中的 Team，支持* 匹配所有
-	KV      *KV      `json:"kv"`       // 支持自己指定特定的 KV 来过滤
+	Name    []string         `json:"name"`           // 名字完全匹配，支持*，~ 开头为正则(自动首尾锚定)，如 ~web-\d+
+	IpAddr  []string         `json:"ip_addr"`        // IP 地址完全匹配，支持* 匹配所有，支持 CIDR 如 10.9.0.0/16
+	EnvType []string         `json:"env_type"`       // 机器 Tags 中的 EnvType，支持* 匹配所有
+	Team    []string         `json:"team"`           // 机器 Tags 中的 Team，支持* 匹配所有
+	KV      *KV              `json:"kv"`             // 支持自己指定特定的 KV 来过滤
+	Tags    []TagCondition   `json:"tags,omitempty"` // 多个标签条件，全部满足才匹配
+	All     []ServerFilterV1 `json:"all,omitempty"`  // 子条件全部满足
+	Any     []ServerFilterV1 `json:"any,omitempty"`  // 子条件满足任意一个
 }
 
 type KV struct {
@@ -55,6 +177,24 @@ type KV struct {
 	Value string `json:"value"`
 }
 
+type TagOperator string
+
+const (
+	TagEqual     TagOperator = "="
+	TagNotEqual  TagOperator = "!="
+	TagIn        TagOperator = "in"
+	TagExists    TagOperator = "exists"
+	TagNotExists TagOperator = "not exists"
+)
+
+// 标签条件，= 和 != 使用 value，in 使用 values
+type TagCondition struct {
+	Key      string      `json:"key"`
+	Operator TagOperator `json:"operator"`
+	Value    string      `json:"value,omitempty"`
+	Values   []string    `json:"values,omitempty"`
+}
+
 func (a ServerFilterV1) ToString() string {
 	return fmt.Sprintf("%v", a)
 }
@@ -0,0 +1,58 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	"github.com/xops-infra/jms/model"
+)
+
+func TestPolicy_MatchSubject(t *testing.T) {
+	alice := model.User{Username: tea.String("alice"), Groups: model.ArrayString{"sre", "dev"}}
+	bob := model.User{Username: tea.String("bob")}
+
+	policy := model.Policy{Users: model.ArrayString{"alice"}, Groups: model.ArrayString{"sre"}}
+	assert.Equal(t, "user:alice", policy.MatchSubject(alice))
+	assert.Equal(t, "", policy.MatchSubject(bob))
+
+	policy = model.Policy{Users: model.ArrayString{}, Groups: model.ArrayString{"ops", "dev"}}
+	assert.Equal(t, "group:dev", policy.MatchSubject(alice))
+	assert.Equal(t, "", policy.MatchSubject(bob))
+
+	// 兼容 users 写 * 的情况
+	policy = model.Policy{Users: model.ArrayString{"*"}}
+	assert.Equal(t, "user:bob", policy.MatchSubject(bob))
+}
+
+func TestPolicyRequest_NormalizeSubjects(t *testing.T) {
+	req := model.PolicyRequest{
+		Users:  model.ArrayString{"alice", "group:sre", "user:bob", "group:ops"},
+		Groups: model.ArrayString{"ops"},
+	}
+	req.NormalizeSubjects()
+	assert.Equal(t, model.ArrayString{"alice", "bob"}, req.Users)
+	assert.Equal(t, model.ArrayString{"ops", "sre"}, req.Groups)
+
+	req = model.PolicyRequest{}
+	req.NormalizeSubjects()
+	assert.Nil(t, req.Users)
+}
+
+func TestPolicy_MatchSource(t *testing.T) {
+	policy := model.Policy{}
+	assert.True(t, policy.MatchSource("1.2.3.4:5678"))
+
+	policy.SourceCIDRs = model.ArrayString{"10.0.0.0/8", "192.168.1.10", "fd00::/8"}
+	assert.True(t, policy.MatchSource("10.9.1.2:50022"))
+	assert.True(t, policy.MatchSource("10.9.1.2"))
+	assert.True(t, policy.MatchSource("192.168.1.10:22"))
+	assert.False(t, policy.MatchSource("192.168.1.11:22"))
+	assert.True(t, policy.MatchSource("[fd00::1]:22"))
+	assert.False(t, policy.MatchSource("8.8.8.8:22"))
+	assert.False(t, policy.MatchSource("bad-addr"))
+
+	assert.NoError(t, model.ValidateSourceCIDRs([]string{"10.0.0.0/8", "1.1.1.1", "::1"}))
+	assert.Error(t, model.ValidateSourceCIDRs([]string{"10.0.0.0/33"}))
+	assert.Error(t, model.ValidateSourceCIDRs([]string{"office"}))
+}
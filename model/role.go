@@ -0,0 +1,104 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 管理接口的角色，admin 拥有所有权限
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"    // 所有接口
+	RoleAuditor  Role = "auditor"  // 只读审计接口
+	RoleOperator Role = "operator" // 批量脚本任务
+	RoleApprover Role = "approver" // 审批
+
+	SubjectUserPrefix  = "user:"
+	SubjectGroupPrefix = "group:"
+)
+
+var AllRoles = []Role{RoleAdmin, RoleAuditor, RoleOperator, RoleApprover}
+
+func (r Role) IsValid() bool {
+	for _, role := range AllRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type Roles []Role
+
+// 命中任一角色即可，admin 默认拥有所有角色
+func (rs Roles) Has(roles ...Role) bool {
+	for _, r := range rs {
+		if r == RoleAdmin {
+			return true
+		}
+		for _, role := range roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 令牌限定角色范围，scopes 为空时不限制
+func (rs Roles) Scope(scopes Roles) Roles {
+	if len(scopes) == 0 {
+		return rs
+	}
+	var res Roles
+	for _, scope := range scopes {
+		if rs.Has(scope) {
+			res = append(res, scope)
+		}
+	}
+	return res
+}
+
+func UserSubject(username string) string {
+	return SubjectUserPrefix + username
+}
+
+func GroupSubject(group string) string {
+	return SubjectGroupPrefix + group
+}
+
+type RoleBindingRequest struct {
+	Role    *Role   `json:"role" binding:"required"`    // admin, auditor, operator, approver
+	Subject *string `json:"subject" binding:"required"` // user:alice 或者 group:sre
+}
+
+func (req *RoleBindingRequest) Validate() error {
+	if req.Role == nil || !req.Role.IsValid() {
+		return fmt.Errorf("invalid role, must be one of %v", AllRoles)
+	}
+	if req.Subject == nil {
+		return fmt.Errorf("subject is required")
+	}
+	for _, prefix := range []string{SubjectUserPrefix, SubjectGroupPrefix} {
+		if strings.HasPrefix(*req.Subject, prefix) && strings.TrimPrefix(*req.Subject, prefix) != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid subject %s, must be user:<name> or group:<name>", *req.Subject)
+}
+
+// RoleBinding 角色授予给用户或者用户组
+type RoleBinding struct {
+	gorm.Model `json:"-"`
+	IsDelete   bool   `json:"-" gorm:"column:is_delete;type:boolean;not null;default:false"`
+	UUID       string `json:"uuid" gorm:"column:uuid;type:varchar(36);unique_index;not null"`
+	Role       Role   `json:"role" gorm:"column:role;type:varchar(64);not null"`
+	Subject    string `json:"subject" gorm:"column:subject;type:varchar(255);not null"`
+}
+
+func (RoleBinding) TableName() string {
+	return "jms_go_role_binding"
+}
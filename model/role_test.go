@@ -0,0 +1,48 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	"github.com/xops-infra/jms/model"
+)
+
+func TestRoles_Has(t *testing.T) {
+	{
+		roles := model.Roles{model.RoleAdmin}
+		assert.True(t, roles.Has(model.RoleAuditor))
+		assert.True(t, roles.Has(model.RoleOperator, model.RoleApprover))
+	}
+	{
+		roles := model.Roles{model.RoleAuditor}
+		assert.True(t, roles.Has(model.RoleAuditor))
+		assert.False(t, roles.Has(model.RoleOperator))
+		assert.False(t, roles.Has(model.RoleAdmin))
+	}
+	{
+		var roles model.Roles
+		assert.False(t, roles.Has(model.RoleAuditor))
+	}
+}
+
+func TestRoleBindingRequest_Validate(t *testing.T) {
+	role := model.RoleOperator
+	assert.NoError(t, (&model.RoleBindingRequest{Role: &role, Subject: tea.String("user:alice")}).Validate())
+	assert.NoError(t, (&model.RoleBindingRequest{Role: &role, Subject: tea.String("group:sre")}).Validate())
+	assert.Error(t, (&model.RoleBindingRequest{Role: &role, Subject: tea.String("alice")}).Validate())
+	assert.Error(t, (&model.RoleBindingRequest{Role: &role, Subject: tea.String("group:")}).Validate())
+
+	unknown := model.Role("root")
+	assert.Error(t, (&model.RoleBindingRequest{Role: &unknown, Subject: tea.String("user:alice")}).Validate())
+}
+
+func TestRoles_Scope(t *testing.T) {
+	admin := model.Roles{model.RoleAdmin}
+	assert.Equal(t, admin, admin.Scope(nil))
+	assert.Equal(t, model.Roles{model.RoleAuditor}, admin.Scope(model.Roles{model.RoleAuditor}))
+
+	operator := model.Roles{model.RoleOperator}
+	assert.Empty(t, operator.Scope(model.Roles{model.RoleAdmin, model.RoleAuditor}))
+	assert.False(t, operator.Scope(model.Roles{model.RoleAuditor}).Has(model.RoleOperator))
+}
@@ -0,0 +1,32 @@
+package model
+
+import "gorm.io/gorm"
+
+type QueryApiDenyRequest struct {
+	Duration *int    `json:"duration" default:"24"` // 24 hours 默认
+	User     *string `json:"user"`
+	Path     *string `json:"path"`
+}
+
+type AddApiDenyRecordRequest struct {
+	User     *string `json:"user"`     // 调用者
+	Client   *string `json:"client"`   // 客户端 IP
+	Method   *string `json:"method"`   // GET,POST...
+	Path     *string `json:"path"`     // 请求路径
+	Required *string `json:"required"` // 需要的角色
+}
+
+// ApiDenyRecord 管理接口角色校验不通过的记录
+type ApiDenyRecord struct {
+	gorm.Model
+	User     string `json:"user" gorm:"column:user;type:varchar(255);not null"`
+	Client   string `json:"client" gorm:"column:client;type:varchar(255);not null"`
+	Method   string `json:"method" gorm:"column:method;type:varchar(16);not null"`
+	Path     string `json:"path" gorm:"column:path;type:varchar(255);not null"`
+	Required string `json:"required" gorm:"column:required;type:varchar(255);not null"`
+}
+
+// table name
+func (ApiDenyRecord) TableName() string {
+	return "record_api_deny"
+}
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type ChangeAction string
+
+const (
+	ChangeCreate  ChangeAction = "create"
+	ChangeUpdate  ChangeAction = "update"
+	ChangeDelete  ChangeAction = "delete"
+	ChangeRestore ChangeAction = "restore"
+)
+
+// 管理接口变更的资源类型
+const (
+	ResourcePolicy     = "policy"
+	ResourceUser       = "user"
+	ResourceKey        = "key"
+	ResourceProfile    = "profile"
+	ResourceProxy      = "proxy"
+	ResourceShellTask  = "shell_task"
+	ResourceBroadcast  = "broadcast"
+	ResourceRole       = "role"
+	ResourceToken      = "token"
+	ResourceApproval   = "approval"
+	ResourceBreakGlass = "break_glass"
+	ResourceServer     = "server"
+)
+
+// 脱敏字段，key 统一转小写去掉下划线后匹配
+var secretFields = map[string]bool{
+	"passwd":      true,
+	"password":    true,
+	"loginpasswd": true,
+	"sk":          true,
+	"pembase64":   true,
+	"token":       true,
+	"tokenhash":   true,
+	"secret":      true,
+	"appsecret":   true,
+}
+
+const redacted = "****"
+
+type QueryApiChangeRequest struct {
+	Duration   *int    `json:"duration" default:"24"` // 24 hours 默认
+	Actor      *string `json:"actor"`
+	Action     *string `json:"action"`
+	Resource   *string `json:"resource"`
+	ResourceID *string `json:"resource_id"`
+}
+
+type AddApiChangeRequest struct {
+	Actor      *string       `json:"actor"`
+	Client     *string       `json:"client"`
+	Action     *ChangeAction `json:"action"`
+	Resource   *string       `json:"resource"`
+	ResourceID *string       `json:"resource_id"`
+	Before     interface{}   `json:"before"`
+	After      interface{}   `json:"after"`
+}
+
+type ChangeItem struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// ApiChangeRecord 管理接口的变更记录，before/after 已经脱敏
+type ApiChangeRecord struct {
+	gorm.Model
+	Actor      string `json:"actor" gorm:"column:actor;type:varchar(255);not null"`
+	Client     string `json:"client" gorm:"column:client;type:varchar(255);not null"`
+	Action     string `json:"action" gorm:"column:action;type:varchar(32);not null"`
+	Resource   string `json:"resource" gorm:"column:resource;type:varchar(64);not null"`
+	ResourceID string `json:"resource_id" gorm:"column:resource_id;type:varchar(255);not null"`
+	Before     string `json:"before" gorm:"column:before;type:text"`
+	After      string `json:"after" gorm:"column:after;type:text"`
+	Diff       string `json:"diff" gorm:"column:diff;type:text"`
+}
+
+// table name
+func (ApiChangeRecord) TableName() string {
+	return "record_api_change"
+}
+
+// ToRedactedMap 转换为 map 并脱敏，非对象类型放到 value 字段里
+func ToRedactedMap(v interface{}) map[string]interface{} {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return map[string]interface{}{"value": err.Error()}
+	}
+	var res interface{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return map[string]interface{}{"value": string(data)}
+	}
+	m, ok := res.(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{"value": res}
+	}
+	return redact(m).(map[string]interface{})
+}
+
+func redact(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if secretFields[strings.ReplaceAll(strings.ToLower(k), "_", "")] {
+				if item != nil && item != "" {
+					val[k] = redacted
+				}
+				continue
+			}
+			val[k] = redact(item)
+		}
+		return val
+	case []interface{}:
+		for i := range val {
+			val[i] = redact(val[i])
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// DiffChange 对比变更前后字段，只返回有变化的字段
+func DiffChange(before, after map[string]interface{}) map[string]ChangeItem {
+	keys := make(map[string]bool)
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	diff := make(map[string]ChangeItem)
+	for k := range keys {
+		if reflect.DeepEqual(before[k], after[k]) {
+			continue
+		}
+		diff[k] = ChangeItem{Before: before[k], After: after[k]}
+	}
+	return diff
+}
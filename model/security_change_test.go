@@ -0,0 +1,43 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	"github.com/xops-infra/jms/model"
+)
+
+func TestToRedactedMap(t *testing.T) {
+	var nilKey *model.Key
+	assert.Nil(t, model.ToRedactedMap(nil))
+	assert.Nil(t, model.ToRedactedMap(nilKey))
+
+	m := model.ToRedactedMap(map[string]interface{}{
+		"name":       "test",
+		"passwd":     "123456",
+		"pem_base64": "xxx",
+		"empty_sk":   "",
+		"sk":         "",
+		"nested":     map[string]interface{}{"AppSecret": "s"},
+	})
+	assert.Equal(t, "test", m["name"])
+	assert.Equal(t, "****", m["passwd"])
+	assert.Equal(t, "****", m["pem_base64"])
+	assert.Equal(t, "", m["sk"])
+	assert.Equal(t, "****", m["nested"].(map[string]interface{})["AppSecret"])
+
+	assert.Equal(t, map[string]interface{}{"value": "abc"}, model.ToRedactedMap(tea.String("abc")))
+}
+
+func TestDiffChange(t *testing.T) {
+	before := map[string]interface{}{"name": "a", "enabled": true, "old": 1}
+	after := map[string]interface{}{"name": "b", "enabled": true, "new": 2}
+	diff := model.DiffChange(before, after)
+	assert.Len(t, diff, 3)
+	assert.Equal(t, model.ChangeItem{Before: "a", After: "b"}, diff["name"])
+	assert.Equal(t, model.ChangeItem{Before: 1, After: nil}, diff["old"])
+	assert.Equal(t, model.ChangeItem{Before: nil, After: 2}, diff["new"])
+
+	assert.Len(t, model.DiffChange(nil, nil), 0)
+}
@@ -11,17 +11,19 @@ import (
 
 // Server server
 type Server struct {
-	ID       string               `gorm:"primaryKey;column:id;not null"`
-	Name     string               `gorm:"column:name"`
-	Host     string               `gorm:"column:host"` // 默认取私有 IP 第一个
-	Port     int                  `gorm:"column:port"`
-	KeyPairs StringSlice          `gorm:"column:key_pairs;type:json"` // key pair name
-	User     string               `gorm:"column:user;default:''"`     // 用 KEY 的这里可以不写，在 key里面指定用户，如果带上 Passwd的 User必须有
-	Passwd   string               `gorm:"column:passwd;default:''"`
-	Profile  string               `gorm:"column:profile"`
-	Region   string               `gorm:"column:region"`
-	Tags     model.Tags           `gorm:"column:tags;type:json"`
-	Status   model.InstanceStatus `gorm:"column:status"`
+	ID            string               `gorm:"primaryKey;column:id;not null"`
+	Name          string               `gorm:"column:name"`
+	Host          string               `gorm:"column:host"` // 默认取私有 IP 第一个
+	Port          int                  `gorm:"column:port"`
+	KeyPairs      StringSlice          `gorm:"column:key_pairs;type:json"` // key pair name
+	User          string               `gorm:"column:user;default:''"`     // 用 KEY 的这里可以不写，在 key里面指定用户，如果带上 Passwd的 User必须有
+	Passwd        string               `gorm:"column:passwd;default:''"`
+	Profile       string               `gorm:"column:profile"`
+	Region        string               `gorm:"column:region"`
+	Tags          model.Tags           `gorm:"column:tags;type:json"`
+	Status        model.InstanceStatus `gorm:"column:status"`
+	Source        string               `gorm:"column:source;type:varchar(32);default:''"` // manual 为接口添加的服务器，云同步不会删除和覆盖
+	CredentialSet bool                 `gorm:"column:credential_set;default:false"`       // 通过接口设置过账号密码，云同步时保留 User 和 Passwd
 }
 
 func (s *Server) TableName() string {
@@ -0,0 +1,215 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/xops-infra/multi-cloud-sdk/pkg/model"
+)
+
+// 接口添加的服务器，云同步不会删除和覆盖
+const ServerSourceManual = "manual"
+
+// ServerInfo 服务器接口返回，不返回密码
+type ServerInfo struct {
+	ID            string               `json:"id"`
+	Name          string               `json:"name"`
+	Host          string               `json:"host"`
+	Port          int                  `json:"port"`
+	User          string               `json:"user"`
+	HasPasswd     bool                 `json:"has_passwd"`     // 是否配置了密码
+	CredentialSet bool                 `json:"credential_set"` // 通过接口设置过账号密码，云同步时保留
+	KeyPairs      []string             `json:"key_pairs"`
+	Profile       string               `json:"profile"`
+	Region        string               `json:"region"`
+	Tags          map[string]string    `json:"tags"`
+	Status        model.InstanceStatus `json:"status"`
+	Source        string               `json:"source"` // manual 为接口添加，为空是云同步或者 localServers 配置
+}
+
+func (s Server) ToInfo() ServerInfo {
+	tags := map[string]string{}
+	for _, tag := range s.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	keyPairs := []string{}
+	keyPairs = append(keyPairs, s.KeyPairs...)
+	return ServerInfo{
+		ID:            s.ID,
+		Name:          s.Name,
+		Host:          s.Host,
+		Port:          s.Port,
+		User:          s.User,
+		HasPasswd:     s.Passwd != "",
+		CredentialSet: s.CredentialSet,
+		KeyPairs:      keyPairs,
+		Profile:       s.Profile,
+		Region:        s.Region,
+		Tags:          tags,
+		Status:        s.Status,
+		Source:        s.Source,
+	}
+}
+
+func (s Server) IsManual() bool {
+	return s.Source == ServerSourceManual
+}
+
+// 服务器列表，分页返回
+type ServerListResponse struct {
+	Total int          `json:"total"`
+	Page  int          `json:"page"`
+	Size  int          `json:"size"`
+	Items []ServerInfo `json:"items"`
+}
+
+// FilterServers 按 ServerFilterV1 过滤，filter 为空返回所有
+func FilterServers(servers []Server, filter ServerFilterV1) []Server {
+	if filter.IsEmpty() {
+		return servers
+	}
+	var res []Server
+	for _, server := range servers {
+		if MatchServerByFilter(filter, server, false) {
+			res = append(res, server)
+		}
+	}
+	return res
+}
+
+// PageServers page 从 1 开始，size 默认 20，最大 500
+func PageServers(servers []Server, page, size int) ServerListResponse {
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = 20
+	}
+	if size > 500 {
+		size = 500
+	}
+	res := ServerListResponse{Total: len(servers), Page: page, Size: size, Items: []ServerInfo{}}
+	start := (page - 1) * size
+	for i := start; i < len(servers) && i < start+size; i++ {
+		res.Items = append(res.Items, servers[i].ToInfo())
+	}
+	return res
+}
+
+// 手动添加服务器，id 为空时使用 host，和 localServers 一致
+type CreateServerRequest struct {
+	ID       *string           `json:"id"`
+	Name     *string           `json:"name" binding:"required"`
+	Host     *string           `json:"host" binding:"required"`
+	Port     *int              `json:"port"` // 默认 22
+	User     *string           `json:"user"`
+	Passwd   *string           `json:"passwd"`
+	KeyPairs []string          `json:"key_pairs"` // 登录使用的 key 名称，和 key 管理中的 KeyID 对应
+	Profile  *string           `json:"profile"`
+	Region   *string           `json:"region"`
+	Tags     map[string]string `json:"tags"` // EnvType,Team 等标签，策略按标签匹配
+}
+
+func (req CreateServerRequest) ToServer() (Server, error) {
+	server := Server{
+		Port:     22,
+		KeyPairs: req.KeyPairs,
+		Tags:     tagsFromMap(req.Tags),
+		Status:   model.InstanceStatusRunning,
+		Source:   ServerSourceManual,
+	}
+	if req.Name != nil {
+		server.Name = *req.Name
+	}
+	if req.Host != nil {
+		server.Host = *req.Host
+	}
+	server.ID = server.Host
+	if req.ID != nil && *req.ID != "" {
+		server.ID = *req.ID
+	}
+	if req.Port != nil {
+		server.Port = *req.Port
+	}
+	if req.User != nil {
+		server.User = *req.User
+	}
+	if req.Passwd != nil {
+		server.Passwd = *req.Passwd
+	}
+	if req.Profile != nil {
+		server.Profile = *req.Profile
+	}
+	if req.Region != nil {
+		server.Region = *req.Region
+	}
+	return server, server.validate()
+}
+
+// 修改手动添加的服务器，为空的字段不修改，账号密码通过 credentials 接口修改
+type UpdateServerRequest struct {
+	Name     *string               `json:"name"`
+	Host     *string               `json:"host"`
+	Port     *int                  `json:"port"`
+	KeyPairs []string              `json:"key_pairs"`
+	Profile  *string               `json:"profile"`
+	Region   *string               `json:"region"`
+	Tags     map[string]string     `json:"tags"`
+	Status   *model.InstanceStatus `json:"status"` // 可以标记为 Stopped 暂停登录
+}
+
+func (req UpdateServerRequest) Apply(server Server) (Server, error) {
+	if req.Name != nil {
+		server.Name = *req.Name
+	}
+	if req.Host != nil {
+		server.Host = *req.Host
+	}
+	if req.Port != nil {
+		server.Port = *req.Port
+	}
+	if req.KeyPairs != nil {
+		server.KeyPairs = req.KeyPairs
+	}
+	if req.Profile != nil {
+		server.Profile = *req.Profile
+	}
+	if req.Region != nil {
+		server.Region = *req.Region
+	}
+	if req.Tags != nil {
+		server.Tags = tagsFromMap(req.Tags)
+	}
+	if req.Status != nil {
+		server.Status = *req.Status
+	}
+	return server, server.validate()
+}
+
+// 设置服务器登录账号密码，云同步的服务器也可以设置，同步时保留 user 和 passwd(包括只设置 user 用 key 登录的情况)
+type ServerCredentialRequest struct {
+	User   *string `json:"user" binding:"required"`
+	Passwd *string `json:"passwd"` // 为空清除密码，改用 key 登录
+}
+
+func (s Server) validate() error {
+	if s.Name == "" || s.Host == "" || s.ID == "" {
+		return fmt.Errorf("server id, name and host are required")
+	}
+	if s.Port < 1 || s.Port > 65535 {
+		return fmt.Errorf("server port %d invalid", s.Port)
+	}
+	return nil
+}
+
+// 按 key 排序，保证入库顺序稳定
+func tagsFromMap(m map[string]string) model.Tags {
+	tags := model.Tags{}
+	for k, v := range m {
+		tags = append(tags, model.Tag{Key: k, Value: v})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Key < tags[j].Key
+	})
+	return tags
+}
@@ -0,0 +1,73 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	mcsModel "github.com/xops-infra/multi-cloud-sdk/pkg/model"
+
+	"github.com/xops-infra/jms/model"
+)
+
+func TestCreateServerRequest(t *testing.T) {
+	server, err := model.CreateServerRequest{
+		Name:   tea.String("idc-db"),
+		Host:   tea.String("192.168.1.10"),
+		User:   tea.String("root"),
+		Passwd: tea.String("secret"),
+		Tags:   map[string]string{"Team": "dba", "EnvType": "prod"},
+	}.ToServer()
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.10", server.ID)
+	assert.Equal(t, 22, server.Port)
+	assert.True(t, server.IsManual())
+	assert.Equal(t, mcsModel.InstanceStatusRunning, server.Status)
+	assert.Equal(t, "EnvType", server.Tags[0].Key)
+
+	info := server.ToInfo()
+	assert.True(t, info.HasPasswd)
+	assert.Equal(t, map[string]string{"Team": "dba", "EnvType": "prod"}, info.Tags)
+	assert.Equal(t, []string{}, info.KeyPairs)
+
+	_, err = model.CreateServerRequest{Name: tea.String("x"), Host: tea.String("1.1.1.1"), Port: tea.Int(70000)}.ToServer()
+	assert.Error(t, err)
+	_, err = model.CreateServerRequest{Host: tea.String("1.1.1.1")}.ToServer()
+	assert.Error(t, err)
+
+	updated, err := model.UpdateServerRequest{Name: tea.String("idc-db-1"), KeyPairs: []string{"key-1"}}.Apply(server)
+	assert.NoError(t, err)
+	assert.Equal(t, "idc-db-1", updated.Name)
+	assert.Equal(t, "192.168.1.10", updated.Host)
+	assert.Equal(t, "secret", updated.Passwd)
+	assert.Equal(t, model.StringSlice{"key-1"}, updated.KeyPairs)
+	_, err = model.UpdateServerRequest{Host: tea.String("")}.Apply(server)
+	assert.Error(t, err)
+}
+
+func TestFilterAndPageServers(t *testing.T) {
+	var servers []model.Server
+	for _, s := range []struct{ name, host, env string }{
+		{"web-1", "10.0.0.1", "prod"},
+		{"web-2", "10.0.0.2", "dev"},
+		{"db-1", "10.0.1.1", "prod"},
+	} {
+		servers = append(servers, model.Server{ID: s.host, Name: s.name, Host: s.host, Tags: mcsModel.Tags{{Key: "EnvType", Value: s.env}}})
+	}
+	assert.Len(t, model.FilterServers(servers, model.ServerFilterV1{}), 3)
+	assert.Len(t, model.FilterServers(servers, model.ServerFilterV1{Name: []string{"web-*"}}), 2)
+	assert.Len(t, model.FilterServers(servers, model.ServerFilterV1{EnvType: []string{"prod"}, IpAddr: []string{"10.0.0.0/24"}}), 1)
+	assert.Len(t, model.FilterServers(servers, model.ServerFilterV1{Name: []string{"!web-*"}}), 1)
+
+	page := model.PageServers(servers, 2, 2)
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Items, 1)
+	assert.Equal(t, "db-1", page.Items[0].Name)
+
+	page = model.PageServers(servers, 0, 0)
+	assert.Equal(t, 1, page.Page)
+	assert.Equal(t, 20, page.Size)
+	assert.Len(t, page.Items, 3)
+	assert.Empty(t, model.PageServers(servers, 5, 2).Items)
+	assert.NotNil(t, model.PageServers(nil, 1, 10).Items)
+}
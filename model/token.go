@@ -0,0 +1,53 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 个人访问令牌前缀，用于和 jwt 区分
+const ApiTokenPrefix = "jms_"
+
+type CreateApiTokenRequest struct {
+	Name        *string `json:"name" binding:"required"` // 令牌用途，比如 ci-deploy
+	Scopes      []Role  `json:"scopes"`                  // 令牌可用角色，为空则继承用户所有角色
+	ExpiresDays *int    `json:"expires_days"`            // 有效天数，默认 90 天
+}
+
+type CreateApiTokenResponse struct {
+	UUID      string    `json:"uuid"`
+	Token     string    `json:"token"` // 只在创建时返回一次
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ApiToken 个人访问令牌，只保存 sha256 值
+type ApiToken struct {
+	gorm.Model `json:"-"`
+	IsDelete   bool        `json:"-" gorm:"column:is_delete;type:boolean;not null;default:false"`
+	UUID       string      `json:"uuid" gorm:"column:uuid;type:varchar(36);unique_index;not null"`
+	Name       string      `json:"name" gorm:"column:name;type:varchar(255);not null"`
+	User       string      `json:"user" gorm:"column:user;type:varchar(255);not null"`
+	TokenHash  string      `json:"-" gorm:"column:token_hash;type:varchar(64);unique_index;not null"`
+	Prefix     string      `json:"prefix" gorm:"column:prefix;type:varchar(16);not null"` // 令牌前几位，方便识别
+	Scopes     ArrayString `json:"scopes" gorm:"column:scopes;type:json"`
+	ExpiresAt  time.Time   `json:"expires_at" gorm:"column:expires_at;not null"`
+	LastUsedAt *time.Time  `json:"last_used_at" gorm:"column:last_used_at"`
+	LastUsedIP string      `json:"last_used_ip" gorm:"column:last_used_ip;type:varchar(255);not null;default:''"`
+}
+
+func (ApiToken) TableName() string {
+	return "jms_go_api_token"
+}
+
+func (t *ApiToken) IsExpired() bool {
+	return time.Since(t.ExpiresAt) > 0
+}
+
+func (t *ApiToken) GetScopes() Roles {
+	var roles Roles
+	for _, scope := range t.Scopes {
+		roles = append(roles, Role(scope))
+	}
+	return roles
+}
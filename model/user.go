@@ -12,6 +12,7 @@ type User struct {
 	Email          *string     `json:"email" gorm:"column:email"`
 	DingtalkID     *string     `json:"dingtalk_id" gorm:"column:dingtalk_id"`
 	DingtalkDeptID *string     `json:"dingtalk_dept_id" gorm:"column:dingtalk_dept_id"`
+	FeishuID       *string     `json:"feishu_id" gorm:"column:feishu_id"`     // 飞书 user_id，使用飞书审批时需要
 	Groups         ArrayString `json:"groups" gorm:"column:groups;type:json"` // 组不在 jms维护这里只需要和机器 tag:Team 匹配即可。
 	IsLdap         *bool       `json:"is_ldap" gorm:"column:is_ldap;default:false;not null"`
 }
@@ -26,9 +27,15 @@ type UserRequest struct {
 	Groups         ArrayString `json:"groups"`
 	DingtalkDeptID *string     `json:"dingtalk_dept_id"`
 	DingtalkID     *string     `json:"dingtalk_id"`
+	FeishuID       *string     `json:"feishu_id"`
 	Passwd         *string     `json:"passwd"`
 }
 
 type UserPatchMut struct {
 	Groups ArrayString `json:"groups"`
 }
+
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}